@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/contactkeval/option-replay/internal/backtest/engine"
+	"github.com/contactkeval/option-replay/internal/backtest/sweep"
 	"github.com/contactkeval/option-replay/internal/data"
 	"github.com/contactkeval/option-replay/internal/report"
 )
@@ -18,29 +19,48 @@ func main() {
 	configPath := flag.String("config", filepath.Join("..", "..", "strategies", "covered_call.json"), "path to JSON config")
 	rest := flag.Bool("rest", false, "run as REST server (accept backtest jobs)")
 	port := flag.String("port", ":8080", "REST server listen address")
+	sweepPath := flag.String("sweep", "", "path to JSON sweep spec: run a base config over a parameter grid")
+	walkPath := flag.String("walkforward", "", "path to JSON walk-forward spec: optimise in sample, validate out of sample")
+	stressPath := flag.String("stress", "", "path to JSON stress spec: reprice a trade or planned strategy under shocked scenarios")
+	scenarioPath := flag.String("scenario", "", "path to JSON synthetic scenario spec: replay a generated market instead of history")
 	flag.Parse()
 
+	if *sweepPath != "" {
+		runSweep(*sweepPath, newProvider(*scenarioPath))
+		return
+	}
+	if *walkPath != "" {
+		runWalkForward(*walkPath, newProvider(*scenarioPath))
+		return
+	}
+	if *stressPath != "" {
+		runStress(*stressPath, newProvider(*scenarioPath))
+		return
+	}
+
 	cfgData, err := os.ReadFile(*configPath)
 	if err != nil {
 		log.Fatalf("reading config: %v", err)
 	}
 
+	// a config with sleeves runs several strategies against one account
+	var probe struct {
+		Sleeves []json.RawMessage `json:"sleeves"`
+	}
+	_ = json.Unmarshal(cfgData, &probe)
+
+	prov := newProvider(*scenarioPath)
+
+	if len(probe.Sleeves) > 0 {
+		runPortfolio(cfgData, prov)
+		return
+	}
+
 	var cfg engine.Config
 	if err := json.Unmarshal(cfgData, &cfg); err != nil {
 		log.Fatalf("invalid config: %v", err)
 	}
 
-	// choose provider
-	var prov data.Provider
-	apiKey := os.Getenv("POLYGON_API_KEY")
-	if apiKey != "" {
-		prov = data.NewMassiveDataProvider(apiKey)
-		log.Printf("[info] polygon provider enabled")
-	} else {
-		prov = data.NewSyntheticProvider()
-		log.Printf("[info] synthetic provider enabled")
-	}
-
 	engine := engine.NewEngine(&cfg, prov)
 
 	if *rest {
@@ -73,5 +93,122 @@ func main() {
 	}
 	_ = report.WriteJSON(res, cfg.ReportDir)
 	_ = report.WriteCSV(res.Trades, cfg.ReportDir)
+	_ = report.WriteEquityCSV(res.Equity, cfg.ReportDir)
+	_ = report.WriteMonteCarloCSV(res, cfg.ReportDir)
 	log.Printf("[done] finished in %v, wrote %d trades to %s", time.Since(start), len(res.Trades), cfg.ReportDir)
 }
+
+// runPortfolio runs a multi-strategy portfolio config and writes the combined
+// and per-sleeve reports.
+func runPortfolio(cfgData []byte, prov data.Provider) {
+	var cfg engine.PortfolioConfig
+	if err := json.Unmarshal(cfgData, &cfg); err != nil {
+		log.Fatalf("invalid portfolio config: %v", err)
+	}
+
+	start := time.Now()
+	res, err := engine.NewPortfolioEngine(&cfg, prov).Run()
+	if err != nil {
+		log.Fatalf("portfolio backtest failed: %v", err)
+	}
+	if err := os.MkdirAll(cfg.ReportDir, 0755); err != nil {
+		log.Printf("[warn] could not create output dir %s: %v", cfg.ReportDir, err)
+	}
+	_ = report.WritePortfolioJSON(res, cfg.ReportDir)
+	_ = report.WriteCSV(res.Trades, cfg.ReportDir)
+	_ = report.WriteEquityCSV(res.Equity, cfg.ReportDir)
+	_ = report.WriteSleevesCSV(res, cfg.ReportDir)
+	log.Printf("[done] finished in %v, wrote %d trades of %d sleeves to %s", time.Since(start), len(res.Trades), len(res.Sleeves), cfg.ReportDir)
+}
+
+// newProvider chooses the market data provider: the synthetic scenario of
+// scenarioPath if given, else from the environment.
+func newProvider(scenarioPath string) data.Provider {
+	if scenarioPath != "" {
+		spec, err := data.LoadSyntheticSpec(scenarioPath)
+		if err != nil {
+			log.Fatalf("invalid scenario: %v", err)
+		}
+		prov, err := data.NewScenarioProvider(*spec)
+		if err != nil {
+			log.Fatalf("invalid scenario: %v", err)
+		}
+		log.Printf("[info] synthetic scenario %s enabled", scenarioPath)
+		return prov
+	}
+	if apiKey := os.Getenv("POLYGON_API_KEY"); apiKey != "" {
+		log.Printf("[info] polygon provider enabled")
+		return data.NewMassiveDataProvider(apiKey)
+	}
+	log.Printf("[info] synthetic provider enabled")
+	return data.NewSyntheticProvider()
+}
+
+// runSweep runs a parameter sweep and writes its ranked results table.
+func runSweep(path string, prov data.Provider) {
+	spec, err := sweep.Load(path)
+	if err != nil {
+		log.Fatalf("invalid sweep: %v", err)
+	}
+
+	start := time.Now()
+	res, err := sweep.Run(spec, prov)
+	if err != nil {
+		log.Fatalf("sweep failed: %v", err)
+	}
+	if err := os.MkdirAll(spec.ReportDir, 0755); err != nil {
+		log.Printf("[warn] could not create output dir %s: %v", spec.ReportDir, err)
+	}
+	if err := report.WriteSweep(res, spec.ReportDir); err != nil {
+		log.Printf("[warn] could not write sweep results: %v", err)
+	}
+	log.Printf("[done] swept %d combinations in %v, results in %s", len(res.Rows), time.Since(start), spec.ReportDir)
+}
+
+// runWalkForward runs a walk-forward optimisation and writes its windows and
+// stitched out-of-sample results.
+func runWalkForward(path string, prov data.Provider) {
+	spec, err := sweep.LoadWalkForward(path)
+	if err != nil {
+		log.Fatalf("invalid walk-forward: %v", err)
+	}
+
+	start := time.Now()
+	res, err := sweep.RunWalkForward(spec, prov)
+	if err != nil {
+		log.Fatalf("walk-forward failed: %v", err)
+	}
+	if err := os.MkdirAll(spec.ReportDir, 0755); err != nil {
+		log.Printf("[warn] could not create output dir %s: %v", spec.ReportDir, err)
+	}
+	if err := report.WriteWalkForward(res, spec.ReportDir); err != nil {
+		log.Printf("[warn] could not write walk-forward results: %v", err)
+	}
+	log.Printf("[done] walk-forward of %d windows in %v, out-of-sample net pnl=%.2f efficiency=%.1f%%, results in %s",
+		len(res.Windows), time.Since(start), res.Summary.NetPnL, res.Efficiency, spec.ReportDir)
+}
+
+// runStress reprices a position under the scenarios of a stress spec and
+// writes the P&L grids.
+func runStress(path string, prov data.Provider) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("reading stress spec: %v", err)
+	}
+	var spec engine.StressSpec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		log.Fatalf("invalid stress spec: %v", err)
+	}
+
+	res, err := engine.Stress(&spec, prov)
+	if err != nil {
+		log.Fatalf("stress failed: %v", err)
+	}
+	if err := os.MkdirAll(spec.ReportDir, 0755); err != nil {
+		log.Printf("[warn] could not create output dir %s: %v", spec.ReportDir, err)
+	}
+	if err := report.WriteStress(res, spec.ReportDir); err != nil {
+		log.Printf("[warn] could not write stress results: %v", err)
+	}
+	log.Printf("[done] stressed %d legs over %d grids and %d episodes, results in %s", len(res.Legs), len(res.Grids), len(res.Historical), spec.ReportDir)
+}
@@ -0,0 +1,321 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+const (
+	AdjustRoll      = "roll"       // close legs and reopen them at a new expiry and/or strike
+	AdjustAddLeg    = "add_leg"    // open an additional hedge leg
+	AdjustCloseLegs = "close_legs" // close legs, e.g. one side of a strangle
+)
+
+// AdjustmentSpec describes an action taken on an open position when a
+// condition holds.
+//
+// The condition is any registered exit rule (including "any" and "all");
+// instead of closing the trade, the action is applied to it. Legs are
+// selected by 1-based index and/or option type; with neither set, every
+// live leg is selected. A rolled leg keeps its index, close_legs moves the
+// legs after a closed one up and add_leg appends. The condition sees only
+// the selected legs and their greeks, so a leg-based condition such as
+// days_to_expiry fires for the legs it acts on; P&L conditions still judge
+// the premium of the whole trade.
+//
+// Example: roll the short call out to 30 DTE at 0.30 delta once it has 5
+// days left: {"when": {"name": "days_to_expiry", "params": {"days": 5}},
+// "action": "roll", "option_type": "call", "dte": 30, "strike_rule": "DELTA:0.30"}
+type AdjustmentSpec struct {
+	When       ExitRuleSpec `json:"when"`                  // condition that fires the action
+	Action     string       `json:"action"`                // "roll", "add_leg" or "close_legs"
+	Legs       []int        `json:"legs,omitempty"`        // 1-based indices into the live legs
+	OptionType string       `json:"option_type,omitempty"` // select legs of this type, "call" or "put"
+	DTE        int          `json:"dte,omitempty"`         // roll: days to the new expiry, default: the leg's strategy DTE
+	StrikeRule string       `json:"strike_rule,omitempty"` // roll: new strike rule, default: keep the strike
+	Leg        *st.LegSpec  `json:"leg,omitempty"`         // add_leg: leg to add, per strategy unit
+	MaxTimes   int          `json:"max_times,omitempty"`   // max firings per trade, 0 = unlimited
+}
+
+// Adjustment is a dated record of an action applied to an open trade.
+type Adjustment struct {
+	Date       time.Time     // bar date the action was applied
+	Action     string        // "roll", "add_leg" or "close_legs"
+	Reason     string        // reason returned by the condition
+	Underlying float64       // underlying price on the bar
+	Closed     []st.TradeLeg // legs closed, with their close premium
+	Opened     []st.TradeLeg // legs opened, with their open premium
+	Premium    float64       // value of the closed legs less value of the opened legs
+	Costs      Costs         // transaction costs of the adjustment order
+
+	rule int // index of the AdjustmentSpec that fired
+}
+
+// adjuster is an AdjustmentSpec with its condition built.
+type adjuster struct {
+	spec AdjustmentSpec
+	when ExitRule
+}
+
+// adjusters builds the configured adjustments.
+func (cfg *Config) adjusters() ([]adjuster, error) {
+	out := make([]adjuster, 0, len(cfg.Adjustments))
+	for i, spec := range cfg.Adjustments {
+		switch strings.ToLower(spec.Action) {
+		case AdjustRoll, AdjustCloseLegs:
+		case AdjustAddLeg:
+			if spec.Leg == nil {
+				return nil, fmt.Errorf("adjustments[%d]: add_leg needs a leg", i)
+			}
+		default:
+			return nil, fmt.Errorf("adjustments[%d]: unknown action %q", i, spec.Action)
+		}
+		when, err := NewExitRule(spec.When)
+		if err != nil {
+			return nil, fmt.Errorf("adjustments[%d]: %w", i, err)
+		}
+		out = append(out, adjuster{spec: spec, when: when})
+	}
+	return out, nil
+}
+
+// selects reports whether the adjustment applies to the i-th live leg.
+func (s AdjustmentSpec) selects(i int, leg st.TradeLeg) bool {
+	if leg.Hedge {
+		return false // the hedge is managed by HedgeSpec
+	}
+	if s.OptionType != "" && !strings.EqualFold(s.OptionType, leg.Spec.OptionType) {
+		return false
+	}
+	if len(s.Legs) == 0 {
+		return true
+	}
+	for _, n := range s.Legs {
+		if n == i+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// adjustTrade applies the first configured adjustment whose condition holds
+// on the bar. ctx carries the trade marked on the bar.
+//
+// Closed legs settle at their exit fill (or intrinsic value once expired)
+// and move to Trade.ClosedLegs; new legs open at their entry fill. The net
+// value is added to Trade.AdjustmentPremium so that the trade's P&L chains
+// across adjustments as one campaign.
+//
+// Returns true if an adjustment was applied.
+func (e *Engine) adjustTrade(tr *Trade, b data.Bar, ctx ExitContext) bool {
+	for i, a := range e.adjusters {
+		if a.spec.MaxTimes > 0 && tr.adjustCount(i) >= a.spec.MaxTimes {
+			continue
+		}
+		cond, ok := e.adjustContext(tr, b, ctx, a.spec)
+		if !ok {
+			continue
+		}
+		d := a.when.Check(cond)
+		if !d.Exit {
+			continue
+		}
+		adj, err := e.applyAdjustment(tr, b, a.spec)
+		if err != nil {
+			logger.Debugf("trade %d adjustment %s on %s skipped: %v", tr.ID, a.spec.Action, b.Date.Format("2006-01-02"), err)
+			continue
+		}
+		adj.Reason, adj.rule = d.Reason, i
+		tr.Adjustments = append(tr.Adjustments, adj)
+		logger.Infof("trade %d adjusted %s on %s reason=%s premium=%.2f costs=%.2f",
+			tr.ID,
+			adj.Action,
+			b.Date.Format("2006-01-02"),
+			adj.Reason,
+			adj.Premium,
+			adj.Costs.Total(),
+		)
+		return true
+	}
+	return false
+}
+
+// adjustContext returns the context an adjustment's condition is checked
+// in: the trade narrowed to the legs the adjustment selects, with their
+// marks and greeks, and the premium, IV and IV rank of the whole trade. It
+// reports false if no live leg is selected. add_leg selects nothing and sees
+// the whole trade.
+func (e *Engine) adjustContext(tr *Trade, b data.Bar, ctx ExitContext, spec AdjustmentSpec) (ExitContext, bool) {
+	if strings.ToLower(spec.Action) == AdjustAddLeg {
+		return ctx, true
+	}
+	view := *tr
+	view.Legs, view.legPrices = nil, nil
+	for i, leg := range tr.Legs {
+		if spec.selects(i, leg) && !e.legExpired(leg, b.Date) && i < len(tr.legPrices) {
+			view.Legs = append(view.Legs, leg)
+			view.legPrices = append(view.legPrices, tr.legPrices[i])
+		}
+	}
+	if len(view.Legs) == 0 {
+		return ctx, false
+	}
+	if len(view.Legs) == len(tr.Legs) {
+		return ctx, true
+	}
+	g := e.positionGreeks(&view, b)
+	g.IV, g.IVRank = ctx.Greeks.IV, ctx.Greeks.IVRank
+	return ExitContext{Trade: &view, Premium: ctx.Premium, Bar: b, Greeks: g}, true
+}
+
+// applyAdjustment closes and opens the legs of one adjustment action.
+func (e *Engine) applyAdjustment(tr *Trade, b data.Bar, spec AdjustmentSpec) (Adjustment, error) {
+	cfg := e.cfg
+	action := strings.ToLower(spec.Action)
+	adj := Adjustment{Date: b.Date, Action: action, Underlying: b.Close}
+
+	var (
+		keep       []st.TradeLeg
+		keepMarks  []legMark
+		closed     []st.TradeLeg
+		closeMarks []legMark
+		slots      []int // index in tr.Legs of each closed leg
+	)
+	if action == AdjustAddLeg {
+		keep, keepMarks = tr.Legs, tr.legPrices
+	} else {
+		for i, leg := range tr.Legs {
+			// stock has nothing to roll into
+			if spec.selects(i, leg) && !(action == AdjustRoll && leg.Spec.IsStock()) {
+				closed = append(closed, leg)
+				closeMarks = append(closeMarks, tr.legPrices[i])
+				slots = append(slots, i)
+			} else {
+				keep = append(keep, leg)
+				keepMarks = append(keepMarks, tr.legPrices[i])
+			}
+		}
+		if len(closed) == 0 {
+			return adj, fmt.Errorf("no legs selected")
+		}
+	}
+
+	// resolve the legs to open
+	var (
+		opened    []st.TradeLeg
+		openMarks []legMark
+	)
+	openLeg := func(ls st.LegSpec, expiry time.Time, rule string, strike float64) error {
+		if expiry.IsZero() && !ls.IsStock() {
+			return fmt.Errorf("no expiry matched for %s leg", ls.OptionType)
+		}
+		if rule != "" && !ls.IsStock() {
+			k, err := st.ResolveStrike(rule, cfg.Underlying, b.Close, b.Date, expiry, append(keep, opened...), e.prov, e.registry())
+			if err != nil {
+				return fmt.Errorf("resolve strike %s: %w", rule, err)
+			}
+			strike = k
+			ls.StrikeRule = rule
+		}
+		leg := st.TradeLeg{Spec: ls, Strike: strike, Expiration: expiry}
+		if e.legExpired(leg, b.Date) {
+			return fmt.Errorf("new %s leg K=%.2f already expired on %s", ls.OptionType, strike, b.Date.Format("2006-01-02"))
+		}
+		m, q := e.priceLeg(leg, b.Close, b.Date)
+		if cfg.Fills.UseQuotes && !ls.IsStock() {
+			if err := cfg.Fills.checkLiquidity(q); err != nil {
+				return fmt.Errorf("liquidity check failed K=%.2f: %w", strike, err)
+			}
+		}
+		leg.OpenPremium = cfg.Fills.fillPrice(m, legSign(leg) > 0)
+		opened = append(opened, leg)
+		openMarks = append(openMarks, m)
+		return nil
+	}
+
+	switch action {
+	case AdjustRoll:
+		for _, leg := range closed {
+			dte := spec.DTE
+			if dte <= 0 {
+				dte = cfg.Strategy.DaysToExpiry
+				if leg.Spec.Expiration != 0 {
+					dte = leg.Spec.Expiration
+				}
+			}
+			expiry := st.ResolveExpiration(b.Date, dte, e.expiries, cfg.Strategy.DateMatchType)
+			if err := openLeg(leg.Spec, expiry, spec.StrikeRule, leg.Strike); err != nil {
+				return adj, err
+			}
+		}
+	case AdjustAddLeg:
+		ls := *spec.Leg
+		if ls.Qty <= 0 {
+			ls.Qty = 1
+		}
+		dte := cfg.Strategy.DaysToExpiry
+		if ls.Expiration != 0 {
+			dte = ls.Expiration
+		}
+		expiry := st.ResolveExpiration(b.Date, dte, e.expiries, cfg.Strategy.DateMatchType)
+		if err := openLeg(ls, expiry, ls.StrikeRule, 0); err != nil {
+			return adj, err
+		}
+	}
+
+	e.stampMultiplier(opened)
+
+	// settle the closed legs, one order for everything that trades
+	expired := func(leg st.TradeLeg) bool { return e.legExpired(leg, b.Date) }
+	units := float64(tr.Contracts)
+	for i, leg := range closed {
+		p := closeMarks[i].Price
+		if !expired(leg) {
+			p = cfg.Fills.fillPrice(closeMarks[i], legSign(leg) < 0)
+		}
+		closed[i].ClosePremium = p
+		adj.Premium += legSign(leg) * p * float64(leg.Spec.Qty) * units * legMultiplier(leg)
+	}
+	for _, leg := range opened {
+		adj.Premium -= legSign(leg) * leg.OpenPremium * float64(leg.Spec.Qty) * units * legMultiplier(leg)
+	}
+	fills := append(
+		legFills(closed, closeMarks, tr.Contracts, false, expired),
+		legFills(opened, openMarks, tr.Contracts, true, nil)...,
+	)
+	fills = append(fills, e.deliveryFills(closed, tr.Contracts, b)...)
+	adj.Costs = cfg.costModel().OrderCost(fills)
+	adj.Closed, adj.Opened = closed, opened
+
+	if action == AdjustRoll {
+		// a rolled leg takes the slot of the leg it replaces, so that leg
+		// indices select the same position on the next firing
+		for j, i := range slots {
+			tr.Legs[i] = opened[j]
+			tr.legPrices[i] = openMarks[j]
+		}
+	} else {
+		tr.Legs = append(keep, opened...)
+		tr.legPrices = append(keepMarks, openMarks...)
+	}
+	tr.ClosedLegs = append(tr.ClosedLegs, closed...)
+	tr.AdjustmentPremium += adj.Premium
+	tr.AdjustmentCosts = tr.AdjustmentCosts.Add(adj.Costs)
+	return adj, nil
+}
+
+// adjustCount returns how many times the rule-th adjustment fired on a trade.
+func (tr *Trade) adjustCount(rule int) int {
+	n := 0
+	for _, a := range tr.Adjustments {
+		if a.rule == rule {
+			n++
+		}
+	}
+	return n
+}
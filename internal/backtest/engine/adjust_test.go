@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestAdjustTrade(t *testing.T) {
+	day := time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)
+	var fridays []time.Time
+	for d := day; d.Before(day.AddDate(0, 3, 0)); d = d.AddDate(0, 0, 7) {
+		fridays = append(fridays, d)
+	}
+
+	cfg := &Config{
+		Strategy: st.StrategySpec{DaysToExpiry: 28},
+		Adjustments: []AdjustmentSpec{
+			{
+				// close the tested call side of the strangle
+				When:       ExitRuleSpec{Name: "short_delta", Params: json.RawMessage(`{"max": 0.45}`)},
+				Action:     AdjustCloseLegs,
+				OptionType: "call",
+			},
+			{
+				// roll what is left out in time near expiry, once
+				When:     ExitRuleSpec{Name: "days_to_expiry", Params: json.RawMessage(`{"days": 7}`)},
+				Action:   AdjustRoll,
+				MaxTimes: 1,
+			},
+		},
+	}
+	adjusters, err := cfg.adjusters()
+	if err != nil {
+		t.Fatalf("build adjusters: %v", err)
+	}
+	e := &Engine{cfg: cfg, prov: data.NewSyntheticProvider(), hv: 0.25, expiries: fridays, adjusters: adjusters}
+
+	exp := day.AddDate(0, 0, 28)
+	legs := []st.TradeLeg{
+		{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 95, Expiration: exp},
+		{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 105, Expiration: exp},
+	}
+	open := data.Bar{Date: day, Close: 100}
+	tr := &Trade{ID: 1, OpenDateTime: day, UnderlyingAtOpen: 100, Legs: legs, Contracts: 2}
+	tr.OpenPremium, tr.legPrices = e.markTrade(tr, open)
+	for i := range tr.Legs {
+		tr.Legs[i].OpenPremium = tr.legPrices[i].Price
+	}
+	tr.mark, tr.HighPremium, tr.LowPremium = tr.OpenPremium, tr.OpenPremium, tr.OpenPremium
+
+	// rally: the call is closed, the put stays on
+	rally := data.Bar{Date: day.AddDate(0, 0, 7), Close: 105}
+	before, _ := e.markTrade(tr, rally)
+	if e.updateTrade(tr, rally) {
+		t.Fatalf("trade unexpectedly closed by %s", tr.ClosedBy)
+	}
+	if len(tr.Adjustments) != 1 || tr.Adjustments[0].Action != AdjustCloseLegs {
+		t.Fatalf("expected close_legs adjustment, got %+v", tr.Adjustments)
+	}
+	if len(tr.Legs) != 1 || tr.Legs[0].Spec.OptionType != "put" || len(tr.ClosedLegs) != 1 {
+		t.Fatalf("expected only the put live, got legs=%+v closed=%+v", tr.Legs, tr.ClosedLegs)
+	}
+	// without spread or costs the campaign mark is unchanged by the adjustment
+	if math.Abs(tr.mark-before) > 1e-9 {
+		t.Fatalf("expected campaign mark %.4f, got %.4f", before, tr.mark)
+	}
+
+	// near expiry the put is rolled to the expiry 28 days out, keeping its strike
+	late := data.Bar{Date: day.AddDate(0, 0, 21), Close: 104}
+	if e.updateTrade(tr, late) {
+		t.Fatalf("trade unexpectedly closed by %s", tr.ClosedBy)
+	}
+	if len(tr.Adjustments) != 2 || tr.Adjustments[1].Action != AdjustRoll {
+		t.Fatalf("expected roll adjustment, got %+v", tr.Adjustments)
+	}
+	if want := late.Date.AddDate(0, 0, 28); !tr.Legs[0].Expiration.Equal(want) || tr.Legs[0].Strike != 95 {
+		t.Fatalf("expected put rolled to K=95 exp=%s, got %+v", want.Format("2006-01-02"), tr.Legs[0])
+	}
+
+	// P&L chains across the campaign: every leg's open-to-close value change
+	e.closeTrade(tr, data.Bar{Date: day.AddDate(0, 0, 30), Close: 101}, mustMarks(e, tr, 101, day.AddDate(0, 0, 30)), "test")
+	sum := 0.0
+	for _, leg := range append(tr.ClosedLegs, tr.Legs...) {
+		sum += legSign(leg) * (leg.ClosePremium - leg.OpenPremium) * float64(leg.Spec.Qty) * 2 * 100.0
+	}
+	if math.Abs(tr.GrossPnL-sum) > 1e-6 {
+		t.Fatalf("expected campaign gross P&L %.4f, got %.4f", sum, tr.GrossPnL)
+	}
+}
+
+func TestAdjustSelectedLegsOnly(t *testing.T) {
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	cfg := &Config{
+		Adjustments: []AdjustmentSpec{{
+			// the documented example: roll the call at 5 days left
+			When:       ExitRuleSpec{Name: "days_to_expiry", Params: json.RawMessage(`{"days": 5}`)},
+			Action:     AdjustRoll,
+			OptionType: "call",
+			DTE:        30,
+		}},
+	}
+	adjusters, err := cfg.adjusters()
+	if err != nil {
+		t.Fatalf("build adjusters: %v", err)
+	}
+	var expiries []time.Time
+	for d := day; d.Before(day.AddDate(0, 3, 0)); d = d.AddDate(0, 0, 1) {
+		expiries = append(expiries, d)
+	}
+	e := &Engine{cfg: cfg, prov: data.NewSyntheticProvider(), hv: 0.25, expiries: expiries, adjusters: adjusters}
+
+	// a strangle whose put expires well before its call
+	legs := []st.TradeLeg{
+		{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 95, Expiration: day.AddDate(0, 0, 4)},
+		{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 105, Expiration: day.AddDate(0, 0, 25)},
+	}
+	tr := &Trade{ID: 1, OpenDateTime: day, UnderlyingAtOpen: 100, Legs: legs, Contracts: 1}
+	tr.OpenPremium, tr.legPrices = e.markTrade(tr, data.Bar{Date: day, Close: 100})
+	tr.mark, tr.HighPremium, tr.LowPremium = tr.OpenPremium, tr.OpenPremium, tr.OpenPremium
+
+	for d := 1; d <= 24; d++ {
+		if b := (data.Bar{Date: day.AddDate(0, 0, d), Close: 100}); e.updateTrade(tr, b) {
+			t.Fatalf("trade unexpectedly closed by %s on day %d", tr.ClosedBy, d)
+		}
+		if d < 20 && len(tr.Adjustments) != 0 {
+			t.Fatalf("expected no roll while only the put is near expiry, got %+v on day %d", tr.Adjustments, d)
+		}
+	}
+	// the call is rolled once, at 5 days left, and not again
+	if len(tr.Adjustments) != 1 || !tr.Adjustments[0].Date.Equal(day.AddDate(0, 0, 20)) {
+		t.Fatalf("expected one roll on day 20, got %+v", tr.Adjustments)
+	}
+	if c := tr.Adjustments[0].Closed; len(c) != 1 || c[0].Spec.OptionType != "call" {
+		t.Fatalf("expected only the call rolled, got %+v", c)
+	}
+}
+
+func TestAdjustRollKeepsLegIndex(t *testing.T) {
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	cfg := &Config{
+		Adjustments: []AdjustmentSpec{{
+			// roll the first leg at 5 days left, every time
+			When:   ExitRuleSpec{Name: "days_to_expiry", Params: json.RawMessage(`{"days": 5}`)},
+			Action: AdjustRoll,
+			Legs:   []int{1},
+			DTE:    10,
+		}},
+	}
+	adjusters, err := cfg.adjusters()
+	if err != nil {
+		t.Fatalf("build adjusters: %v", err)
+	}
+	var expiries []time.Time
+	for d := day; d.Before(day.AddDate(0, 3, 0)); d = d.AddDate(0, 0, 1) {
+		expiries = append(expiries, d)
+	}
+	e := &Engine{cfg: cfg, prov: data.NewSyntheticProvider(), hv: 0.25, expiries: expiries, adjusters: adjusters}
+
+	legs := []st.TradeLeg{
+		{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 95, Expiration: day.AddDate(0, 0, 10)},
+		{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 105, Expiration: day.AddDate(0, 0, 30)},
+	}
+	tr := &Trade{ID: 1, OpenDateTime: day, UnderlyingAtOpen: 100, Legs: legs, Contracts: 1}
+	tr.OpenPremium, tr.legPrices = e.markTrade(tr, data.Bar{Date: day, Close: 100})
+	tr.mark, tr.HighPremium, tr.LowPremium = tr.OpenPremium, tr.OpenPremium, tr.OpenPremium
+
+	for d := 1; d <= 12; d++ {
+		if b := (data.Bar{Date: day.AddDate(0, 0, d), Close: 100}); e.updateTrade(tr, b) {
+			t.Fatalf("trade unexpectedly closed by %s on day %d", tr.ClosedBy, d)
+		}
+	}
+	// rolled on day 5 to day 15 and on day 10 to day 20, the call untouched
+	if len(tr.Adjustments) != 2 {
+		t.Fatalf("expected two rolls, got %+v", tr.Adjustments)
+	}
+	for _, a := range tr.Adjustments {
+		if len(a.Closed) != 1 || a.Closed[0].Spec.OptionType != "put" {
+			t.Fatalf("expected the put rolled each time, got %+v on %s", a.Closed, a.Date.Format("2006-01-02"))
+		}
+	}
+	if tr.Legs[0].Spec.OptionType != "put" || !tr.Legs[0].Expiration.Equal(day.AddDate(0, 0, 20)) || tr.Legs[1].Strike != 105 {
+		t.Fatalf("expected the rolled put first and the call second, got %+v", tr.Legs)
+	}
+}
+
+func mustMarks(e *Engine, tr *Trade, spot float64, at time.Time) []legMark {
+	_, marks := e.markTrade(tr, data.Bar{Date: at, Close: spot})
+	return marks
+}
+
+func TestAdjustersValidation(t *testing.T) {
+	when := ExitRuleSpec{Name: "max_days", Params: json.RawMessage(`{"days": 3}`)}
+	if _, err := (&Config{Adjustments: []AdjustmentSpec{{When: when, Action: "hedge"}}}).adjusters(); err == nil {
+		t.Fatalf("expected error for unknown action")
+	}
+	if _, err := (&Config{Adjustments: []AdjustmentSpec{{When: when, Action: AdjustAddLeg}}}).adjusters(); err == nil {
+		t.Fatalf("expected error for add_leg without a leg")
+	}
+}
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+const (
+	AssignOff   = "off"   // short legs are held until exit or expiry (default)
+	AssignStock = "stock" // an assigned short leg becomes shares of the underlying
+	AssignClose = "close" // an assignment closes the trade with reason "assigned"
+
+	AdjustAssigned = "assigned" // Adjustment.Action of a short leg converted into shares
+)
+
+// Dividend is a cash dividend of the underlying.
+type Dividend = data.Dividend
+
+// AssignmentSpec models early exercise of short American options, checked
+// on every bar close of an open trade.
+//
+// A short in-the-money put is assigned once its extrinsic value (mark less
+// intrinsic value) is at most ExtrinsicMax. A short in-the-money call is
+// assigned on the last weekday before an ex-dividend date when its extrinsic
+// value is below the dividend. Depending on Mode the assigned leg becomes a
+// stock position, bought (put) or sold (call) at the strike, or the trade is
+// closed with ClosedBy "assigned". A trade left holding only shares stays
+// open until an exit rule fires or the data ends.
+//
+// Dividends default to the provider's (see Provider.GetDividends), the same
+// ones options are priced with.
+//
+// European-style options (see data.Product.ExerciseStyle) are never
+// assigned early.
+//
+// Pin risk is reported independently of Mode: with PinPct set, every short
+// option leg expiring with the underlying within PinPct of its strike is
+// recorded on Trade.PinRisks.
+type AssignmentSpec struct {
+	Mode         string     `json:"mode,omitempty"`          // "off", "stock" or "close", default: "off"
+	ExtrinsicMax float64    `json:"extrinsic_max,omitempty"` // put assignment threshold per share, default: 0.05
+	Dividends    []Dividend `json:"dividends,omitempty"`     // ex-dividend dates for early call exercise and pricing, default: the provider's
+	PinPct       float64    `json:"pin_pct,omitempty"`       // pin risk distance to the strike at expiry, e.g. 1.0 for 1%, 0 = off
+}
+
+// PinRisk records a short leg expiring near the money.
+type PinRisk struct {
+	Date        time.Time   // bar date the leg expired on
+	Leg         st.TradeLeg // expiring short leg
+	Underlying  float64     // underlying settlement price
+	DistancePct float64     // |underlying - strike| as a percent of the strike
+}
+
+// enabled reports whether an assignment mode is configured.
+func (a AssignmentSpec) enabled() bool {
+	m := strings.ToLower(a.Mode)
+	return m != "" && m != AssignOff
+}
+
+func (a AssignmentSpec) validate() error {
+	switch strings.ToLower(a.Mode) {
+	case "", AssignOff, AssignStock, AssignClose:
+	default:
+		return fmt.Errorf("unknown assignment mode %q", a.Mode)
+	}
+	if a.ExtrinsicMax < 0 || a.PinPct < 0 {
+		return fmt.Errorf("assignment extrinsic_max and pin_pct must not be negative")
+	}
+	return nil
+}
+
+// extrinsicMax returns the put assignment threshold.
+func (a AssignmentSpec) extrinsicMax() float64 {
+	if a.ExtrinsicMax > 0 {
+		return a.ExtrinsicMax
+	}
+	return 0.05
+}
+
+// dividendAhead returns the dividend going ex on the next weekday after d,
+// or 0 if there is none.
+func (a AssignmentSpec) dividendAhead(d time.Time) float64 {
+	day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+	next := day.AddDate(0, 0, 1)
+	for next.Weekday() == time.Saturday || next.Weekday() == time.Sunday {
+		next = next.AddDate(0, 0, 1)
+	}
+	for _, div := range a.Dividends {
+		ex := time.Date(div.ExDate.Year(), div.ExDate.Month(), div.ExDate.Day(), 0, 0, 0, 0, time.UTC)
+		if ex.After(day) && !ex.After(next) {
+			return div.Amount
+		}
+	}
+	return 0
+}
+
+// assignedLeg returns the index of the first short leg assigned on a bar and
+// the reason, or -1 if none is. Legs are judged on their latest marks.
+func (e *Engine) assignedLeg(tr *Trade, b data.Bar) (int, string) {
+	a := e.cfg.Assignment
+	if len(a.Dividends) == 0 {
+		a.Dividends = e.dividends
+	}
+	if e.product().ExerciseStyle == data.ExerciseEuropean {
+		return -1, ""
+	}
+	for i, leg := range tr.Legs {
+		if leg.Spec.IsStock() || legSign(leg) > 0 || e.legExpired(leg, b.Date) || i >= len(tr.legPrices) {
+			continue
+		}
+		intr := intrinsic(leg, b.Close)
+		if intr <= 0 {
+			continue
+		}
+		extrinsic := tr.legPrices[i].Price - intr
+		if strings.ToLower(leg.Spec.OptionType) == "call" {
+			if div := a.dividendAhead(b.Date); div > 0 && extrinsic < div {
+				return i, "ex_dividend_call"
+			}
+			continue
+		}
+		if extrinsic <= a.extrinsicMax() {
+			return i, "early_assignment_put"
+		}
+	}
+	return -1, ""
+}
+
+// assignTrade applies early assignment to a trade marked on a bar.
+//
+// In "stock" mode the assigned leg settles at intrinsic value and is
+// replaced, in place, by the shares delivered: Qty × 100 per unit, opened at
+// the bar close, which together with the intrinsic value is the strike. The
+// exchange is recorded as an Adjustment with Action "assigned" and chains
+// into the P&L like any adjustment. In "close" mode the whole trade closes
+// with the assigned leg at intrinsic value.
+//
+// Returns whether a leg was assigned and whether the trade was closed.
+func (e *Engine) assignTrade(tr *Trade, b data.Bar) (assigned, closed bool) {
+	i, reason := e.assignedLeg(tr, b)
+	if i < 0 {
+		return false, false
+	}
+	leg := tr.Legs[i]
+	intr := intrinsic(leg, b.Close)
+	logger.Infof("trade %d %s leg K=%.2f assigned on %s underlying=%.2f reason=%s",
+		tr.ID,
+		leg.Spec.OptionType,
+		leg.Strike,
+		b.Date.Format("2006-01-02"),
+		b.Close,
+		reason,
+	)
+
+	if strings.ToLower(e.cfg.Assignment.Mode) == AssignClose {
+		prices := append([]legMark(nil), tr.legPrices...)
+		prices[i] = legMark{Price: intr}
+		e.closeTrade(tr, b, prices, "assigned")
+		return true, true
+	}
+
+	side := "buy"
+	if strings.ToLower(leg.Spec.OptionType) == "call" {
+		side = "sell"
+	}
+	shares := st.TradeLeg{
+		Spec:        st.LegSpec{Side: side, OptionType: st.LegStock, Qty: leg.Spec.Qty * int(legMultiplier(leg))},
+		OpenPremium: b.Close,
+	}
+	leg.ClosePremium = intr
+
+	units := float64(tr.Contracts)
+	adj := Adjustment{
+		Date:       b.Date,
+		Action:     AdjustAssigned,
+		Reason:     reason,
+		Underlying: b.Close,
+		Closed:     []st.TradeLeg{leg},
+		Opened:     []st.TradeLeg{shares},
+		rule:       -1,
+	}
+	adj.Premium = legSign(leg)*intr*float64(leg.Spec.Qty)*units*legMultiplier(leg) -
+		legSign(shares)*b.Close*float64(shares.Spec.Qty)*units
+	adj.Costs = e.cfg.costModel().OrderCost([]Fill{{
+		Leg:     shares,
+		Qty:     shares.Spec.Qty * tr.Contracts,
+		Price:   b.Close,
+		Opening: true,
+	}})
+
+	tr.Legs[i] = shares
+	tr.legPrices[i] = legMark{Price: b.Close}
+	tr.ClosedLegs = append(tr.ClosedLegs, leg)
+	tr.Adjustments = append(tr.Adjustments, adj)
+	tr.AdjustmentPremium += adj.Premium
+	tr.AdjustmentCosts = tr.AdjustmentCosts.Add(adj.Costs)
+	return true, false
+}
+
+// checkPin records pin risk for the short legs of every expiration reached
+// on a bar. Each expiration is judged once, on the first bar it is reached.
+func (e *Engine) checkPin(tr *Trade, b data.Bar) {
+	pct := e.cfg.Assignment.PinPct
+	if pct <= 0 {
+		return
+	}
+	var reached []time.Time
+	for _, leg := range tr.Legs {
+		if leg.Spec.IsStock() || tr.pinChecked[leg.Expiration] || !e.legExpired(leg, b.Date) {
+			continue
+		}
+		reached = append(reached, leg.Expiration)
+		if legSign(leg) > 0 || leg.Strike <= 0 {
+			continue
+		}
+		px := e.settlementPrice(leg, b)
+		dist := math.Abs(px-leg.Strike) / leg.Strike * 100.0
+		if dist <= pct {
+			tr.PinRisks = append(tr.PinRisks, PinRisk{Date: b.Date, Leg: leg, Underlying: px, DistancePct: dist})
+			logger.Infof("trade %d pin risk %s K=%.2f expiring %s underlying=%.2f",
+				tr.ID,
+				leg.Spec.OptionType,
+				leg.Strike,
+				b.Date.Format("2006-01-02"),
+				px,
+			)
+		}
+	}
+	if len(reached) > 0 && tr.pinChecked == nil {
+		tr.pinChecked = make(map[time.Time]bool)
+	}
+	for _, exp := range reached {
+		tr.pinChecked[exp] = true
+	}
+}
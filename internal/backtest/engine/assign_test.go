@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestAssignTrade(t *testing.T) {
+	fri := time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)
+	exp := fri.AddDate(0, 0, 14)
+	newTrade := func() *Trade {
+		return &Trade{
+			ID:        1,
+			Contracts: 2,
+			Legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 100, Expiration: exp},
+				{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 90, Expiration: exp},
+			},
+		}
+	}
+
+	// deep ITM put with 2 cents of extrinsic is assigned, delivering shares at the strike
+	e := &Engine{cfg: &Config{Assignment: AssignmentSpec{Mode: AssignStock}}}
+	tr := newTrade()
+	b := data.Bar{Date: fri, Close: 80}
+	tr.legPrices = []legMark{{Price: 20.02}, {Price: 0}}
+	if assigned, closed := e.assignTrade(tr, b); !assigned || closed {
+		t.Fatalf("expected put assignment, got assigned=%v closed=%v", assigned, closed)
+	}
+	if leg := tr.Legs[0]; !leg.Spec.IsStock() || leg.Spec.Side != "buy" || leg.Spec.Qty != 100 {
+		t.Fatalf("expected 100 long shares per unit, got %+v", leg)
+	}
+	if len(tr.Adjustments) != 1 || tr.Adjustments[0].Reason != "early_assignment_put" {
+		t.Fatalf("expected assignment record, got %+v", tr.Adjustments)
+	}
+	if want := -100.0 * 100 * 2; math.Abs(tr.AdjustmentPremium-want) > 1e-9 {
+		t.Fatalf("expected shares bought at the strike (%.2f), got %.2f", want, tr.AdjustmentPremium)
+	}
+
+	// plenty of extrinsic left: held
+	tr = newTrade()
+	tr.legPrices = []legMark{{Price: 21}, {Price: 0}}
+	if assigned, _ := e.assignTrade(tr, b); assigned {
+		t.Fatalf("expected no assignment with extrinsic above threshold")
+	}
+
+	// ITM call ahead of a dividend larger than its extrinsic value
+	e.cfg.Assignment.Dividends = []Dividend{{ExDate: fri.AddDate(0, 0, 3), Amount: 0.50}}
+	b = data.Bar{Date: fri, Close: 100}
+	tr = newTrade()
+	tr.legPrices = []legMark{{Price: 2.5}, {Price: 10.3}}
+	if assigned, _ := e.assignTrade(tr, b); !assigned || tr.Legs[1].Spec.Side != "sell" {
+		t.Fatalf("expected call assignment into short shares, got %+v", tr.Legs)
+	}
+	tr = newTrade()
+	tr.legPrices = []legMark{{Price: 2.5}, {Price: 10.3}}
+	if assigned, _ := e.assignTrade(tr, data.Bar{Date: fri.AddDate(0, 0, -7), Close: 100}); assigned {
+		t.Fatalf("expected no call assignment a week before the ex-dividend date")
+	}
+
+	// close mode ends the trade
+	e = &Engine{cfg: &Config{Assignment: AssignmentSpec{Mode: AssignClose, ExtrinsicMax: 0.10}}}
+	tr = newTrade()
+	tr.legPrices = []legMark{{Price: 20.08, Spread: 0.4}, {Price: 0}}
+	if _, closed := e.assignTrade(tr, data.Bar{Date: fri, Close: 80}); !closed || tr.ClosedBy != "assigned" {
+		t.Fatalf("expected trade closed by assignment, got %q", tr.ClosedBy)
+	}
+	if tr.Legs[0].ClosePremium != 20 {
+		t.Fatalf("expected assigned leg at intrinsic 20, got %.2f", tr.Legs[0].ClosePremium)
+	}
+}
+
+func TestCheckPin(t *testing.T) {
+	day := time.Date(2025, 3, 21, 0, 0, 0, 0, time.UTC)
+	e := &Engine{cfg: &Config{Assignment: AssignmentSpec{PinPct: 1}}}
+	tr := &Trade{Legs: []st.TradeLeg{
+		{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 95, Expiration: day},
+		{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 105, Expiration: day},
+		{Spec: st.LegSpec{Side: "buy", OptionType: "call", Qty: 1}, Strike: 104, Expiration: day},
+	}}
+
+	e.checkPin(tr, data.Bar{Date: day.AddDate(0, 0, -1), Close: 104.8})
+	if len(tr.PinRisks) != 0 {
+		t.Fatalf("expected no pin risk before expiry, got %+v", tr.PinRisks)
+	}
+	e.checkPin(tr, data.Bar{Date: day, Close: 104.8})
+	if len(tr.PinRisks) != 1 || tr.PinRisks[0].Leg.Strike != 105 {
+		t.Fatalf("expected pin risk on the short 105 call, got %+v", tr.PinRisks)
+	}
+	// an expiration is judged once
+	e.checkPin(tr, data.Bar{Date: day.AddDate(0, 0, 1), Close: 95})
+	if len(tr.PinRisks) != 1 {
+		t.Fatalf("expected expiration checked once, got %+v", tr.PinRisks)
+	}
+}
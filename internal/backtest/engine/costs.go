@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"math"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+)
+
+// Fill describes one leg of an order sent to the market.
+type Fill struct {
+	Leg     st.TradeLeg // leg being filled
+	Qty     int         // contracts (shares for stock legs) filled: leg qty × strategy units
+	Price   float64     // per-share reference price (mid or model) before slippage
+	Spread  float64     // per-share bid-ask spread, 0 if unknown
+	Opening bool        // true when opening the position, false when closing
+}
+
+// Costs is the breakdown of transaction costs for an order.
+type Costs struct {
+	Commission float64 `json:"commission"` // broker commission incl. ticket fee
+	Fees       float64 `json:"fees"`       // exchange and regulatory fees
+	Slippage   float64 `json:"slippage"`   // price given up versus the reference price
+}
+
+// Total returns the sum of all cost components in dollars.
+func (c Costs) Total() float64 {
+	return c.Commission + c.Fees + c.Slippage
+}
+
+// Add returns the component-wise sum of two cost breakdowns.
+func (c Costs) Add(o Costs) Costs {
+	return Costs{
+		Commission: c.Commission + o.Commission,
+		Fees:       c.Fees + o.Fees,
+		Slippage:   c.Slippage + o.Slippage,
+	}
+}
+
+// CostModel computes the transaction costs of an order.
+//
+// An order is the set of leg fills executed together when a position is
+// opened or closed. Implementations must return non-negative costs in
+// dollars; the engine subtracts them from the gross P&L.
+type CostModel interface {
+	OrderCost(fills []Fill) Costs
+}
+
+// CostSpec is the default, config-driven CostModel.
+type CostSpec struct {
+	CommissionPerContract    float64 `json:"commission_per_contract,omitempty"`     // e.g. 0.65 per contract
+	CommissionPerShare       float64 `json:"commission_per_share,omitempty"`        // stock legs, e.g. 0.005 per share
+	TicketFee                float64 `json:"ticket_fee,omitempty"`                  // flat fee per order, e.g. 1.00
+	ExchangeFeePerContract   float64 `json:"exchange_fee_per_contract,omitempty"`   // exchange fee per contract
+	RegulatoryFeePerContract float64 `json:"regulatory_fee_per_contract,omitempty"` // ORF/OCC/TAF per contract
+	SlippageSpreadPct        float64 `json:"slippage_spread_pct,omitempty"`         // % of the bid-ask spread given up per fill, e.g. 50.0; not with fills.use_quotes
+	SlippageTicks            float64 `json:"slippage_ticks,omitempty"`              // fixed ticks given up per fill, e.g. 1
+	TickSize                 float64 `json:"tick_size,omitempty"`                   // price increment for slippage_ticks, default: 0.01
+	DefaultSpreadPct         float64 `json:"default_spread_pct,omitempty"`          // spread as % of price when no quote spread is known
+}
+
+// OrderCost implements CostModel.
+//
+// Commission and fees are charged per contract filled, plus one ticket fee
+// per order. Slippage is charged per share on every fill as a percent of the
+// spread (falling back to DefaultSpreadPct of the price when the spread is
+// unknown) plus a fixed number of ticks, and never exceeds the fill price.
+// Stock fills pay CommissionPerShare instead, no per-contract fees, and
+// slippage on their known spread and ticks only.
+func (c CostSpec) OrderCost(fills []Fill) Costs {
+	out := Costs{}
+	if len(fills) == 0 {
+		return out
+	}
+
+	tick := c.TickSize
+	if tick <= 0 {
+		tick = 0.01
+	}
+
+	out.Commission = c.TicketFee
+	for _, f := range fills {
+		qty := float64(f.Qty)
+		stock := f.Leg.Spec.IsStock()
+		if stock {
+			out.Commission += c.CommissionPerShare * qty
+		} else {
+			out.Commission += c.CommissionPerContract * qty
+			out.Fees += (c.ExchangeFeePerContract + c.RegulatoryFeePerContract) * qty
+		}
+
+		spread := f.Spread
+		if spread <= 0 && !stock {
+			spread = f.Price * c.DefaultSpreadPct / 100.0
+		}
+		slip := spread*c.SlippageSpreadPct/100.0 + c.SlippageTicks*tick
+		slip = math.Min(slip, f.Price)
+		out.Slippage += slip * qty * legMultiplier(f.Leg)
+	}
+	return out
+}
+
+// costModel returns the configured cost model, defaulting to the CostSpec.
+func (cfg *Config) costModel() CostModel {
+	if cfg.CostModel != nil {
+		return cfg.CostModel
+	}
+	return cfg.Costs
+}
+
+// legFills builds one fill per leg for an order on a position.
+//
+// Parameters:
+//   - legs: trade legs
+//   - prices: per-share valuation of each leg, aligned with legs
+//   - units: strategy units (Trade.Contracts)
+//   - opening: true at open, false at close
+//   - skip: optional filter; legs for which it returns true are not filled
+func legFills(legs []st.TradeLeg, prices []legMark, units int, opening bool, skip func(st.TradeLeg) bool) []Fill {
+	fills := make([]Fill, 0, len(legs))
+	for i, leg := range legs {
+		if skip != nil && skip(leg) {
+			continue
+		}
+		fills = append(fills, Fill{
+			Leg:     leg,
+			Qty:     leg.Spec.Qty * units,
+			Price:   prices[i].Price,
+			Spread:  prices[i].Spread,
+			Opening: opening,
+		})
+	}
+	return fills
+}
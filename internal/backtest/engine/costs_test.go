@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+)
+
+func TestCostSpecOrderCost(t *testing.T) {
+	legs := []st.TradeLeg{
+		{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 100},
+		{Spec: st.LegSpec{Side: "buy", OptionType: "put", Qty: 1}, Strike: 95},
+	}
+	spec := CostSpec{
+		CommissionPerContract:    0.65,
+		TicketFee:                1.00,
+		ExchangeFeePerContract:   0.30,
+		RegulatoryFeePerContract: 0.05,
+		SlippageSpreadPct:        50,
+		DefaultSpreadPct:         10,
+		SlippageTicks:            1,
+		TickSize:                 0.05,
+	}
+
+	fills := legFills(legs, []legMark{{Price: 2.00}, {Price: 0.50}}, 2, true, nil)
+	costs := spec.OrderCost(fills)
+
+	// 4 contracts: 1.00 + 4×0.65
+	if math.Abs(costs.Commission-3.60) > 1e-9 {
+		t.Fatalf("expected commission 3.60, got %f", costs.Commission)
+	}
+	// 4 contracts × 0.35
+	if math.Abs(costs.Fees-1.40) > 1e-9 {
+		t.Fatalf("expected fees 1.40, got %f", costs.Fees)
+	}
+	// per share: (0.20×50% + 0.05) on leg 1, (0.05×50% + 0.05) on leg 2, × 2 contracts × 100
+	if math.Abs(costs.Slippage-(0.15*200+0.075*200)) > 1e-9 {
+		t.Fatalf("expected slippage 45.00, got %f", costs.Slippage)
+	}
+
+	// expired legs are skipped and an empty order costs nothing
+	skipAll := func(st.TradeLeg) bool { return true }
+	if c := spec.OrderCost(legFills(legs, []legMark{{}, {}}, 2, false, skipAll)); c.Total() != 0 {
+		t.Fatalf("expected zero cost for empty order, got %+v", c)
+	}
+}
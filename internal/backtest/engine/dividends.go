@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"strings"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+// loadDividends sets the cash dividends options are priced with: those of
+// the assignment spec when configured, else the provider's from the start
+// date to a year past the end date, so that options opened late in the run
+// still see the dividends before their expiry. A provider without dividend
+// data leaves the run pricing on the spot alone.
+func (e *Engine) loadDividends(start, end time.Time) {
+	if len(e.cfg.Assignment.Dividends) > 0 {
+		e.dividends = e.cfg.Assignment.Dividends
+		return
+	}
+	divs, err := e.prov.GetDividends(e.cfg.Underlying, start, end.AddDate(1, 0, 0))
+	if err != nil {
+		logger.Infof("dividends unavailable, pricing on spot: %v", err)
+		return
+	}
+	e.dividends = divs
+	logger.Debugf("loaded %d %s dividends", len(divs), e.cfg.Underlying)
+}
+
+// dividendTerms returns the present value of the cash dividends going ex
+// after asOf and by expiry, and the product's continuous dividend yield. The
+// forward of the underlying for the expiry is (spot - pv) * exp((r-q)*T).
+func (e *Engine) dividendTerms(asOf, expiry time.Time) (pv, q float64) {
+	T := expiry.Sub(asOf).Hours() / (24 * 365)
+	//TODO: risk-free rate from provider or config - using 2% fixed here
+	return pricing.PVDividends(0.02, T, data.CashDividends(e.dividends, asOf, expiry)), e.product().DividendYield
+}
+
+// escrowedSpot returns the spot less the present value of the cash dividends
+// going ex after asOf and by expiry, never below zero, and the product's
+// continuous dividend yield: the spot and yield options are valued on.
+func (e *Engine) escrowedSpot(spot float64, asOf, expiry time.Time) (s, q float64) {
+	T := expiry.Sub(asOf).Hours() / (24 * 365)
+	//TODO: risk-free rate from provider or config - using 2% fixed here
+	return pricing.EscrowedSpot(spot, 0.02, T, data.CashDividends(e.dividends, asOf, expiry)), e.product().DividendYield
+}
+
+// modelPrice values an option leg at a spot and volatility with
+// Black-Scholes-Merton on the dividend forward (escrowed cash dividends and
+// the product's dividend yield).
+func (e *Engine) modelPrice(leg st.TradeLeg, spot float64, asOf time.Time, iv float64) float64 {
+	expiry := e.expiryTime(leg)
+	s, q := e.escrowedSpot(spot, asOf, expiry)
+	//TODO: risk-free rate from provider or config - using 2% fixed here
+	return pricing.BlackScholesMertonPrice(
+		s,
+		leg.Strike,
+		expiry.Sub(asOf).Hours()/(24*365),
+		0.02,
+		q,
+		iv,
+		strings.ToLower(leg.Spec.OptionType) == "call",
+	)
+}
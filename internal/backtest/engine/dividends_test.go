@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+// dividendProvider serves fixed dividends on top of another provider.
+type dividendProvider struct {
+	data.Provider
+	divs []data.Dividend
+}
+
+func (p dividendProvider) GetDividends(string, time.Time, time.Time) ([]data.Dividend, error) {
+	return p.divs, nil
+}
+
+func TestDividendForward(t *testing.T) {
+	asOf := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	exDate := time.Date(2024, 2, 9, 0, 0, 0, 0, time.UTC)
+	leg := st.TradeLeg{Spec: st.LegSpec{Side: "buy", OptionType: "call", Qty: 1}, Strike: 185, Expiration: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)}
+	prov := dividendProvider{Provider: data.NewSyntheticProvider(), divs: []data.Dividend{
+		{ExDate: exDate, Amount: 0.24},
+		{ExDate: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), Amount: 0.25}, // after expiry
+	}}
+	e := NewEngine(&Config{Underlying: "AAPL"}, prov)
+	plain := e.modelPrice(leg, 185, asOf, 0.25)
+
+	e.loadDividends(asOf, asOf)
+	pv, q := e.dividendTerms(asOf, e.expiryTime(leg))
+	if want := 0.24 * math.Exp(-0.02*exDate.Sub(asOf).Hours()/(24*365)); math.Abs(pv-want) > 1e-12 || q != 0 {
+		t.Fatalf("expected pv %.6f of the dividend before expiry and no yield, got %.6f and %.4f", want, pv, q)
+	}
+	call := e.modelPrice(leg, 185, asOf, 0.25)
+	if call >= plain || plain-call > 0.24 {
+		t.Fatalf("expected the dividend to cheapen the call by less than its amount, got %.4f vs %.4f", call, plain)
+	}
+	if iv := e.impliedVol(leg, call, 185, asOf); math.Abs(iv-0.25) > 1e-4 {
+		t.Fatalf("expected the implied vol to round-trip on the forward, got %.6f", iv)
+	}
+
+	// the provider's dividends drive early exercise of short calls
+	tr := &Trade{
+		Legs:      []st.TradeLeg{{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 170, Expiration: leg.Expiration}},
+		legPrices: []legMark{{Price: 15.1}},
+	}
+	if i, reason := e.assignedLeg(tr, data.Bar{Date: exDate.AddDate(0, 0, -1), Close: 185}); i != 0 || reason != "ex_dividend_call" {
+		t.Fatalf("expected the deep short call assigned ahead of the ex-date, got %d %q", i, reason)
+	}
+
+	// dividends worth more than the spot leave the call worthless, not NaN
+	e.dividends = []data.Dividend{{ExDate: exDate, Amount: 200}}
+	if c := e.modelPrice(leg, 185, asOf, 0.25); c != 0 {
+		t.Fatalf("expected the escrowed spot floored at zero, got call %.4f", c)
+	}
+}
@@ -3,7 +3,6 @@ package engine
 import (
 	"fmt"
 	"math"
-	"sort"
 	"strings"
 	"time"
 
@@ -17,41 +16,110 @@ import (
 type Engine struct {
 	cfg  *Config
 	prov data.Provider
+
+	hv        float64     // historical volatility of the underlying over the run
+	expiries  []time.Time // relevant expiries for the underlying over the run
+	exits     []ExitRule  // exit rules evaluated on every bar of an open trade
+	adjusters []adjuster  // adjustments evaluated on every bar before the exit rules
+
+	products  *data.ProductRegistry // product metadata of the run: the defaults, its products file and populated product
+	daily     map[string]data.Bar   // daily bars of the run by date, for expiration settlement
+	loc       *time.Location        // Entry.Timezone, resolved once (see entryLocation)
+	dividends []data.Dividend       // cash dividends of the underlying, for pricing on the forward
+	history   []data.Bar            // daily bars from the IV rank lookback before the run to its end
+	rankedAt  time.Time             // bar of the last IV rank computed
+	rank      float64               // underlying IV rank at rankedAt
+	ranksIV   bool                  // an exit rule or adjustment condition reads the IV rank
+
+	chain       []pricing.Option // scratch option chain of positionGreeks, reused across bars
+	chainGreeks []pricing.Greeks // scratch greeks of chain
 }
 
 // Config struct
 type Config struct {
-	Underlying string          `json:"underlying"`           // e.g. "AAPL"
-	Entry      sch.EntryRule   `json:"entry"`                // entry rules
-	Strategy   st.StrategySpec `json:"strategy"`             // option legs
-	Exit       ExitSpec        `json:"exit"`                 // exit rules
-	MaxTrades  int             `json:"max_trades,omitempty"` // max trades to execute, 0 = unlimited
-	ReportDir  string          `json:"report_dir,omitempty"` // report directory
-	Seed       int64           `json:"seed,omitempty"`       // random seed for stochastic elements
-	Verbosity  int             `json:"verbosity,omitempty"`  // 0=errors,1=info,2=debug,3=trace
+	Underlying      string                    `json:"underlying"`                 // e.g. "AAPL"
+	Entry           sch.EntryRule             `json:"entry"`                      // entry rules
+	Strategy        st.StrategySpec           `json:"strategy"`                   // option legs
+	Exit            ExitSpec                  `json:"exit"`                       // exit rules
+	Adjustments     []AdjustmentSpec          `json:"adjustments,omitempty"`      // rolls, hedges and partial closes of open positions
+	ExitRules       []ExitRule                `json:"-"`                          // optional custom exit rules, checked after Exit
+	Resolution      string                    `json:"resolution,omitempty"`       // simulation bars: 1m, 5m, 15m, 1h or day, default: day
+	StartingCapital float64                   `json:"starting_capital,omitempty"` // account capital at start, default: 100000
+	Sizing          SizingSpec                `json:"sizing,omitempty"`           // position sizing rules
+	Costs           CostSpec                  `json:"costs,omitempty"`            // commission, fee and slippage model
+	CostModel       CostModel                 `json:"-"`                          // optional custom cost model, overrides Costs
+	Fills           FillSpec                  `json:"fills,omitempty"`            // quote-aware fill and liquidity rules
+	Intrabar        IntrabarSpec              `json:"intrabar,omitempty"`         // stop/target evaluation at bar high and low
+	Hedge           HedgeSpec                 `json:"hedge,omitempty"`            // dynamic delta hedging with the underlying
+	Assignment      AssignmentSpec            `json:"assignment,omitempty"`       // early assignment of short options and pin risk
+	Margin          MarginSpec                `json:"margin,omitempty"`           // margin requirements and buying-power checks
+	Universe        UniverseSpec              `json:"universe,omitempty"`         // underlyings to screen on each scheduled date instead of Underlying
+	MonteCarlo      MonteCarloSpec            `json:"monte_carlo,omitempty"`      // resampling of trade P&L after the run
+	Settlements     map[string]SettlementSpec `json:"settlements,omitempty"`      // expiration settlement by underlying, overrides the product registry
+	Products        string                    `json:"products,omitempty"`         // products file (.json or .csv) loaded into the run's product registry
+	PopulateProduct bool                      `json:"populate_product,omitempty"` // fill the underlying's product from provider contract data
+	MaxTrades       int                       `json:"max_trades,omitempty"`       // max trades to execute, 0 = unlimited
+	MaxConcurrent   int                       `json:"max_concurrent,omitempty"`   // max positions open at once, 0 = unlimited
+	OneAtATime      bool                      `json:"one_at_a_time,omitempty"`    // no new entry while a position is open
+	ReportDir       string                    `json:"report_dir,omitempty"`       // report directory
+	IVRankWindow    int                       `json:"iv_rank_window,omitempty"`   // daily bars the underlying's IV rank looks back over, default: 252
+	Seed            int64                     `json:"seed,omitempty"`             // random seed for stochastic elements
+	Verbosity       int                       `json:"verbosity,omitempty"`        // 0=errors,1=info,2=debug,3=trace
 }
 
 // ExitSpec defines various exit rules for trades
 type ExitSpec struct {
-	ProfitTargetPct    *float64 `json:"profit_target_pct,omitempty"`      // e.g. 50.0 for 50%
-	StopLossPct        *float64 `json:"stop_loss_pct,omitempty"`          // e.g. 30.0 for 30%
-	UnderlyingMovePx   *float64 `json:"underlying_move_px,omitempty"`     // e.g. 5.0 for $5 move
-	MaxDaysInTrade     *int     `json:"max_days_in_trade,omitempty"`      // e.g. 10 for 10 days
-	ExitByDaysToExpiry *int     `json:"exit_by_days_to_expiry,omitempty"` // e.g. 5 for exit when any leg has ≤5 days to expiry
+	ProfitTargetPct    *float64       `json:"profit_target_pct,omitempty"`      // e.g. 50.0 for 50%
+	StopLossPct        *float64       `json:"stop_loss_pct,omitempty"`          // e.g. 30.0 for 30%
+	UnderlyingMovePx   *float64       `json:"underlying_move_px,omitempty"`     // e.g. 5.0 for $5 move
+	MaxDaysInTrade     *int           `json:"max_days_in_trade,omitempty"`      // e.g. 10 for 10 days
+	ExitByDaysToExpiry *int           `json:"exit_by_days_to_expiry,omitempty"` // e.g. 5 for exit when any leg has ≤5 days to expiry
+	Rules              []ExitRuleSpec `json:"rules,omitempty"`                  // registered exit rules by name, checked after the fields above
 }
 
 type Trade struct {
 	ID                int           // unique trade ID
+	Underlying        string        // underlying symbol
 	OpenDateTime      time.Time     // trade open date time
 	CloseDateTime     *time.Time    // trade close date time
 	UnderlyingAtOpen  float64       // underlying price at open
 	UnderlyingAtClose float64       // underlying price at close
 	Legs              []st.TradeLeg // trade legs (strategy)
+	Contracts         int           // strategy units opened, scales every leg quantity
+	MaxRisk           float64       // defined max loss at open for all units, 0 if undefined
+	EquityAtOpen      float64       // account equity when the trade was sized
 	OpenPremium       float64       // total premium at open for entire strategy
 	ClosePremium      float64       // total premium at close for entire strategy
 	HighPremium       float64       // highest premium during trade
 	LowPremium        float64       // lowest premium during trade
+	OpenCosts         Costs         // transaction costs paid at open
+	CloseCosts        Costs         // transaction costs paid at close
+	GrossPnL          float64       // close premium + adjustment and hedge premium - open premium
+	NetPnL            float64       // gross P&L less open, adjustment, hedge and close costs
 	ClosedBy          string        // reason for closing the trade
+	ClosedLegs        []st.TradeLeg // legs closed or rolled out by adjustments, with their close premium
+	Adjustments       []Adjustment  // adjustments applied while open, in date order
+	AdjustmentPremium float64       // net value realized by adjustments, chained into the P&L
+	AdjustmentCosts   Costs         // transaction costs paid by adjustments
+	HedgeTrades       []HedgeTrade  // delta hedge rebalances, in date order
+	HedgePremium      float64       // net cash of hedge rebalances, chained into the P&L
+	HedgeCosts        Costs         // transaction costs paid by hedge rebalances
+	HedgePnL          float64       // gross P&L of the hedge shares
+	OptionPnL         float64       // gross P&L of everything but the hedge shares
+	PinRisks          []PinRisk     // short legs that expired near the money
+	InitialMargin     float64       // margin requirement at open
+	MaxMargin         float64       // highest margin requirement while open, initial included
+	ReturnOnMargin    float64       // net P&L as a percent of MaxMargin
+	Sleeve            string        // portfolio sleeve that opened the trade, "" in single-strategy runs
+	IntrabarPath      string        // assumed bar path when an exit triggered inside a bar, e.g. "O-L-H-C"
+
+	mark      float64   // latest mark-to-market premium while open
+	legPrices []legMark // latest per-share valuation of each leg while open
+	hedgeDay  string    // trading day of the last hedge rebalance check
+	hedgeSpot float64   // underlying price at the last hedge rebalance check
+	margin    float64   // latest margin requirement while open
+
+	pinChecked map[time.Time]bool // expirations already checked for pin risk
 }
 
 const (
@@ -63,27 +131,154 @@ const (
 
 // Result mirrors original
 type Result struct {
-	Trades []Trade `json:"trades"`
+	Trades     []Trade           `json:"trades"`
+	Equity     []EquityPoint     `json:"equity"`                // daily mark-to-market account equity
+	MonteCarlo *MonteCarloResult `json:"monte_carlo,omitempty"` // trade resampling, if Config.MonteCarlo is set
 }
 
 func NewEngine(cfg *Config, prov data.Provider) *Engine {
-	return &Engine{cfg: cfg, prov: prov}
+	return &Engine{cfg: cfg, prov: prov, products: data.Products.Clone()}
 }
 
-// Run executes the backtest
+// Run executes the backtest.
+//
+// Daily bars drive scheduling and historical volatility; simulation bars at
+// Config.Resolution drive the mark-to-market loop. Simulation bars are walked
+// once in chronological order. On every bar the open positions are marked to
+// market and checked for exits first, so that a position closed on a bar
+// frees capacity for an entry scheduled on the same bar. New positions are
+// then opened on scheduled dates (intraday: on the first bar at or after the
+// entry time), subject to MaxTrades, MaxConcurrent and OneAtATime. The
+// account is snapshotted into the equity curve on the last bar of each
+// trading day. Positions still open after the last bar are closed at their
+// final mark with reason "data_end". With Config.MonteCarlo set, the trades
+// are then resampled into Result.MonteCarlo.
 func (e *Engine) Run() (*Result, error) {
 	cfg := e.cfg
-	// fill defaults
+	if err := cfg.MonteCarlo.validate(); err != nil {
+		return nil, fmt.Errorf("invalid monte carlo: %w", err)
+	}
+
+	var res *Result
+	if cfg.Universe.enabled() {
+		var err error
+		if res, err = e.runUniverse(); err != nil {
+			return nil, err
+		}
+	} else {
+		r, err := e.prepare()
+		if err != nil {
+			return nil, err
+		}
+		pf := newPortfolio(cfg.StartingCapital)
+		r.pf, r.account, r.limits = pf, pf, pf
+		id := 1
+		for r.next < len(r.bars) {
+			r.step(&id)
+		}
+		res = &Result{Trades: pf.trades(), Equity: r.curve}
+	}
+
+	if cfg.MonteCarlo.enabled() {
+		res.MonteCarlo = MonteCarlo(res.Trades, cfg.StartingCapital, cfg.MonteCarlo, cfg.Seed)
+		logger.Infof("monte carlo: %d %s runs, mean final equity=%.2f, risk of ruin=%.2f%%",
+			res.MonteCarlo.Runs,
+			res.MonteCarlo.Method,
+			res.MonteCarlo.FinalEquity.Mean,
+			res.MonteCarlo.RiskOfRuin,
+		)
+	}
+	return res, nil
+}
+
+// run is the event-loop state of one engine over its simulation bars.
+type run struct {
+	e       *Engine
+	name    string               // sleeve name in a portfolio run, "" otherwise
+	bars    []data.Bar           // simulation bars, in date order
+	entries map[string]time.Time // scheduled entries not yet taken, by trading day
+	days    []data.Bar           // daily bars of the run
+	next    int                  // index of the next bar to process
+	pf      *portfolio           // positions opened by this engine
+	account *portfolio           // account the positions are sized and margined against, pf or shared
+	limits  *portfolio           // portfolio MaxTrades, MaxConcurrent and OneAtATime apply to, pf or account
+	curve   []EquityPoint        // end-of-day snapshots of pf
+}
+
+// fillDefaults sets unset report, seed, capital and verbosity fields and
+// applies the verbosity.
+func (cfg *Config) fillDefaults() {
 	if cfg.ReportDir == "" {
 		cfg.ReportDir = "./out"
 	}
 	if cfg.Seed == 0 {
 		cfg.Seed = time.Now().UnixNano()
 	}
+	if cfg.StartingCapital <= 0 {
+		cfg.StartingCapital = 100000
+	}
 	if cfg.Verbosity < VerbosityError || cfg.Verbosity > VerbosityTrace {
 		cfg.Verbosity = VerbosityInfo
 	}
 	logger.SetVerbosity(cfg.Verbosity)
+}
+
+// prepare fills config defaults, validates the config and loads the bars,
+// volatility, expiries and entry schedule of a run.
+func (e *Engine) prepare() (*run, error) {
+	cfg := e.cfg
+	cfg.fillDefaults()
+
+	loc, err := cfg.loadLocation()
+	if err != nil {
+		return nil, err
+	}
+	e.loc = loc
+
+	// product metadata: multiplier, strikes, settlement, ticks and hours
+	if cfg.Products != "" {
+		if err := e.registry().LoadFile(cfg.Products); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PopulateProduct {
+		if err := e.registry().Populate(e.prov, cfg.Underlying, cfg.Entry.StartDate); err != nil {
+			logger.Infof("product reference data unavailable, using registry: %v", err)
+		}
+	}
+	if cfg.Costs.TickSize <= 0 {
+		cfg.Costs.TickSize = e.product().TickSize
+	}
+
+	exits, err := cfg.exitRules()
+	if err != nil {
+		return nil, fmt.Errorf("invalid exit rules: %w", err)
+	}
+	e.exits = exits
+
+	e.adjusters, err = cfg.adjusters()
+	if err != nil {
+		return nil, fmt.Errorf("invalid adjustments: %w", err)
+	}
+	e.ranksIV = usesIVRank(e.exits)
+	for _, a := range e.adjusters {
+		e.ranksIV = e.ranksIV || usesIVRank([]ExitRule{a.when})
+	}
+
+	if err := cfg.Hedge.validate(); err != nil {
+		return nil, fmt.Errorf("invalid hedge: %w", err)
+	}
+	if err := cfg.Assignment.validate(); err != nil {
+		return nil, fmt.Errorf("invalid assignment: %w", err)
+	}
+	if err := cfg.Margin.validate(); err != nil {
+		return nil, fmt.Errorf("invalid margin: %w", err)
+	}
+	if cfg.CostModel == nil {
+		if err := cfg.Fills.validate(cfg.Costs); err != nil {
+			return nil, fmt.Errorf("invalid fills: %w", err)
+		}
+	}
 
 	// fetch bars
 	bars, err := e.prov.GetBars(cfg.Underlying, cfg.Entry.StartDate, cfg.Entry.EndDate, 1, "day")
@@ -93,26 +288,23 @@ func (e *Engine) Run() (*Result, error) {
 		// bars = generateSyntheticSeries(cfg.Underlying, start, end)	/* 🔥 TODO: replaced with synthetic provider */
 	}
 
-	// build map
-	barMap := make(map[string]data.Bar, len(bars))
-	for _, b := range bars {
-		k := b.Date.Format("2006-01-02")
-		barMap[k] = b
-	}
-
 	// historical vol
+	e.daily = dailyIndex(bars)
 	closes := extractCloses(bars)
-	hv := AnnualizedVolatility(closes)
-	logger.Infof("hist vol = %.2f%%", hv*100)
+	e.hv = AnnualizedVolatility(closes)
+	logger.Infof("hist vol = %.2f%%", e.hv*100)
+
+	e.history = e.loadHistory(bars)
+	e.loadDividends(cfg.Entry.StartDate, cfg.Entry.EndDate)
 
 	// get list of expiryList for the underlying during backtest period
-	expiryList, err := e.prov.GetRelevantExpiries(cfg.Underlying, cfg.Entry.StartDate, cfg.Entry.EndDate)
+	e.expiries, err = e.prov.GetRelevantExpiries(cfg.Underlying, cfg.Entry.StartDate, cfg.Entry.EndDate)
 	if err != nil {
 		return nil, fmt.Errorf("backtest scheduler error: get relevant expiries error, %w", err)
 	}
 
 	// schedule
-	dates, err := sch.ScheduleDates(cfg.Entry, bars, expiryList)
+	dates, err := sch.ScheduleDates(cfg.Entry, bars, e.expiries)
 	if err != nil {
 		return nil, fmt.Errorf("failed to schedule dates: %w", err)
 	}
@@ -121,101 +313,181 @@ func (e *Engine) Run() (*Result, error) {
 	}
 	logger.Infof("%d schedule dates", len(dates))
 
-	var trades []Trade
-	id := 1
-	for _, dt := range dates {
-		// TODO: max trades limit
-		// if cfg.MaxTrades > 0 && len(trades) >= cfg.MaxTrades {
-		// 	break
-		// }
-		bk := dt.Format("2006-01-02")
-		bar, ok := barMap[bk]
-		if !ok {
-			logger.Debugf("no bar for %s", bk)
-			continue
-		}
-		// intentionally using close price of bars as open (picking bar at open time)
-		openPrice := bar.Close
+	// index scheduled entries by trading day
+	entries, err := e.entryTimes(dates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve entry times: %w", err)
+	}
 
-		// build legs
-		var legs []st.TradeLeg
-		legs, err = st.PlanStrategy(cfg.Strategy, dt, cfg.Underlying, openPrice, expiryList, e.prov)
-		if err != nil {
-			logger.Infof("error on trade date %s, skipped", dt.Format("2006-01-02"))
-			logger.Debugf("skipping trade on %s: build legs error: %v", dt.Format("2006-01-02"), err)
-			continue
-		}
+	simBars, err := e.simulationBars(bars)
+	if err != nil {
+		return nil, err
+	}
+	return &run{e: e, bars: simBars, days: e.history, entries: entries, curve: make([]EquityPoint, 0, len(bars))}, nil
+}
 
-		// price legs
-		openPremium := 0.0
-		for _, leg := range legs {
-			p, err := e.prov.GetOptionPrice(
-				cfg.Underlying,
-				leg.Strike,
-				leg.Expiration,
-				leg.Spec.OptionType,
-				dt,
+// step processes the next simulation bar: open positions are marked and
+// checked for exits, a scheduled entry is taken, and pf is snapshotted on the
+// last bar of a trading day. Positions still open after the last bar are
+// closed at their final mark. id is the next trade ID, shared by every run
+// of an account.
+func (r *run) step(id *int) {
+	e, cfg, pf := r.e, r.e.cfg, r.pf
+	i, b := r.next, r.bars[r.next]
+	r.next++
+
+	// manage open positions before considering new entries
+	for _, tr := range pf.openTrades() {
+		if e.updateTrade(tr, b) {
+			r.close(tr)
+			logger.Infof("trade %d closed_by=%s close premium=%.2f gross pnl=%.2f net pnl=%.2f",
+				tr.ID,
+				tr.ClosedBy,
+				tr.ClosePremium,
+				tr.GrossPnL,
+				tr.NetPnL,
 			)
-			if err != nil {
-				// fallback to BS
-				logger.Debugf(
-					"option price fallback BS %s %s K=%.2f exp=%s err=%v",
-					cfg.Underlying,
-					leg.Spec.OptionType,
-					leg.Strike,
-					leg.Expiration.Format("2006-01-02"),
-					err,
-				)
-				p = pricing.BlackScholesPrice(
-					openPrice,
-					leg.Strike,
-					(leg.Expiration.Sub(dt).Hours() / (24 * 365)),
-					0.02,
-					hv, // historical volatility
-					strings.ToLower(leg.Spec.OptionType) == "call",
-				)
-			}
-			side := strings.ToLower(leg.Spec.Side)
-			sign := 1.0
-			if side == "sell" {
-				sign = -1.0
+		}
+	}
+
+	bk := e.dayKey(b)
+	if dt, ok := r.entries[bk]; ok && (!e.intraday() || !b.Date.Before(dt)) {
+		delete(r.entries, bk)
+		if e.intraday() {
+			dt = b.Date // filled on this bar
+		}
+		if reason := r.limits.entryBlocked(cfg); reason != "" {
+			logger.Debugf("entry on %s skipped: %s", bk, reason)
+		} else if tr, err := e.openTrade(*id, dt, b, r.sizingEquity()); err != nil {
+			logger.Infof("error on trade date %s, skipped", bk)
+			logger.Debugf("skipping trade on %s: %v", bk, err)
+		} else if reason := r.account.marginBlocked(cfg, tr); reason != "" {
+			logger.Infof("entry on %s rejected: %s", bk, reason)
+		} else {
+			tr.Sleeve = r.name
+			pf.add(tr)
+			if r.account != pf {
+				r.account.add(tr)
 			}
-			openPremium += sign * p * float64(leg.Spec.Qty) * 100.0
+			*id++
 		}
+	}
 
-		tr := Trade{
-			ID:               id,
-			OpenDateTime:     dt,
-			UnderlyingAtOpen: openPrice,
-			Legs:             legs,
-			OpenPremium:      openPremium,
-			HighPremium:      openPremium,
-			LowPremium:       openPremium,
+	// close whatever is still open at the end of data
+	last := i == len(r.bars)-1
+	if last {
+		for _, tr := range pf.openTrades() {
+			e.closeTrade(tr, b, tr.legPrices, "data_end")
+			r.close(tr)
 		}
-		logger.Infof(
-			"trade %d opened %s underlying=%.2f open premium=%.2f",
-			tr.ID,
-			dt.Format("2006-01-02"),
-			openPrice,
-			openPremium,
-		)
-		id++
-		// simulate
-		simCloseTrade(&tr, bars, barMap, hv, *cfg, e.prov)
-		trades = append(trades, tr)
-		logger.Infof("trade %d closed_by=%s close premium=%.2f pnl=%.2f",
-			tr.ID,
-			tr.ClosedBy,
-			tr.ClosePremium,
-			tr.ClosePremium-tr.OpenPremium,
-		)
 	}
 
-	// sort trades by ID (stable)
-	sort.Slice(trades, func(i, j int) bool { return trades[i].ID < trades[j].ID })
+	// snapshot once per trading day, on its last bar
+	if last || e.dayKey(r.bars[i+1]) != bk {
+		r.curve = append(r.curve, pf.snapshot(b.Date))
+	}
+}
 
-	res := &Result{Trades: trades}
-	return res, nil
+// close books a closed trade in pf and the account.
+func (r *run) close(tr *Trade) {
+	r.pf.close(tr)
+	if r.account != r.pf {
+		r.account.close(tr)
+	}
+}
+
+// sizingEquity returns the equity new positions are sized against: the
+// account equity, scaled by the sleeve's allocation in a portfolio run.
+func (r *run) sizingEquity() float64 {
+	if r.account == r.pf {
+		return r.account.equity()
+	}
+	return r.account.equity() * r.pf.capital / r.account.capital
+}
+
+// openTrade plans, prices and sizes a new position on a scheduled date.
+//
+// Parameters:
+//   - id: trade ID to assign
+//   - dt: scheduled entry date time
+//   - bar: bar of the entry date; its close is used as the open price
+//   - equity: current account equity used for sizing
+//
+// Returns:
+//   - *Trade: the opened trade, marked at its open premium
+//   - error: if legs cannot be planned or sizing yields no contracts
+func (e *Engine) openTrade(id int, dt time.Time, bar data.Bar, equity float64) (*Trade, error) {
+	cfg := e.cfg
+	// intentionally using close price of bars as open (picking bar at open time)
+	openPrice := bar.Close
+
+	// build legs
+	legs, err := st.PlanStrategy(cfg.Strategy, dt, cfg.Underlying, openPrice, e.expiries, e.prov, e.registry())
+	if err != nil {
+		return nil, fmt.Errorf("build legs error: %w", err)
+	}
+	e.stampMultiplier(legs)
+
+	// price legs (one strategy unit) at their entry fill
+	openPremium := 0.0
+	prices := make([]legMark, len(legs))
+	for i, leg := range legs {
+		m, q := e.priceLeg(leg, openPrice, dt)
+		if cfg.Fills.UseQuotes && !leg.Spec.IsStock() {
+			if err := cfg.Fills.checkLiquidity(q); err != nil {
+				return nil, fmt.Errorf("liquidity check failed leg=%d K=%.2f: %w", i+1, leg.Strike, err)
+			}
+		}
+		p := cfg.Fills.fillPrice(m, legSign(leg) > 0)
+		legs[i].OpenPremium = p
+		prices[i] = m
+		openPremium += legSign(leg) * p * float64(leg.Spec.Qty) * legMultiplier(leg)
+	}
+
+	// size the position against current equity
+	unitRisk, _ := definedRisk(legs, openPremium)
+	contracts := cfg.Sizing.contractsFor(equity, openPremium, unitRisk)
+	if contracts <= 0 {
+		return nil, fmt.Errorf("sizing mode=%s returned no contracts (equity=%.2f unit premium=%.2f unit risk=%.2f)",
+			cfg.Sizing.Mode, equity, openPremium, unitRisk)
+	}
+	openPremium *= float64(contracts)
+	costs := cfg.costModel().OrderCost(legFills(legs, prices, contracts, true, nil))
+
+	tr := &Trade{
+		ID:               id,
+		Underlying:       cfg.Underlying,
+		OpenDateTime:     dt,
+		UnderlyingAtOpen: openPrice,
+		Legs:             legs,
+		Contracts:        contracts,
+		MaxRisk:          unitRisk * float64(contracts),
+		EquityAtOpen:     equity,
+		OpenPremium:      openPremium,
+		HighPremium:      openPremium,
+		LowPremium:       openPremium,
+		OpenCosts:        costs,
+		mark:             openPremium,
+		legPrices:        prices,
+	}
+	if cfg.Hedge.enabled() {
+		e.hedgeTrade(tr, bar, e.positionGreeks(tr, bar))
+	}
+	if cfg.Margin.enabled() {
+		tr.InitialMargin = e.marginFor(tr, bar, tr.legPrices, true)
+		e.trackMargin(tr, bar)
+		tr.MaxMargin = math.Max(tr.MaxMargin, tr.InitialMargin)
+	}
+	logger.Infof(
+		"trade %d opened %s underlying=%.2f contracts=%d open premium=%.2f costs=%.2f",
+		tr.ID,
+		dt.Format("2006-01-02"),
+		openPrice,
+		contracts,
+		openPremium,
+		costs.Total(),
+	)
+	return tr, nil
 }
 
 func AnnualizedVolatility(closes []float64) float64 {
@@ -271,259 +543,221 @@ func PriceOption(
 	), nil
 }
 
-// simCloseTrade simulates the closing of a trade by iterating through historical bar data
-// to determine when and how the trade exits. It updates the trade's close details including
-// the close date, close premium, underlying price at close, and the reason for closure.
-//
-// The function searches for the bar corresponding to the trade's open date. If no data exists
-// for that date, it closes the trade immediately with no price change and marks it as "no_data".
+// markTrade computes the total premium of all trade legs on a bar:
+//   - If a leg has expired, it uses the intrinsic value at the underlying's
+//     settlement price (see SettlementSpec)
+//   - If a leg is still active, it is valued by priceLeg (quote mid, provider price, or
+//     Black-Scholes pricing if the provider returns no data)
 //
-// For each subsequent bar, it calculates the total premium of all trade legs:
-//   - If a leg has expired, it uses the intrinsic value (payoff at expiration)
-//   - If a leg is still active, it fetches the option price from the provider or falls back
-//     to Black-Scholes pricing if the provider returns no data
-//
-// The function tracks the high and low premiums reached during the trade's life. It then
-// checks for exit conditions (stop loss, profit target, etc.) via checkExits. If an exit
-// condition is met, the trade closes with that reason. If all legs expire naturally, the
-// trade closes with reason "expired". If the bar data ends without an explicit exit, the
-// trade closes at the last available bar with reason "data_end".
-//
-// Parameters:
-//   - tr: pointer to the Trade being simulated
-//   - bars: slice of historical bar data sorted chronologically
-//   - barMap: map of bar data by key (currently unused in function)
-//   - historicalVolatility: volatility used for Black-Scholes fallback pricing
-//   - cfg: configuration containing the underlying symbol and exit parameters
-//   - prov: data provider for fetching option prices
-func simCloseTrade(
-	tr *Trade,
-	bars []data.Bar,
-	barMap map[string]data.Bar,
-	historicalVolatility float64,
-	cfg Config,
-	prov data.Provider,
-) {
-
-	// openKey := tr.OpenDateTime.Format("2006-01-02")
-	// idx := -1
-	// for i, b := range bars {
-	// 	if b.Date.Format("2006-01-02") == openKey {
-	// 		idx = i
-	// 		break
-	// 	}
-	// }
-	// // If no bar found at or after open date
-	// if idx == -1 {
-
-	// Efficiently find the starting bar using binary search instead of string formatting
-	idx := sort.Search(len(bars), func(i int) bool {
-		return !bars[i].Date.Before(tr.OpenDateTime)
-	})
-
-	// If no bar found at or after open date
-	if idx == len(bars) {
-		now := time.Now().UTC()
-		tr.CloseDateTime = &now
-		tr.ClosePremium = tr.OpenPremium
-		tr.ClosedBy = "no_data"
-		return
-	}
-
-	for i := idx; i < len(bars); i++ {
-		b := bars[i]
-		// compute premium
-		total := 0.0
-		for _, leg := range tr.Legs {
-			// if leg already expired before this date, use intrinsic
-			if !b.Date.Before(leg.Expiration) {
-				// at or after expiration -> intrinsic
-				intr := 0.0
-				if strings.ToLower(leg.Spec.OptionType) == "call" {
-					intr = math.Max(0.0, b.Close-leg.Strike)
-				} else {
-					intr = math.Max(0.0, leg.Strike-b.Close)
-				}
-				side := strings.ToLower(leg.Spec.Side)
-				sign := 1.0
-				if side == "sell" {
-					sign = -1.0
-				}
-				total += sign * intr * float64(leg.Spec.Qty) * 100.0
-				continue
-			}
-			// active leg -> price via provider else BS
-			p, err := prov.GetOptionPrice(cfg.Underlying, leg.Strike, leg.Expiration, leg.Spec.OptionType, b.Date)
-			if err != nil || p <= 0 {
-				//TODO: risk-free rate from provider or config - using 2% fixed here
-				logger.Debugf(
-					"option price fallback BS %s %s K=%.2f exp=%s err=%v",
-					cfg.Underlying,
-					leg.Spec.OptionType,
-					leg.Strike,
-					leg.Expiration.Format("2006-01-02"),
-					err,
-				)
-				p = pricing.BlackScholesPrice(
-					b.Close,
-					leg.Strike,
-					(leg.Expiration.Sub(b.Date).Hours() / (24 * 365)),
-					0.02,
-					historicalVolatility,
-					strings.ToLower(leg.Spec.OptionType) == "call",
-				)
-			}
-			side := strings.ToLower(leg.Spec.Side)
-			sign := 1.0
-			if side == "sell" {
-				sign = -1.0
-			}
-			total += sign * p * float64(leg.Spec.Qty) * 100.0
-		}
+// It returns the signed total premium, including the premium realized by
+// adjustments and hedge rebalances, and the per-share valuation of each leg.
+func (e *Engine) markTrade(tr *Trade, b data.Bar) (float64, []legMark) {
+	qty := float64(tr.Contracts)
+	if qty <= 0 {
+		qty = 1
+	}
 
-		if total > tr.HighPremium {
-			tr.HighPremium = total
-		}
-		if total < tr.LowPremium {
-			tr.LowPremium = total
+	total := 0.0
+	prices := make([]legMark, len(tr.Legs))
+	for i, leg := range tr.Legs {
+		// if leg already expired before this bar, use intrinsic
+		if e.legExpired(leg, b.Date) {
+			// at or after expiration -> intrinsic at settlement
+			prices[i] = e.expiredMark(leg, b)
+		} else {
+			// active leg -> price via quotes, provider, else BS
+			prices[i], _ = e.priceLeg(leg, b.Close, b.Date)
 		}
+		total += legSign(leg) * prices[i].Price * float64(leg.Spec.Qty) * qty * legMultiplier(leg)
+	}
+	return total + tr.AdjustmentPremium + tr.HedgePremium, prices
+}
 
-		// check exits
-		reason := checkExits(tr, total, b, cfg)
-		if reason != "" {
+// updateTrade marks an open trade on a bar and decides whether it closes.
+//
+// It tracks the high and low premiums reached during the trade's life and
+// records pin risk on expiring short legs. Short legs assigned early become
+// shares or close the trade with reason "assigned" (see AssignmentSpec). It then
+// applies the first configured adjustment whose condition holds (an adjustment
+// that closes every strategy leg closes the trade with reason "adjusted_flat"),
+// rebalances the delta hedge if one is configured and checks for exit conditions (stop loss, profit target, etc.) via checkExits. If an exit
+// condition is met, the trade closes with that reason. If all option legs expire naturally,
+// the trade closes with reason "expired" and any stock legs are sold at the bar close.
+//
+// Returns true if the trade was closed on this bar.
+func (e *Engine) updateTrade(tr *Trade, b data.Bar) bool {
+	total, prices := e.markTrade(tr, b)
+
+	// stops and targets crossed inside the bar happen before its close
+	if e.cfg.Intrabar.enabled() {
+		if hit, marks, path := e.checkIntrabar(tr, b, prices); hit != nil {
+			premium := e.premiumAt(tr, marks)
+			tr.HighPremium = math.Max(tr.HighPremium, premium)
+			tr.LowPremium = math.Min(tr.LowPremium, premium)
+			tr.mark = premium
+			tr.legPrices = marks
+			tr.IntrabarPath = path
 			logger.Debugf(
-				"trade %d exit %s on %s premium=%.2f underlying=%.2f",
+				"trade %d intrabar exit %s on %s path=%s premium=%.2f underlying=%.2f",
 				tr.ID,
-				reason,
-				b.Date.Format("2006-01-02"),
-				total,
-				b.Close,
+				hit.reason,
+				b.Date.Format("2006-01-02 15:04"),
+				path,
+				premium,
+				hit.spot,
 			)
-			tr.ClosePremium = total
-			tr.UnderlyingAtClose = b.Close
-			t := b.Date
-			tr.CloseDateTime = &t
-			tr.ClosedBy = reason
-			return
+			e.closeTrade(tr, b, marks, hit.reason+"_intrabar")
+			tr.UnderlyingAtClose = hit.spot
+			return true
 		}
+	}
 
-		// if all legs are expired now -> trade expired
-		allExpired := true
-		for _, leg := range tr.Legs {
-			if b.Date.Before(leg.Expiration) {
-				allExpired = false
-				break
-			}
-		}
-		if allExpired {
-			// compute intrinsic for all legs (already handled in loop but ensure close)
-			tr.ClosePremium = total
-			tr.UnderlyingAtClose = b.Close
-			t := b.Date
-			tr.CloseDateTime = &t
-			tr.ClosedBy = "expired"
-			return
+	tr.mark = total
+	tr.legPrices = prices
+
+	if total > tr.HighPremium {
+		tr.HighPremium = total
+	}
+	if total < tr.LowPremium {
+		tr.LowPremium = total
+	}
+	e.checkPin(tr, b)
+
+	if e.cfg.Assignment.enabled() {
+		if assigned, closed := e.assignTrade(tr, b); closed {
+			return true
+		} else if assigned {
+			total = e.premiumAt(tr, tr.legPrices)
+			prices = tr.legPrices
+			tr.mark = total
 		}
 	}
 
-	// end of data
-	last := bars[len(bars)-1]
-	tr.ClosePremium = tr.HighPremium
-	tr.UnderlyingAtClose = last.Close
-	t := last.Date
-	tr.CloseDateTime = &t
-	tr.ClosedBy = "data_end"
-}
+	ctx := e.exitContext(tr, total, b)
 
-// checkExits evaluates whether a trade should be exited based on configured exit rules.
-// It checks the current premium against the opening premium and applies the following exit conditions in order:
-// - ProfitTargetPct: exits if the trade has gained the specified percentage
-// - StopLossPct: exits if the trade has lost the specified percentage
-// - UnderlyingMovePx: exits if the underlying price has moved by the specified amount
-// - MaxDaysInTrade: exits if the trade has been open for the specified number of days
-// - ExitDaysBeforeExpiry: exits if any leg is within the specified number of days before expiration
-//
-// For percent-based calculations, the change is computed relative to the absolute value of the opening premium.
-// For credits (negative open premium), profit occurs when the premium increases toward zero.
-// For debits (positive open premium), profit occurs when the premium increases.
-//
-// Parameters:
-//   - tr: the Trade to evaluate
-//   - currPremium: the current premium price
-//   - bar: the current market data bar
-//   - cfg: the backtest configuration containing exit rules
-//
-// Returns:
-// A string describing the exit reason if any exit condition is met, or an empty string if no exits are triggered.
-func checkExits(
-	tr *Trade,
-	currPremium float64,
-	bar data.Bar,
-	cfg Config,
-) string {
-
-	open := tr.OpenPremium
-	// p/l change measured as (current - open)
-	change := currPremium - open
-	// for percent-based rules compute relative to notional magnitude (abs(open) or 1 if zero)
-	base := math.Abs(open)
-	if base < 1e-9 {
-		base = 1.0
-	}
-	changePct := change / base * 100.0
-
-	if cfg.Exit.ProfitTargetPct != nil {
-		// interpretation:
-		// - for credits (open < 0): profit occurs when curr moves toward 0 (i.e., change is positive)
-		// - for debits (open > 0): profit occurs when curr increases (change positive)
-		pct := *cfg.Exit.ProfitTargetPct
-		if pct >= 0 {
-			if open < 0 {
-				// credit: want currPremium to increase by pct of |open| (toward zero)
-				if changePct >= pct {
-					return fmt.Sprintf("profit_target_%.2f%%", pct)
-				}
-			} else {
-				if changePct >= pct {
-					return fmt.Sprintf("profit_target_%.2f%%", pct)
-				}
-			}
+	// adjustments reshape the position before the exit rules see it
+	if len(e.adjusters) > 0 && e.adjustTrade(tr, b, ctx) {
+		if h := tr.hedgeLeg(); len(tr.Legs) == 0 || (h >= 0 && len(tr.Legs) == 1) {
+			e.closeTrade(tr, b, tr.legPrices, "adjusted_flat")
+			return true
 		}
+		total = e.premiumAt(tr, tr.legPrices)
+		prices = tr.legPrices
+		tr.mark = total
+		ctx = e.exitContext(tr, total, b)
 	}
 
-	if cfg.Exit.StopLossPct != nil {
-		pct := *cfg.Exit.StopLossPct
-		if changePct <= -pct {
-			return fmt.Sprintf("stop_loss_%.2f%%", pct)
-		}
+	// the hedge trades at the bar close, so the exit rules see the hedged position
+	if e.cfg.Hedge.enabled() && e.hedgeTrade(tr, b, ctx.Greeks) {
+		total = e.premiumAt(tr, tr.legPrices)
+		prices = tr.legPrices
+		tr.mark = total
+		ctx = e.exitContext(tr, total, b)
 	}
 
-	if cfg.Exit.UnderlyingMovePx != nil {
-		if math.Abs(bar.Close-tr.UnderlyingAtOpen) >= *cfg.Exit.UnderlyingMovePx {
-			return fmt.Sprintf("underlying_move_%.2f", *cfg.Exit.UnderlyingMovePx)
-		}
+	if e.cfg.Margin.enabled() {
+		e.trackMargin(tr, b)
 	}
 
-	if cfg.Exit.MaxDaysInTrade != nil {
-		days := int(math.Floor(bar.Date.Sub(tr.OpenDateTime).Hours() / 24))
-		if days >= *cfg.Exit.MaxDaysInTrade {
-			return fmt.Sprintf("max_days_%d", *cfg.Exit.MaxDaysInTrade)
-		}
+	// check exits
+	reason := e.checkExits(ctx)
+	if reason != "" {
+		logger.Debugf(
+			"trade %d exit %s on %s premium=%.2f underlying=%.2f",
+			tr.ID,
+			reason,
+			b.Date.Format("2006-01-02"),
+			total,
+			b.Close,
+		)
+		e.closeTrade(tr, b, prices, reason)
+		return true
 	}
 
-	if cfg.Exit.ExitByDaysToExpiry != nil {
-		minDays := math.MaxInt32
-		for _, leg := range tr.Legs {
-			d := int(math.Ceil(leg.Expiration.Sub(bar.Date).Hours() / 24.0))
-			if d < minDays {
-				minDays = d
-			}
+	// if all option legs are expired now -> trade expired, closing any stock
+	options := 0
+	for _, leg := range tr.Legs {
+		if leg.Spec.IsStock() {
+			continue
 		}
-		if minDays <= *cfg.Exit.ExitByDaysToExpiry {
-			return fmt.Sprintf("exit_%ddays_before_expiry", *cfg.Exit.ExitByDaysToExpiry)
+		options++
+		if !e.legExpired(leg, b.Date) {
+			return false
 		}
 	}
+	if options == 0 {
+		return false
+	}
+	e.closeTrade(tr, b, prices, "expired")
+	return true
+}
 
+// closeTrade records the close details of a trade on a bar.
+//
+// Legs still trading on the bar are closed at their exit fill (buying back
+// shorts, selling longs) and charged close costs; legs that have reached
+// expiration settle at intrinsic value without an order, except that the
+// shares delivered by physically settled legs are liquidated and charged.
+func (e *Engine) closeTrade(tr *Trade, b data.Bar, prices []legMark, reason string) {
+	cfg := e.cfg
+	expired := func(leg st.TradeLeg) bool { return e.legExpired(leg, b.Date) }
+
+	premium := 0.0
+	for i, leg := range tr.Legs {
+		p := prices[i].Price
+		if !expired(leg) {
+			p = cfg.Fills.fillPrice(prices[i], legSign(leg) < 0)
+		}
+		tr.Legs[i].ClosePremium = p
+		premium += legSign(leg) * p * float64(leg.Spec.Qty) * float64(tr.Contracts) * legMultiplier(leg)
+	}
+	fills := append(legFills(tr.Legs, prices, tr.Contracts, false, expired), e.deliveryFills(tr.Legs, tr.Contracts, b)...)
+	tr.CloseCosts = cfg.costModel().OrderCost(fills)
+
+	tr.ClosePremium = premium
+	tr.UnderlyingAtClose = b.Close
+	t := b.Date
+	tr.CloseDateTime = &t
+	tr.ClosedBy = reason
+	tr.GrossPnL = tr.ClosePremium + tr.AdjustmentPremium + tr.HedgePremium - tr.OpenPremium
+	tr.NetPnL = tr.GrossPnL - tr.OpenCosts.Total() - tr.AdjustmentCosts.Total() - tr.HedgeCosts.Total() - tr.CloseCosts.Total()
+	tr.settleHedge()
+	if tr.MaxMargin > 0 {
+		tr.ReturnOnMargin = tr.NetPnL / tr.MaxMargin * 100.0
+	}
+}
+
+// exitContext builds the context the exit rules and adjustment conditions
+// see for a marked trade on a bar. The position and leg greeks are computed
+// from the latest leg marks, with the underlying's IV rank on the bar when
+// a rule reads it; ranking prices the at-the-money options of every bar.
+func (e *Engine) exitContext(tr *Trade, currPremium float64, bar data.Bar) ExitContext {
+	g := e.positionGreeks(tr, bar)
+	if e.ranksIV {
+		g.IVRank = e.ivRankAt(bar)
+	}
+	return ExitContext{
+		Trade:   tr,
+		Premium: currPremium,
+		Bar:     bar,
+		Greeks:  g,
+	}
+}
+
+// checkExits evaluates the engine's exit rules against a marked trade.
+//
+// Rules are checked in order: the fixed ExitSpec fields (profit target,
+// stop loss, underlying move, max days, days to expiry), then ExitSpec.Rules,
+// then Config.ExitRules.
+//
+// Returns:
+// A string describing the exit reason of the first rule that fires, or an empty string if no exits are triggered.
+func (e *Engine) checkExits(ctx ExitContext) string {
+	for _, r := range e.exits {
+		if d := r.Check(ctx); d.Exit {
+			return d.Reason
+		}
+	}
 	return ""
 }
 
@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+// ExitContext is what an ExitRule sees on each bar of an open trade.
+type ExitContext struct {
+	Trade   *Trade   // trade being evaluated, must not be modified
+	Premium float64  // current signed total premium of the trade
+	Bar     data.Bar // current simulation bar
+	Greeks  Greeks   // position greeks on the bar
+}
+
+// ExitDecision is the outcome of an ExitRule on one bar.
+type ExitDecision struct {
+	Exit   bool   // true to close the trade on this bar
+	Reason string // close reason recorded as Trade.ClosedBy
+}
+
+// ExitRule decides whether an open trade should be closed.
+//
+// Rules are evaluated on every bar after the trade has been marked to
+// market, in configuration order; the first rule that returns Exit closes
+// the trade with its Reason.
+type ExitRule interface {
+	Check(ctx ExitContext) ExitDecision
+}
+
+// ExitRuleSpec names a registered exit rule and its parameters.
+//
+// Example: {"name": "any", "rules": [{"name": "stop_loss", "params": {"pct": 100}},
+// {"name": "max_days", "params": {"days": 21}}]}
+type ExitRuleSpec struct {
+	Name   string          `json:"name"`             // registered rule name, e.g. "stop_loss", "any" or "all"
+	Params json.RawMessage `json:"params,omitempty"` // rule parameters, decoded by the rule factory
+	Rules  []ExitRuleSpec  `json:"rules,omitempty"`  // child rules of "any" and "all"
+}
+
+// ExitRuleFactory builds an exit rule from its JSON parameters.
+type ExitRuleFactory func(params json.RawMessage) (ExitRule, error)
+
+// exitRegistry maps rule names to factories; "any" and "all" are built by
+// NewExitRule from child specs and are not registered here.
+var exitRegistry = map[string]ExitRuleFactory{}
+
+// RegisterExitRule makes an exit rule available to configs under name.
+// It is meant to be called from init functions and panics if the name is
+// empty, reserved or already registered.
+func RegisterExitRule(name string, f ExitRuleFactory) {
+	name = strings.ToLower(name)
+	if name == "" || name == "any" || name == "all" {
+		panic(fmt.Sprintf("engine: invalid exit rule name %q", name))
+	}
+	if f == nil {
+		panic("engine: nil exit rule factory for " + name)
+	}
+	if _, dup := exitRegistry[name]; dup {
+		panic("engine: exit rule registered twice: " + name)
+	}
+	exitRegistry[name] = f
+}
+
+// ExitRuleNames returns the names of all registered exit rules, sorted.
+func ExitRuleNames() []string {
+	names := make([]string, 0, len(exitRegistry))
+	for name := range exitRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewExitRule builds an exit rule from its spec, recursing into the child
+// rules of "any" and "all".
+func NewExitRule(spec ExitRuleSpec) (ExitRule, error) {
+	name := strings.ToLower(spec.Name)
+	switch name {
+	case "any", "all":
+		if len(spec.Rules) == 0 {
+			return nil, fmt.Errorf("exit rule %s: no child rules", name)
+		}
+		children := make([]ExitRule, 0, len(spec.Rules))
+		for i, c := range spec.Rules {
+			r, err := NewExitRule(c)
+			if err != nil {
+				return nil, fmt.Errorf("exit rule %s[%d]: %w", name, i, err)
+			}
+			children = append(children, r)
+		}
+		if name == "any" {
+			return AnyRule(children), nil
+		}
+		return AllRule(children), nil
+	}
+
+	f, ok := exitRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown exit rule %q (registered: %s)", spec.Name, strings.Join(ExitRuleNames(), ", "))
+	}
+	r, err := f(spec.Params)
+	if err != nil {
+		return nil, fmt.Errorf("exit rule %s: %w", name, err)
+	}
+	return r, nil
+}
+
+// rules returns the exit rules described by the spec: the fixed fields
+// first, in their historical order, then the configured Rules.
+func (x ExitSpec) rules() ([]ExitRule, error) {
+	var out []ExitRule
+	if x.ProfitTargetPct != nil {
+		out = append(out, ProfitTargetRule{Pct: *x.ProfitTargetPct})
+	}
+	if x.StopLossPct != nil {
+		out = append(out, StopLossRule{Pct: *x.StopLossPct})
+	}
+	if x.UnderlyingMovePx != nil {
+		out = append(out, UnderlyingMoveRule{Px: *x.UnderlyingMovePx})
+	}
+	if x.MaxDaysInTrade != nil {
+		out = append(out, MaxDaysRule{Days: *x.MaxDaysInTrade})
+	}
+	if x.ExitByDaysToExpiry != nil {
+		out = append(out, DaysToExpiryRule{Days: *x.ExitByDaysToExpiry})
+	}
+	for i, spec := range x.Rules {
+		r, err := NewExitRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("exit.rules[%d]: %w", i, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// exitRules returns the configured exit rules followed by Config.ExitRules.
+func (cfg *Config) exitRules() ([]ExitRule, error) {
+	rules, err := cfg.Exit.rules()
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, cfg.ExitRules...), nil
+}
+
+// --------------------------------------------------------------------------------------------
+// Combinators
+// --------------------------------------------------------------------------------------------
+
+// AnyRule exits when any child rule exits, with the first child's reason.
+type AnyRule []ExitRule
+
+// Check implements ExitRule.
+func (a AnyRule) Check(ctx ExitContext) ExitDecision {
+	for _, r := range a {
+		if d := r.Check(ctx); d.Exit {
+			return d
+		}
+	}
+	return ExitDecision{}
+}
+
+// AllRule exits when every child rule exits on the same bar. The reason
+// joins the child reasons with "+".
+type AllRule []ExitRule
+
+// Check implements ExitRule.
+func (a AllRule) Check(ctx ExitContext) ExitDecision {
+	if len(a) == 0 {
+		return ExitDecision{}
+	}
+	reasons := make([]string, 0, len(a))
+	for _, r := range a {
+		d := r.Check(ctx)
+		if !d.Exit {
+			return ExitDecision{}
+		}
+		reasons = append(reasons, d.Reason)
+	}
+	return ExitDecision{Exit: true, Reason: strings.Join(reasons, "+")}
+}
+
+// --------------------------------------------------------------------------------------------
+// Built-in rules
+// --------------------------------------------------------------------------------------------
+
+// ProfitTargetRule exits once the trade has gained Pct percent of the
+// absolute open premium. For credits (negative open premium) profit occurs
+// when the premium moves toward zero; for debits when it increases. A
+// negative Pct disables the rule.
+type ProfitTargetRule struct {
+	Pct float64 `json:"pct"` // e.g. 50.0 for 50%
+}
+
+// Check implements ExitRule.
+func (r ProfitTargetRule) Check(ctx ExitContext) ExitDecision {
+	if r.Pct < 0 || changePct(ctx.Trade, ctx.Premium) < r.Pct {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("profit_target_%.2f%%", r.Pct)}
+}
+
+// StopLossRule exits once the trade has lost Pct percent of the absolute
+// open premium.
+type StopLossRule struct {
+	Pct float64 `json:"pct"` // e.g. 30.0 for 30%
+}
+
+// Check implements ExitRule.
+func (r StopLossRule) Check(ctx ExitContext) ExitDecision {
+	if changePct(ctx.Trade, ctx.Premium) > -r.Pct {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("stop_loss_%.2f%%", r.Pct)}
+}
+
+// UnderlyingMoveRule exits once the underlying has moved Px dollars in
+// either direction from its price at open.
+type UnderlyingMoveRule struct {
+	Px float64 `json:"px"` // e.g. 5.0 for a $5 move
+}
+
+// Check implements ExitRule.
+func (r UnderlyingMoveRule) Check(ctx ExitContext) ExitDecision {
+	if math.Abs(ctx.Bar.Close-ctx.Trade.UnderlyingAtOpen) < r.Px {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("underlying_move_%.2f", r.Px)}
+}
+
+// MaxDaysRule exits once the trade has been open for Days calendar days.
+type MaxDaysRule struct {
+	Days int `json:"days"` // e.g. 10 for 10 days
+}
+
+// Check implements ExitRule.
+func (r MaxDaysRule) Check(ctx ExitContext) ExitDecision {
+	days := int(math.Floor(ctx.Bar.Date.Sub(ctx.Trade.OpenDateTime).Hours() / 24))
+	if days < r.Days {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("max_days_%d", r.Days)}
+}
+
+// DaysToExpiryRule exits once any option leg has Days or fewer calendar
+// days to expiration.
+type DaysToExpiryRule struct {
+	Days int `json:"days"` // e.g. 5 for exit when any leg has ≤5 days to expiry
+}
+
+// Check implements ExitRule.
+func (r DaysToExpiryRule) Check(ctx ExitContext) ExitDecision {
+	minDays := math.MaxInt32
+	for _, leg := range ctx.Trade.Legs {
+		if leg.Spec.IsStock() {
+			continue
+		}
+		d := int(math.Ceil(leg.Expiration.Sub(ctx.Bar.Date).Hours() / 24.0))
+		if d < minDays {
+			minDays = d
+		}
+	}
+	if minDays > r.Days {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("exit_%ddays_before_expiry", r.Days)}
+}
+
+// changePct returns the P&L of a premium as a percent of the open premium
+// magnitude (or of 1 if the open premium is zero).
+func changePct(tr *Trade, premium float64) float64 {
+	base := math.Abs(tr.OpenPremium)
+	if base < 1e-9 {
+		base = 1.0
+	}
+	return (premium - tr.OpenPremium) / base * 100.0
+}
+
+// decodeRule returns a factory that decodes params into a copy of rule.
+// Rules with a validate method have it called after decoding.
+func decodeRule[R ExitRule](rule R) ExitRuleFactory {
+	return func(params json.RawMessage) (ExitRule, error) {
+		r := rule
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &r); err != nil {
+				return nil, fmt.Errorf("decode params: %w", err)
+			}
+		}
+		if v, ok := any(r).(interface{ validate() error }); ok {
+			if err := v.validate(); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	}
+}
+
+func init() {
+	RegisterExitRule("profit_target", decodeRule(ProfitTargetRule{}))
+	RegisterExitRule("stop_loss", decodeRule(StopLossRule{}))
+	RegisterExitRule("underlying_move", decodeRule(UnderlyingMoveRule{}))
+	RegisterExitRule("max_days", decodeRule(MaxDaysRule{}))
+	RegisterExitRule("days_to_expiry", decodeRule(DaysToExpiryRule{}))
+}
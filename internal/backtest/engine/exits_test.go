@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestExitRulesFromConfig(t *testing.T) {
+	var x ExitSpec
+	raw := `{
+		"profit_target_pct": 50,
+		"rules": [
+			{"name": "all", "rules": [
+				{"name": "max_days", "params": {"days": 5}},
+				{"name": "stop_loss", "params": {"pct": 20}}
+			]},
+			{"name": "any", "rules": [
+				{"name": "underlying_move", "params": {"px": 10}},
+				{"name": "days_to_expiry", "params": {"days": 2}}
+			]}
+		]
+	}`
+	if err := json.Unmarshal([]byte(raw), &x); err != nil {
+		t.Fatalf("decode exit spec: %v", err)
+	}
+	rules, err := x.rules()
+	if err != nil {
+		t.Fatalf("build rules: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 top-level rules, got %d", len(rules))
+	}
+	e := &Engine{cfg: &Config{}, exits: rules}
+
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	tr := &Trade{
+		OpenDateTime:     day,
+		UnderlyingAtOpen: 100,
+		OpenPremium:      -200,
+		Contracts:        1,
+		Legs: []st.TradeLeg{{
+			Spec:       st.LegSpec{Side: "sell", OptionType: "put", Qty: 1},
+			Strike:     95,
+			Expiration: day.AddDate(0, 0, 30),
+		}},
+	}
+
+	cases := []struct {
+		name    string
+		premium float64
+		bar     data.Bar
+		want    string
+	}{
+		{"nothing", -220, data.Bar{Date: day.AddDate(0, 0, 1), Close: 101}, ""},
+		{"legacy target first", -100, data.Bar{Date: day.AddDate(0, 0, 10), Close: 80}, "profit_target_50.00%"},
+		{"loss before max days", -260, data.Bar{Date: day.AddDate(0, 0, 2), Close: 99}, ""},
+		{"all: loss after max days", -260, data.Bar{Date: day.AddDate(0, 0, 6), Close: 99}, "max_days_5+stop_loss_20.00%"},
+		{"any: underlying move", -220, data.Bar{Date: day.AddDate(0, 0, 1), Close: 89}, "underlying_move_10.00"},
+		{"any: days to expiry", -220, data.Bar{Date: day.AddDate(0, 0, 28), Close: 99}, "exit_2days_before_expiry"},
+	}
+	for _, c := range cases {
+		if got := e.checkExits(e.exitContext(tr, c.premium, c.bar)); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+type houseRule struct{ MinDelta float64 }
+
+func (h houseRule) Check(ctx ExitContext) ExitDecision {
+	return ExitDecision{Exit: ctx.Greeks.Delta < h.MinDelta, Reason: "house_delta"}
+}
+
+func TestRegisterExitRule(t *testing.T) {
+	RegisterExitRule("test_house_delta", decodeRule(houseRule{}))
+	defer delete(exitRegistry, "test_house_delta")
+
+	r, err := NewExitRule(ExitRuleSpec{Name: "test_house_delta", Params: json.RawMessage(`{"MinDelta": -10}`)})
+	if err != nil {
+		t.Fatalf("build registered rule: %v", err)
+	}
+	if d := r.Check(ExitContext{Greeks: Greeks{Delta: -25}}); !d.Exit || d.Reason != "house_delta" {
+		t.Fatalf("expected house rule to exit, got %+v", d)
+	}
+	if d := r.Check(ExitContext{Greeks: Greeks{Delta: -5}}); d.Exit {
+		t.Fatalf("expected house rule to hold, got %+v", d)
+	}
+
+	if _, err := NewExitRule(ExitRuleSpec{Name: "no_such_rule"}); err == nil {
+		t.Fatalf("expected error for unknown rule")
+	}
+	if _, err := NewExitRule(ExitRuleSpec{Name: "any"}); err == nil {
+		t.Fatalf("expected error for combinator without children")
+	}
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+// FillSpec controls how leg fill prices are derived from market quotes.
+//
+// With UseQuotes off, every leg fills at the single price returned by the
+// provider (or Black-Scholes) and the spread is unknown. With UseQuotes on,
+// legs are marked at the quote mid and filled at mid plus MidPlusSpreadPct of
+// the spread against the trader: buys above mid, sells below. The spread is
+// then paid in the fill price, so it cannot also be charged as slippage by
+// CostSpec.SlippageSpreadPct.
+//
+// The open interest and volume guards need a provider that reports them:
+// Polygon's snapshot has both (for today's quotes only), Massive has day
+// volume but no open interest, and the synthetic and local providers have
+// neither. A quote without the figure fails a configured guard unless
+// AllowUnknownLiquidity is set.
+type FillSpec struct {
+	UseQuotes        bool     `json:"use_quotes,omitempty"`          // price legs from bid/ask quotes
+	MidPlusSpreadPct *float64 `json:"mid_plus_spread_pct,omitempty"` // 0 = mid, 50 = buy at ask / sell at bid, default: 50
+	MaxSpreadPct     float64  `json:"max_spread_pct,omitempty"`      // skip entry if a leg's spread exceeds this % of mid, 0 = off
+	MaxSpread        float64  `json:"max_spread,omitempty"`          // skip entry if a leg's spread exceeds this per share, 0 = off
+	MinOpenInterest  float64  `json:"min_open_interest,omitempty"`   // skip entry if a leg's known open interest is below this, 0 = off
+	MinVolume        float64  `json:"min_volume,omitempty"`          // skip entry if a leg's day volume is below this, 0 = off
+
+	AllowUnknownLiquidity bool `json:"allow_unknown_liquidity,omitempty"` // pass min_open_interest/min_volume when the quote does not report them
+}
+
+// legMark is the per-share valuation of one leg on a bar.
+type legMark struct {
+	Price  float64 // mid, provider or model price
+	Spread float64 // bid-ask spread, 0 if unknown
+	IV     float64 // volatility implied by Price, or the model volatility used to produce it
+}
+
+// fillPrice returns the price at which a leg fills when buying or selling.
+func (f FillSpec) fillPrice(m legMark, buying bool) float64 {
+	pct := 50.0
+	if f.MidPlusSpreadPct != nil {
+		pct = *f.MidPlusSpreadPct
+	}
+	adj := m.Spread * pct / 100.0
+	if buying {
+		return m.Price + adj
+	}
+	if m.Price-adj < 0 {
+		return 0
+	}
+	return m.Price - adj
+}
+
+// validate rejects quote-based fills together with spread slippage in the
+// cost spec: a quoted leg already fills MidPlusSpreadPct of the spread away
+// from mid, and SlippageSpreadPct would charge that spread a second time.
+func (f FillSpec) validate(c CostSpec) error {
+	if f.UseQuotes && c.SlippageSpreadPct > 0 {
+		return fmt.Errorf("use_quotes fills already cross the spread: set mid_plus_spread_pct instead of costs.slippage_spread_pct")
+	}
+	return nil
+}
+
+// guarded reports whether any liquidity threshold is configured.
+func (f FillSpec) guarded() bool {
+	return f.MaxSpreadPct > 0 || f.MaxSpread > 0 || f.MinOpenInterest > 0 || f.MinVolume > 0
+}
+
+// checkLiquidity returns an error if a quote fails a liquidity threshold.
+//
+// Quotes carry 0 for open interest and volume the provider does not report,
+// which fails a configured minimum like a true 0 does, unless
+// AllowUnknownLiquidity is set.
+func (f FillSpec) checkLiquidity(q *data.OptionQuote) error {
+	if !f.guarded() {
+		return nil
+	}
+	if q == nil {
+		return fmt.Errorf("no quote available for liquidity check")
+	}
+	spread, mid := q.Spread(), q.Mid()
+	if f.MaxSpread > 0 && spread > f.MaxSpread {
+		return fmt.Errorf("spread %.2f above max %.2f", spread, f.MaxSpread)
+	}
+	if f.MaxSpreadPct > 0 && mid > 0 && spread/mid*100.0 > f.MaxSpreadPct {
+		return fmt.Errorf("spread %.1f%% of mid above max %.1f%%", spread/mid*100.0, f.MaxSpreadPct)
+	}
+	unknown := func(v float64) bool { return v <= 0 && f.AllowUnknownLiquidity }
+	if f.MinOpenInterest > 0 && !unknown(q.OpenInterest) && q.OpenInterest < f.MinOpenInterest {
+		return fmt.Errorf("open interest %.0f below min %.0f", q.OpenInterest, f.MinOpenInterest)
+	}
+	if f.MinVolume > 0 && !unknown(q.Volume) && q.Volume < f.MinVolume {
+		return fmt.Errorf("volume %.0f below min %.0f", q.Volume, f.MinVolume)
+	}
+	return nil
+}
+
+// priceLeg values one active leg as of a date and underlying price.
+//
+// Stock legs are valued at the underlying price itself.
+// With quotes enabled the mid and spread of the provider quote are used.
+// Otherwise, or if no usable quote exists, the provider option price is used
+// with an unknown spread, falling back to Black-Scholes on historical
+// volatility when the provider has no data. The valuation carries the
+// volatility implied by the market price, or historical volatility for
+// model prices.
+//
+// Returns the leg valuation and the quote it came from (nil if none).
+func (e *Engine) priceLeg(leg st.TradeLeg, spot float64, asOf time.Time) (legMark, *data.OptionQuote) {
+	cfg := e.cfg
+	if leg.Spec.IsStock() {
+		return legMark{Price: spot}, nil
+	}
+	if cfg.Fills.UseQuotes {
+		q, err := e.prov.GetOptionQuote(cfg.Underlying, leg.Strike, leg.Expiration, leg.Spec.OptionType, asOf)
+		if err == nil && q.Mid() > 0 {
+			return legMark{Price: q.Mid(), Spread: q.Spread(), IV: e.impliedVol(leg, q.Mid(), spot, asOf)}, &q
+		}
+		logger.Debugf("option quote unavailable %s %s K=%.2f exp=%s err=%v",
+			cfg.Underlying,
+			leg.Spec.OptionType,
+			leg.Strike,
+			leg.Expiration.Format("2006-01-02"),
+			err,
+		)
+	}
+
+	p, err := e.prov.GetOptionPrice(cfg.Underlying, leg.Strike, leg.Expiration, leg.Spec.OptionType, asOf)
+	if err == nil && p > 0 {
+		return legMark{Price: p, IV: e.impliedVol(leg, p, spot, asOf)}, nil
+	}
+
+	logger.Debugf(
+		"option price fallback BS %s %s K=%.2f exp=%s err=%v",
+		cfg.Underlying,
+		leg.Spec.OptionType,
+		leg.Strike,
+		leg.Expiration.Format("2006-01-02"),
+		err,
+	)
+	p = e.modelPrice(leg, spot, asOf, e.hv) // historical volatility
+	return legMark{Price: p, IV: e.hv}, nil
+}
+
+// impliedVol returns the volatility implied by a leg's market price on the
+// dividend forward, or historical volatility if it cannot be solved for.
+func (e *Engine) impliedVol(leg st.TradeLeg, price, spot float64, asOf time.Time) float64 {
+	T := e.expiryTime(leg).Sub(asOf).Hours() / (24 * 365)
+	s, q := e.escrowedSpot(spot, asOf, e.expiryTime(leg))
+	iv, err := pricing.ImpliedVolMerton(price, s, leg.Strike, T, 0.02, q, strings.ToLower(leg.Spec.OptionType) == "call")
+	if err != nil {
+		return e.hv
+	}
+	return iv
+}
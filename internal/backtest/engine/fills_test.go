@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestFillPrice(t *testing.T) {
+	m := legMark{Price: 2.00, Spread: 0.20}
+	zero, quarter := 0.0, 25.0
+
+	tests := []struct {
+		spec     FillSpec
+		buying   bool
+		expected float64
+	}{
+		{FillSpec{}, true, 2.10},  // default: buy at ask
+		{FillSpec{}, false, 1.90}, // default: sell at bid
+		{FillSpec{MidPlusSpreadPct: &zero}, true, 2.00},
+		{FillSpec{MidPlusSpreadPct: &quarter}, true, 2.05},
+		{FillSpec{MidPlusSpreadPct: &quarter}, false, 1.95},
+	}
+
+	for _, test := range tests {
+		actual := test.spec.fillPrice(m, test.buying)
+		if math.Abs(actual-test.expected) > 1e-9 {
+			t.Fatalf("buying=%v spec=%+v: expected %f, got %f", test.buying, test.spec, test.expected, actual)
+		}
+	}
+
+	// unknown spread fills at the reference price
+	if p := (FillSpec{}).fillPrice(legMark{Price: 1.50}, true); p != 1.50 {
+		t.Fatalf("expected 1.50 with unknown spread, got %f", p)
+	}
+}
+
+func TestCheckLiquidity(t *testing.T) {
+	spec := FillSpec{MaxSpreadPct: 20, MinOpenInterest: 100}
+
+	if err := spec.checkLiquidity(&data.OptionQuote{Bid: 1.00, Ask: 1.10, OpenInterest: 500}); err != nil {
+		t.Fatalf("unexpected liquidity failure: %v", err)
+	}
+	if err := spec.checkLiquidity(&data.OptionQuote{Bid: 0.50, Ask: 0.80, OpenInterest: 500}); err == nil {
+		t.Fatalf("expected wide spread to fail")
+	}
+	if err := spec.checkLiquidity(&data.OptionQuote{Bid: 1.00, Ask: 1.10, OpenInterest: 20}); err == nil {
+		t.Fatalf("expected low open interest to fail")
+	}
+	// a quote without open interest fails the guard unless unknowns are allowed
+	if err := spec.checkLiquidity(&data.OptionQuote{Bid: 1.00, Ask: 1.10}); err == nil {
+		t.Fatalf("expected unreported open interest to fail the guard")
+	}
+	spec.AllowUnknownLiquidity = true
+	if err := spec.checkLiquidity(&data.OptionQuote{Bid: 1.00, Ask: 1.10}); err != nil {
+		t.Fatalf("unexpected failure with unknown open interest allowed: %v", err)
+	}
+	if err := spec.checkLiquidity(&data.OptionQuote{Bid: 1.00, Ask: 1.10, OpenInterest: 20}); err == nil {
+		t.Fatalf("expected reported low open interest to fail with unknowns allowed")
+	}
+	if err := spec.checkLiquidity(nil); err == nil {
+		t.Fatalf("expected missing quote to fail when guarded")
+	}
+	if err := (FillSpec{}).checkLiquidity(nil); err != nil {
+		t.Fatalf("unguarded spec should accept missing quote: %v", err)
+	}
+}
+
+func TestFillSpecValidate(t *testing.T) {
+	quotes := FillSpec{UseQuotes: true}
+	if err := quotes.validate(CostSpec{SlippageSpreadPct: 50}); err == nil {
+		t.Fatalf("expected quote fills with spread slippage to be rejected")
+	}
+	if err := quotes.validate(CostSpec{SlippageTicks: 1}); err != nil {
+		t.Fatalf("unexpected error for quote fills with tick slippage: %v", err)
+	}
+	if err := (FillSpec{}).validate(CostSpec{SlippageSpreadPct: 50}); err != nil {
+		t.Fatalf("unexpected error for spread slippage on model prices: %v", err)
+	}
+}
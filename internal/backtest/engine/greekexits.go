@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// NetDeltaRule exits once the position's net delta per strategy unit, in
+// option deltas (e.g. 0.15 for a short strangle leaning 15 deltas), reaches
+// Max in either direction.
+type NetDeltaRule struct {
+	Max float64 `json:"max"` // e.g. 0.20
+}
+
+// Check implements ExitRule.
+func (r NetDeltaRule) Check(ctx ExitContext) ExitDecision {
+	units := float64(ctx.Trade.Contracts)
+	if units <= 0 {
+		units = 1
+	}
+	if math.Abs(ctx.Greeks.Delta)/(units*ctx.Trade.contractSize()) < r.Max {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("net_delta_%.2f", r.Max)}
+}
+
+func (r NetDeltaRule) validate() error {
+	if r.Max <= 0 {
+		return fmt.Errorf("net delta max must be positive")
+	}
+	return nil
+}
+
+// ShortDeltaRule exits once any active short option leg's absolute delta reaches
+// Max, e.g. a short strike being tested at 0.30 delta.
+type ShortDeltaRule struct {
+	Max float64 `json:"max"` // e.g. 0.30
+}
+
+// Check implements ExitRule.
+func (r ShortDeltaRule) Check(ctx ExitContext) ExitDecision {
+	for i, leg := range ctx.Trade.Legs {
+		if legSign(leg) > 0 || leg.Spec.IsStock() || i >= len(ctx.Greeks.Legs) {
+			continue
+		}
+		if math.Abs(ctx.Greeks.Legs[i].Delta) >= r.Max {
+			return ExitDecision{Exit: true, Reason: fmt.Sprintf("short_delta_%.2f", r.Max)}
+		}
+	}
+	return ExitDecision{}
+}
+
+func (r ShortDeltaRule) validate() error {
+	if r.Max <= 0 || r.Max > 1 {
+		return fmt.Errorf("short delta max must be in (0, 1]")
+	}
+	return nil
+}
+
+// IVRankRule exits when the underlying's IV rank falls below Below or rises
+// above Above. IV rank places the underlying's at-the-money IV within the
+// range of its realized volatility over Config.IVRankWindow daily bars,
+// history before the start date included; the rule stays silent while that
+// range is empty.
+type IVRankRule struct {
+	Below float64 `json:"below,omitempty"` // exit when IV rank < this, e.g. 20.0, 0 = off
+	Above float64 `json:"above,omitempty"` // exit when IV rank > this, e.g. 90.0, 0 = off
+}
+
+// Check implements ExitRule.
+func (r IVRankRule) Check(ctx ExitContext) ExitDecision {
+	rank := ctx.Greeks.IVRank
+	if rank < 0 {
+		return ExitDecision{}
+	}
+	if r.Below > 0 && rank < r.Below {
+		return ExitDecision{Exit: true, Reason: fmt.Sprintf("iv_rank_below_%.2f", r.Below)}
+	}
+	if r.Above > 0 && rank > r.Above {
+		return ExitDecision{Exit: true, Reason: fmt.Sprintf("iv_rank_above_%.2f", r.Above)}
+	}
+	return ExitDecision{}
+}
+
+func (r IVRankRule) validate() error {
+	if r.Below <= 0 && r.Above <= 0 {
+		return fmt.Errorf("iv rank needs below or above")
+	}
+	return nil
+}
+
+// ThetaGammaRule exits once the position's daily theta per unit of gamma
+// falls below Min, i.e. the decay collected no longer pays for the
+// convexity risk carried. Positions without gamma are left alone.
+type ThetaGammaRule struct {
+	Min float64 `json:"min"` // minimum |theta| / |gamma|, e.g. 5.0
+}
+
+// Check implements ExitRule.
+func (r ThetaGammaRule) Check(ctx ExitContext) ExitDecision {
+	gamma := math.Abs(ctx.Greeks.Gamma)
+	if gamma < 1e-9 || math.Abs(ctx.Greeks.Theta)/gamma >= r.Min {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("theta_gamma_below_%.2f", r.Min)}
+}
+
+func (r ThetaGammaRule) validate() error {
+	if r.Min <= 0 {
+		return fmt.Errorf("theta gamma min must be positive")
+	}
+	return nil
+}
+
+func init() {
+	RegisterExitRule("net_delta", decodeRule(NetDeltaRule{}))
+	RegisterExitRule("short_delta", decodeRule(ShortDeltaRule{}))
+	RegisterExitRule("iv_rank", decodeRule(IVRankRule{}))
+	RegisterExitRule("theta_gamma", decodeRule(ThetaGammaRule{}))
+}
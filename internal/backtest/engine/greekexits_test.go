@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+func TestGreekExitRules(t *testing.T) {
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	exp := day.AddDate(0, 0, 45)
+	e := &Engine{cfg: &Config{}, hv: 0.20}
+
+	// short strangle, 2 units
+	tr := &Trade{
+		Contracts: 2,
+		Legs: []st.TradeLeg{
+			{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 90, Expiration: exp},
+			{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 110, Expiration: exp},
+		},
+	}
+
+	// implied vol round-trips through the leg mark
+	T := exp.Sub(day).Hours() / (24 * 365)
+	p := pricing.BlackScholesPrice(100, 110, T, 0.02, 0.35, true)
+	if iv := e.impliedVol(tr.Legs[1], p, 100, day); math.Abs(iv-0.35) > 1e-4 {
+		t.Fatalf("expected implied vol 0.35, got %.6f", iv)
+	}
+
+	shortDelta := ShortDeltaRule{Max: 0.30}
+	netDelta := NetDeltaRule{Max: 0.20}
+	thetaGamma := ThetaGammaRule{Min: 0.5}
+
+	// balanced at the open: nothing fires
+	flat := e.positionGreeks(tr, data.Bar{Date: day, Close: 100})
+	if math.Abs(flat.Delta)/200 > 0.05 {
+		t.Fatalf("expected near delta-neutral strangle, got %.2f", flat.Delta)
+	}
+	if flat.Theta <= 0 || flat.Gamma >= 0 || flat.Vega >= 0 {
+		t.Fatalf("expected short premium greeks, got %+v", flat)
+	}
+	ctx := ExitContext{Trade: tr, Greeks: flat}
+	for _, r := range []ExitRule{shortDelta, netDelta, thetaGamma} {
+		if d := r.Check(ctx); d.Exit {
+			t.Fatalf("unexpected exit at open: %+v", d)
+		}
+	}
+
+	// rally tests the short call
+	tested := e.positionGreeks(tr, data.Bar{Date: day.AddDate(0, 0, 10), Close: 108})
+	ctx = ExitContext{Trade: tr, Greeks: tested}
+	if d := shortDelta.Check(ctx); d.Reason != "short_delta_0.30" {
+		t.Fatalf("expected short delta exit, got %+v (call delta %.3f)", d, tested.Legs[1].Delta)
+	}
+	if d := netDelta.Check(ctx); d.Reason != "net_delta_0.20" {
+		t.Fatalf("expected net delta exit, got %+v (delta %.2f)", d, tested.Delta)
+	}
+
+	// short gamma earns about ½σ²S²/365 of theta per unit of gamma: ~0.55 at 20% vol
+	if d := (ThetaGammaRule{Min: 0.6}).Check(ExitContext{Trade: tr, Greeks: flat}); d.Reason != "theta_gamma_below_0.60" {
+		t.Fatalf("expected theta/gamma exit, got %+v (ratio %.3f)", d, flat.Theta/flat.Gamma)
+	}
+}
+
+func TestIVRankRule(t *testing.T) {
+	// 40 flat days, 30 days of 2% swings, then 30 flat days
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var days []data.Bar
+	close := 100.0
+	for i := 0; i < 100; i++ {
+		if i >= 40 && i < 70 {
+			close *= math.Exp(0.02 * float64(1-2*(i%2)))
+		}
+		days = append(days, data.Bar{Date: start.AddDate(0, 0, i), Close: close})
+	}
+	// no expiries: the underlying's IV falls back to its realized volatility
+	e := &Engine{cfg: &Config{Underlying: "SPY"}, history: days}
+	r := IVRankRule{Below: 20, Above: 90}
+
+	if rank := e.ivRankAt(days[39]); rank != -1 {
+		t.Fatalf("expected no rank over flat history, got %.2f", rank)
+	}
+	g := Greeks{IVRank: e.ivRankAt(days[69])}
+	if d := r.Check(ExitContext{Greeks: g}); g.IVRank < 99 || d.Reason != "iv_rank_above_90.00" {
+		t.Fatalf("expected a top rank at the end of the swings, got %.2f and %+v", g.IVRank, d)
+	}
+	g = Greeks{IVRank: e.ivRankAt(days[99])}
+	if d := r.Check(ExitContext{Greeks: g}); g.IVRank != 0 || d.Reason != "iv_rank_below_20.00" {
+		t.Fatalf("expected rank 0 once calm again, got %.2f and %+v", g.IVRank, d)
+	}
+
+	// the swings are out of a 10-day lookback, which has no range
+	e = &Engine{cfg: &Config{Underlying: "SPY", IVRankWindow: 10}, history: days}
+	g = Greeks{IVRank: e.ivRankAt(days[99])}
+	if g.IVRank != -1 || r.Check(ExitContext{Greeks: g}).Exit {
+		t.Fatalf("expected no rank over the calm lookback, got %.2f", g.IVRank)
+	}
+}
+
+func TestIVRankHistory(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	prov := data.NewSyntheticProvider()
+	e := NewEngine(&Config{Underlying: "SPY"}, prov)
+	e.cfg.Entry.StartDate = start
+	bars, err := prov.GetBars("SPY", start, start.AddDate(0, 1, 0), 1, "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := e.loadHistory(bars)
+	if n := len(h) - len(bars); n < 252+hvWindow || !h[n-1].Date.Before(start) || !h[n].Date.Equal(bars[0].Date) {
+		t.Fatalf("expected a year of bars before %s, got %d", start.Format("2006-01-02"), n)
+	}
+}
+
+// atmCounter counts the at-the-money option prices asked of a provider.
+type atmCounter struct {
+	data.Provider
+	calls int
+}
+
+func (p *atmCounter) GetATMOptionPrices(underlying string, expiry, tradeDate time.Time, spot float64) (float64, float64, float64, error) {
+	p.calls++
+	return p.Provider.GetATMOptionPrices(underlying, expiry, tradeDate, spot)
+}
+
+func TestIVRankOnlyWhenRead(t *testing.T) {
+	nested, err := NewExitRule(ExitRuleSpec{Name: "all", Rules: []ExitRuleSpec{
+		{Name: "max_days", Params: json.RawMessage(`{"days": 3}`)},
+		{Name: "any", Rules: []ExitRuleSpec{{Name: "iv_rank", Params: json.RawMessage(`{"above": 80}`)}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := NewExitRule(ExitRuleSpec{Name: "max_days", Params: json.RawMessage(`{"days": 3}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !usesIVRank([]ExitRule{plain, nested}) || usesIVRank([]ExitRule{plain, AnyRule{plain}}) {
+		t.Fatal("expected only the nested iv_rank rule to read the IV rank")
+	}
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	prov := &atmCounter{Provider: data.NewSyntheticProvider()}
+	days, err := prov.GetBars("SPY", start, start.AddDate(0, 2, 0), 1, "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{cfg: &Config{Underlying: "SPY"}, prov: prov, expiries: []time.Time{start.AddDate(0, 3, 0)}, history: days}
+	tr := &Trade{}
+	bar := days[len(days)-1]
+	if g := e.exitContext(tr, 0, bar).Greeks; g.IVRank != -1 || prov.calls != 0 {
+		t.Fatalf("expected no IV rank without a rule reading it, got %.2f after %d ATM calls", g.IVRank, prov.calls)
+	}
+	e.ranksIV = true
+	if g := e.exitContext(tr, 0, bar).Greeks; g.IVRank < 0 || prov.calls != 1 {
+		t.Fatalf("expected an IV rank from one ATM call, got %.2f after %d", g.IVRank, prov.calls)
+	}
+}
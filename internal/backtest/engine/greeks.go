@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"math"
+	"strings"
+
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+// LegGreeks are the per-share Black-Scholes sensitivities of one long
+// contract of a leg, at the volatility used to value it. Stock legs have a
+// Delta of 1 and nothing else.
+type LegGreeks struct {
+	Delta float64 // per $1 underlying move, in [-1, 1]
+	Gamma float64 // change in Delta per $1 underlying move
+	Theta float64 // price change per calendar day
+	Vega  float64 // price change per 1 point (1%) rise in volatility
+	Rho   float64 // price change per 1 point (1%) rise in the risk-free rate
+	Vanna float64 // change in Delta per 1 point rise in volatility
+	Charm float64 // change in Delta per calendar day
+	Volga float64 // change in Vega per 1 point rise in volatility
+	Speed float64 // change in Gamma per $1 underlying move
+	IV    float64 // volatility the leg is valued at, 0 once expired
+}
+
+// Greeks are the Black-Scholes sensitivities of a whole position, signed by
+// leg side and scaled by leg quantity, strategy units and the leg multiplier
+// (100 shares per option contract, 1 per share of stock).
+type Greeks struct {
+	Delta  float64     // share-equivalent exposure to a $1 underlying move
+	Gamma  float64     // change in Delta for a $1 underlying move
+	Theta  float64     // dollar P&L per calendar day from time decay
+	Vega   float64     // dollar P&L per 1 point (1%) rise in volatility
+	Rho    float64     // dollar P&L per 1 point (1%) rise in the risk-free rate
+	Vanna  float64     // change in Delta per 1 point rise in volatility
+	Charm  float64     // change in Delta per calendar day
+	Volga  float64     // change in Vega per 1 point rise in volatility
+	Speed  float64     // change in Gamma per $1 underlying move
+	IV     float64     // vega-weighted volatility of the active legs
+	IVRank float64     // underlying's IV rank over Config.IVRankWindow, in percent, -1 if no range yet or no iv_rank rule
+	Legs   []LegGreeks // per-leg greeks, aligned with Trade.Legs
+}
+
+// positionGreeks computes the greeks of a trade on a bar.
+//
+// Active legs are valued at the bar close and at the volatility of their
+// latest mark (implied from the market price, or historical volatility for
+// model prices), all in one pricing.ChainGreeks call; legs that have reached
+// expiration carry no greeks and a share of stock carries a delta of 1.
+// IVRank is left for the caller (see ivRankAt).
+func (e *Engine) positionGreeks(tr *Trade, b data.Bar) Greeks {
+	g := Greeks{IVRank: -1, Legs: make([]LegGreeks, len(tr.Legs))}
+	e.chain = e.chain[:0]
+	active := make([]int, 0, len(tr.Legs))
+	for i, leg := range tr.Legs {
+		if leg.Spec.IsStock() {
+			g.Legs[i] = LegGreeks{Delta: 1}
+			g.Delta += legSign(leg) * float64(leg.Spec.Qty) * float64(tr.Contracts)
+			continue
+		}
+		if e.legExpired(leg, b.Date) {
+			continue
+		}
+		iv := e.hv
+		if i < len(tr.legPrices) && tr.legPrices[i].IV > 0 {
+			iv = tr.legPrices[i].IV
+		}
+		pv, _ := e.dividendTerms(b.Date, e.expiryTime(leg))
+		e.chain = append(e.chain, pricing.Option{
+			K:      leg.Strike,
+			T:      e.expiryTime(leg).Sub(b.Date).Hours() / (24 * 365),
+			Sigma:  iv,
+			Div:    pv,
+			IsCall: strings.ToLower(leg.Spec.OptionType) == "call",
+		})
+		active = append(active, i)
+	}
+
+	//TODO: risk-free rate from provider or config - using 2% fixed here
+	e.chainGreeks = pricing.ChainGreeks(e.chainGreeks, b.Close, 0.02, e.product().DividendYield, e.chain)
+	weight := 0.0
+	for j, i := range active {
+		leg, bs, iv := tr.Legs[i], e.chainGreeks[j], e.chain[j].Sigma
+		lg := LegGreeks{
+			Delta: bs.Delta,
+			Gamma: bs.Gamma,
+			Theta: bs.Theta / 365.0,
+			Vega:  bs.Vega / 100.0,
+			Rho:   bs.Rho / 100.0,
+			Vanna: bs.Vanna / 100.0,
+			Charm: bs.Charm / 365.0,
+			Volga: bs.Volga / 10000.0,
+			Speed: bs.Speed,
+			IV:    iv,
+		}
+		g.Legs[i] = lg
+
+		n := legSign(leg) * float64(leg.Spec.Qty) * float64(tr.Contracts) * legMultiplier(leg)
+		g.Delta += n * lg.Delta
+		g.Gamma += n * lg.Gamma
+		g.Theta += n * lg.Theta
+		g.Vega += n * lg.Vega
+		g.Rho += n * lg.Rho
+		g.Vanna += n * lg.Vanna
+		g.Charm += n * lg.Charm
+		g.Volga += n * lg.Volga
+		g.Speed += n * lg.Speed
+
+		w := math.Abs(n) * lg.Vega
+		g.IV += w * iv
+		weight += w
+	}
+	if weight > 1e-12 {
+		g.IV /= weight
+	}
+	return g
+}
+
+// contractSize returns the multiplier of the trade's option contracts, which
+// converts share-equivalent deltas to option deltas; 100 without options.
+func (tr *Trade) contractSize() float64 {
+	for _, leg := range tr.Legs {
+		if !leg.Spec.IsStock() {
+			return legMultiplier(leg)
+		}
+	}
+	return 100.0
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+const (
+	HedgeOff      = "off"       // no delta hedging (default)
+	HedgeBand     = "band"      // rebalance when net delta leaves Target ± Band
+	HedgeEveryBar = "every_bar" // rebalance on every bar
+	HedgeDaily    = "daily"     // rebalance on the first bar of each trading day
+	HedgeMove     = "move"      // rebalance once the underlying moved MovePct since the last rebalance
+)
+
+// HedgeSpec enables dynamic delta hedging with shares of the underlying.
+//
+// While a trade is open the engine holds a stock leg flagged TradeLeg.Hedge,
+// sized in whole shares per strategy unit, and rebalances it so that the
+// position's net delta per unit, in option deltas, returns to Target. The
+// first rebalance happens when the trade opens. Hedge shares are part of the
+// position: they count in its greeks, mark and exits, and are sold or bought
+// back when the trade closes.
+//
+// Example, gamma scalping a long straddle on 1% moves:
+// {"mode": "move", "move_pct": 1.0}
+type HedgeSpec struct {
+	Mode    string  `json:"mode,omitempty"`     // "off", "band", "every_bar", "daily" or "move", default: "off"
+	Band    float64 `json:"band,omitempty"`     // band: max |net delta - target| per unit in option deltas, e.g. 0.10
+	MovePct float64 `json:"move_pct,omitempty"` // move: underlying move since the last rebalance, e.g. 1.0 for 1%
+	Target  float64 `json:"target,omitempty"`   // net delta per unit to rebalance to, in option deltas, default: 0
+}
+
+// HedgeTrade is a dated record of one hedge rebalance.
+type HedgeTrade struct {
+	Date     time.Time // bar date of the rebalance
+	Shares   int       // shares bought (+) or sold (-) for all units
+	Price    float64   // fill price per share
+	Position int       // hedge shares held afterwards for all units, short < 0
+	Delta    float64   // net position delta before the rebalance, in shares
+	Costs    Costs     // transaction costs of the order
+}
+
+// enabled reports whether a hedging mode is configured.
+func (h HedgeSpec) enabled() bool {
+	m := strings.ToLower(h.Mode)
+	return m != "" && m != HedgeOff
+}
+
+func (h HedgeSpec) validate() error {
+	switch strings.ToLower(h.Mode) {
+	case "", HedgeOff, HedgeEveryBar, HedgeDaily:
+	case HedgeBand:
+		if h.Band <= 0 {
+			return fmt.Errorf("band hedging needs a positive band")
+		}
+	case HedgeMove:
+		if h.MovePct <= 0 {
+			return fmt.Errorf("move hedging needs a positive move_pct")
+		}
+	default:
+		return fmt.Errorf("unknown hedge mode %q", h.Mode)
+	}
+	return nil
+}
+
+// hedgeLeg returns the index of the trade's hedge leg, or -1 if it has none.
+func (tr *Trade) hedgeLeg() int {
+	for i, leg := range tr.Legs {
+		if leg.Hedge {
+			return i
+		}
+	}
+	return -1
+}
+
+// hedgeDue reports whether the hedge is rebalanced on a bar given the
+// position greeks.
+func (e *Engine) hedgeDue(tr *Trade, b data.Bar, g Greeks) bool {
+	h := e.cfg.Hedge
+	switch strings.ToLower(h.Mode) {
+	case HedgeEveryBar:
+		return true
+	case HedgeDaily:
+		return tr.hedgeDay != e.dayKey(b)
+	case HedgeMove:
+		return tr.hedgeSpot <= 0 || math.Abs(b.Close/tr.hedgeSpot-1)*100.0 >= h.MovePct
+	case HedgeBand:
+		units := math.Max(float64(tr.Contracts), 1)
+		return math.Abs(g.Delta/(units*tr.contractSize())-h.Target) > h.Band
+	}
+	return false
+}
+
+// hedgeTrade rebalances the hedge of a trade on a bar when due. g holds the
+// position greeks on the bar, including the current hedge shares.
+//
+// Shares trade at the bar close. The hedge leg is value-neutral when it is
+// resized: the cash paid or received goes to Trade.HedgePremium, so that the
+// trade's P&L carries on from the same mark.
+//
+// Returns true if shares were traded.
+func (e *Engine) hedgeTrade(tr *Trade, b data.Bar, g Greeks) bool {
+	if !e.hedgeDue(tr, b, g) {
+		return false
+	}
+	tr.hedgeDay, tr.hedgeSpot = e.dayKey(b), b.Close
+
+	units := tr.Contracts
+	if units <= 0 {
+		units = 1
+	}
+	i := tr.hedgeLeg()
+	held := 0
+	if i >= 0 {
+		held = int(legSign(tr.Legs[i])) * tr.Legs[i].Spec.Qty
+	}
+	// shares per unit that bring the option delta back to target
+	options := g.Delta/float64(units) - float64(held)
+	want := int(math.Round(e.cfg.Hedge.Target*tr.contractSize() - options))
+	if want == held {
+		return false
+	}
+
+	if i < 0 {
+		tr.Legs = append(tr.Legs, st.TradeLeg{Spec: st.LegSpec{OptionType: st.LegStock}, Hedge: true})
+		tr.legPrices = append(tr.legPrices, legMark{})
+		i = len(tr.Legs) - 1
+	}
+	m := legMark{Price: b.Close}
+	buying := want > held
+	p := e.cfg.Fills.fillPrice(m, buying)
+	traded := (want - held) * units
+
+	side := "buy"
+	if want < 0 {
+		side = "sell"
+	}
+	leg := &tr.Legs[i]
+	leg.Spec.Side, leg.Spec.Qty = side, absInt(want)
+	leg.OpenPremium = p
+	tr.legPrices[i] = m
+
+	fill := Fill{Leg: *leg, Qty: absInt(traded), Price: m.Price, Opening: true}
+	ht := HedgeTrade{
+		Date:     b.Date,
+		Shares:   traded,
+		Price:    p,
+		Position: want * units,
+		Delta:    g.Delta,
+		Costs:    e.cfg.costModel().OrderCost([]Fill{fill}),
+	}
+	tr.HedgeTrades = append(tr.HedgeTrades, ht)
+	tr.HedgePremium -= float64(traded) * p
+	tr.HedgeCosts = tr.HedgeCosts.Add(ht.Costs)
+	logger.Debugf("trade %d hedge %+d shares at %.2f on %s delta=%.2f position=%d",
+		tr.ID,
+		ht.Shares,
+		ht.Price,
+		b.Date.Format("2006-01-02 15:04"),
+		ht.Delta,
+		ht.Position,
+	)
+	return true
+}
+
+// settleHedge splits a closed trade's gross P&L into hedge and option P&L.
+func (tr *Trade) settleHedge() {
+	tr.HedgePnL = tr.HedgePremium
+	if i := tr.hedgeLeg(); i >= 0 {
+		leg := tr.Legs[i]
+		tr.HedgePnL += legSign(leg) * leg.ClosePremium * float64(leg.Spec.Qty) * float64(tr.Contracts)
+	}
+	tr.OptionPnL = tr.GrossPnL - tr.HedgePnL
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestHedgeTrade(t *testing.T) {
+	day := time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)
+	exp := day.AddDate(0, 0, 28)
+	cfg := &Config{Hedge: HedgeSpec{Mode: HedgeMove, MovePct: 1}}
+	e := &Engine{cfg: cfg, prov: data.NewSyntheticProvider(), hv: 0.25, expiries: []time.Time{exp}}
+
+	// long straddle, gamma scalped on 1% moves
+	legs := []st.TradeLeg{
+		{Spec: st.LegSpec{Side: "buy", OptionType: "call", Qty: 1}, Strike: 100, Expiration: exp},
+		{Spec: st.LegSpec{Side: "buy", OptionType: "put", Qty: 1}, Strike: 100, Expiration: exp},
+	}
+	open := data.Bar{Date: day, Close: 102}
+	tr := &Trade{ID: 1, OpenDateTime: day, UnderlyingAtOpen: 102, Legs: legs, Contracts: 2}
+	tr.OpenPremium, tr.legPrices = e.markTrade(tr, open)
+	for i := range tr.Legs {
+		tr.Legs[i].OpenPremium = tr.legPrices[i].Price
+	}
+	tr.mark, tr.HighPremium, tr.LowPremium = tr.OpenPremium, tr.OpenPremium, tr.OpenPremium
+
+	netDelta := func(b data.Bar) float64 { return e.positionGreeks(tr, b).Delta / 2 / 100 }
+	if !e.hedgeTrade(tr, open, e.positionGreeks(tr, open)) {
+		t.Fatalf("expected an opening hedge")
+	}
+	if h := tr.hedgeLeg(); h < 0 || tr.Legs[h].Spec.Side != "sell" || tr.HedgeTrades[0].Shares >= 0 {
+		t.Fatalf("expected short shares against the in-the-money call, got %+v", tr.HedgeTrades)
+	}
+	if d := netDelta(open); math.Abs(d) > 0.01 {
+		t.Fatalf("expected flat delta after hedging, got %.4f", d)
+	}
+	if mark, _ := e.markTrade(tr, open); math.Abs(mark-tr.OpenPremium) > 1e-9 {
+		t.Fatalf("expected hedging to leave the mark at %.4f, got %.4f", tr.OpenPremium, mark)
+	}
+
+	// small move: no rebalance
+	if e.updateTrade(tr, data.Bar{Date: day.AddDate(0, 0, 1), Close: 102.5}) || len(tr.HedgeTrades) != 1 {
+		t.Fatalf("expected no rebalance on a 0.5%% move, got %+v", tr.HedgeTrades)
+	}
+
+	// rally: sell more shares, rebalanced back to flat
+	rally := data.Bar{Date: day.AddDate(0, 0, 2), Close: 105}
+	if e.updateTrade(tr, rally) || len(tr.HedgeTrades) != 2 || tr.HedgeTrades[1].Shares >= 0 {
+		t.Fatalf("expected a sell rebalance on the rally, got %+v", tr.HedgeTrades)
+	}
+	if d := netDelta(rally); math.Abs(d) > 0.01 {
+		t.Fatalf("expected flat delta after rebalancing, got %.4f", d)
+	}
+
+	// hedge and option P&L split the gross P&L
+	end := data.Bar{Date: day.AddDate(0, 0, 3), Close: 101}
+	e.closeTrade(tr, end, mustMarks(e, tr, end.Close, end.Date), "test")
+	hedge := 0.0
+	for _, ht := range tr.HedgeTrades {
+		hedge += float64(ht.Shares) * (end.Close - ht.Price)
+	}
+	if math.Abs(tr.HedgePnL-hedge) > 1e-6 {
+		t.Fatalf("expected hedge P&L %.4f, got %.4f", hedge, tr.HedgePnL)
+	}
+	options := 0.0
+	for _, leg := range tr.Legs {
+		if !leg.Hedge {
+			options += legSign(leg) * (leg.ClosePremium - leg.OpenPremium) * 2 * 100.0
+		}
+	}
+	if math.Abs(tr.OptionPnL-options) > 1e-6 {
+		t.Fatalf("expected option P&L %.4f, got %.4f", options, tr.OptionPnL)
+	}
+	if math.Abs(tr.GrossPnL-tr.HedgePnL-tr.OptionPnL) > 1e-9 {
+		t.Fatalf("expected gross P&L %.4f to split into hedge and options", tr.GrossPnL)
+	}
+}
+
+func TestHedgeDue(t *testing.T) {
+	day := time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)
+	b := data.Bar{Date: day, Close: 100}
+	tr := &Trade{Contracts: 2, hedgeDay: "2025-03-07", hedgeSpot: 99.5}
+
+	cases := []struct {
+		spec  HedgeSpec
+		delta float64
+		want  bool
+	}{
+		{HedgeSpec{Mode: HedgeEveryBar}, 0, true},
+		{HedgeSpec{Mode: HedgeDaily}, 0, false},
+		{HedgeSpec{Mode: HedgeMove, MovePct: 1}, 0, false},
+		{HedgeSpec{Mode: HedgeMove, MovePct: 0.5}, 0, true},
+		{HedgeSpec{Mode: HedgeBand, Band: 0.10}, 15, false},
+		{HedgeSpec{Mode: HedgeBand, Band: 0.10}, -25, true},
+		{HedgeSpec{Mode: HedgeBand, Band: 0.10, Target: -0.10}, -25, false},
+	}
+	for _, c := range cases {
+		e := &Engine{cfg: &Config{Hedge: c.spec}}
+		if got := e.hedgeDue(tr, b, Greeks{Delta: c.delta}); got != c.want {
+			t.Errorf("%+v delta=%.0f: expected %v, got %v", c.spec, c.delta, c.want, got)
+		}
+	}
+
+	if err := (HedgeSpec{Mode: HedgeBand}).validate(); err == nil {
+		t.Errorf("expected error for band without a band")
+	}
+	if err := (HedgeSpec{Mode: "weekly"}).validate(); err == nil {
+		t.Errorf("expected error for unknown mode")
+	}
+}
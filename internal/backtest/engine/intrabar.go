@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"math"
+	"strings"
+
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+const (
+	IntrabarOff         = "off"         // evaluate exits on the bar close only (default)
+	IntrabarPessimistic = "pessimistic" // stop wins when both stop and target are crossed in a bar
+	IntrabarOptimistic  = "optimistic"  // target wins when both stop and target are crossed in a bar
+
+	TieBreakStopFirst   = "stop_first"   // stop wins ties
+	TieBreakTargetFirst = "target_first" // target wins ties
+	TieBreakBarPath     = "bar_path"     // up bars go O-L-H-C, down bars go O-H-L-C
+)
+
+// IntrabarSpec enables stop and target evaluation at the bar's high and low.
+type IntrabarSpec struct {
+	Mode     string `json:"mode,omitempty"`      // "off", "pessimistic" or "optimistic", default: "off"
+	TieBreak string `json:"tie_break,omitempty"` // "stop_first", "target_first" or "bar_path", default: from Mode
+}
+
+// tieBreak returns the effective tie-break rule.
+func (s IntrabarSpec) tieBreak() string {
+	switch strings.ToLower(s.TieBreak) {
+	case TieBreakStopFirst, TieBreakTargetFirst, TieBreakBarPath:
+		return strings.ToLower(s.TieBreak)
+	}
+	if strings.ToLower(s.Mode) == IntrabarOptimistic {
+		return TieBreakTargetFirst
+	}
+	return TieBreakStopFirst
+}
+
+// enabled reports whether intrabar evaluation is on.
+func (s IntrabarSpec) enabled() bool {
+	m := strings.ToLower(s.Mode)
+	return m == IntrabarPessimistic || m == IntrabarOptimistic
+}
+
+// intrabarHit is a stop or target crossing at one extreme of a bar.
+type intrabarHit struct {
+	extreme string  // "H" or "L"
+	stop    bool    // true for stop loss, false for profit target
+	reason  string  // exit reason
+	spot    float64 // underlying price at which the threshold is crossed
+}
+
+// checkIntrabar looks for a stop or target crossed inside the bar.
+//
+// The position is repriced at the bar's high and low underlying price by
+// shifting each active leg's close mark by the Black-Scholes price change
+// between the close and the extreme; expired legs use intrinsic value. If
+// both a stop and a target are crossed, the tie-break rule decides which one
+// happened first. The exit fills where the threshold is crossed on the way
+// from the bar open to the extreme, found by bisection, or at the open if
+// the bar gapped through it.
+//
+// Returns the exit, the leg marks at the fill, and the assumed path
+// (e.g. "O-L-H-C"); the exit is nil if nothing was crossed.
+func (e *Engine) checkIntrabar(tr *Trade, b data.Bar, closeMarks []legMark) (*intrabarHit, []legMark, string) {
+	var hits []intrabarHit
+	for _, ext := range []struct {
+		name string
+		spot float64
+	}{{"H", b.High}, {"L", b.Low}} {
+		if ext.spot <= 0 {
+			continue
+		}
+		premium := e.premiumAt(tr, e.marksAt(tr, b, closeMarks, ext.spot))
+		if reason, ok := stopHit(tr, premium, e.cfg.Exit); ok {
+			hits = append(hits, intrabarHit{extreme: ext.name, stop: true, reason: reason, spot: ext.spot})
+		}
+		if reason, ok := targetHit(tr, premium, e.cfg.Exit); ok {
+			hits = append(hits, intrabarHit{extreme: ext.name, stop: false, reason: reason, spot: ext.spot})
+		}
+	}
+	if len(hits) == 0 {
+		return nil, nil, ""
+	}
+
+	// pick the hit that happened first under the tie-break rule
+	first := hits[0]
+	switch e.cfg.Intrabar.tieBreak() {
+	case TieBreakBarPath:
+		// up bars visit the low first, down bars the high first
+		lead := "H"
+		if b.Close >= b.Open {
+			lead = "L"
+		}
+		found := false
+		for _, h := range hits {
+			if h.extreme == lead && (!found || h.stop) {
+				first, found = h, true
+			}
+		}
+		if !found {
+			first = hits[0]
+		}
+	case TieBreakTargetFirst:
+		for _, h := range hits {
+			if !h.stop {
+				first = h
+				break
+			}
+		}
+	default:
+		for _, h := range hits {
+			if h.stop {
+				first = h
+				break
+			}
+		}
+	}
+
+	path := "O-H-L-C"
+	if first.extreme == "L" {
+		path = "O-L-H-C"
+	}
+
+	crossed := func(spot float64) bool {
+		premium := e.premiumAt(tr, e.marksAt(tr, b, closeMarks, spot))
+		if first.stop {
+			_, ok := stopHit(tr, premium, e.cfg.Exit)
+			return ok
+		}
+		_, ok := targetHit(tr, premium, e.cfg.Exit)
+		return ok
+	}
+
+	// gap through the threshold fills at the open
+	from := b.Open
+	if from <= 0 || crossed(from) {
+		if from <= 0 {
+			from = first.spot
+		}
+		first.spot = from
+		return &first, e.marksAt(tr, b, closeMarks, from), path
+	}
+
+	lo, hi := from, first.spot
+	for i := 0; i < 40; i++ {
+		mid := (lo + hi) / 2
+		if crossed(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	first.spot = hi
+	return &first, e.marksAt(tr, b, closeMarks, hi), path
+}
+
+// marksAt reprices the trade's legs at an underlying price within a bar,
+// anchored on the bar's close marks and their volatilities.
+func (e *Engine) marksAt(tr *Trade, b data.Bar, closeMarks []legMark, spot float64) []legMark {
+	out := make([]legMark, len(tr.Legs))
+	for i, leg := range tr.Legs {
+		if leg.Spec.IsStock() {
+			out[i] = legMark{Price: spot}
+			continue
+		}
+		if e.legExpired(leg, b.Date) {
+			out[i] = e.expiredMark(leg, b)
+			continue
+		}
+		iv := closeMarks[i].IV
+		if iv <= 0 {
+			iv = e.hv
+		}
+		shift := e.modelPrice(leg, spot, b.Date, iv) - e.modelPrice(leg, b.Close, b.Date, iv)
+		out[i] = legMark{Price: math.Max(0, closeMarks[i].Price+shift), Spread: closeMarks[i].Spread, IV: iv}
+	}
+	return out
+}
+
+// premiumAt returns the signed total premium of a trade for given leg marks,
+// including the premium realized by adjustments and hedge rebalances.
+func (e *Engine) premiumAt(tr *Trade, marks []legMark) float64 {
+	total := tr.AdjustmentPremium + tr.HedgePremium
+	for i, leg := range tr.Legs {
+		total += legSign(leg) * marks[i].Price * float64(leg.Spec.Qty) * float64(tr.Contracts) * legMultiplier(leg)
+	}
+	return total
+}
+
+// targetHit reports whether a premium reaches the profit target.
+func targetHit(tr *Trade, premium float64, x ExitSpec) (string, bool) {
+	if x.ProfitTargetPct == nil {
+		return "", false
+	}
+	d := ProfitTargetRule{Pct: *x.ProfitTargetPct}.Check(ExitContext{Trade: tr, Premium: premium})
+	return d.Reason, d.Exit
+}
+
+// stopHit reports whether a premium reaches the stop loss.
+func stopHit(tr *Trade, premium float64, x ExitSpec) (string, bool) {
+	if x.StopLossPct == nil {
+		return "", false
+	}
+	d := StopLossRule{Pct: *x.StopLossPct}.Check(ExitContext{Trade: tr, Premium: premium})
+	return d.Reason, d.Exit
+}
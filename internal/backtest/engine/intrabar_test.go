@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+func TestCheckIntrabar(t *testing.T) {
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	leg := st.TradeLeg{
+		Spec:       st.LegSpec{Side: "sell", OptionType: "put", Qty: 1},
+		Strike:     100,
+		Expiration: day.AddDate(0, 0, 30),
+	}
+	T := leg.Expiration.Sub(day).Hours() / (24 * 365)
+	price := func(spot float64) float64 { return pricing.BlackScholesPrice(spot, 100, T, 0.02, 0.25, false) }
+
+	stop, target := 100.0, 50.0
+	newEngine := func(spec IntrabarSpec) *Engine {
+		return &Engine{
+			cfg: &Config{Exit: ExitSpec{StopLossPct: &stop, ProfitTargetPct: &target}, Intrabar: spec},
+			hv:  0.25,
+		}
+	}
+	newTrade := func() *Trade {
+		open := -price(100) * 100
+		return &Trade{Legs: []st.TradeLeg{leg}, Contracts: 1, OpenPremium: open}
+	}
+
+	// the low breaches the stop, the close does not
+	b := data.Bar{Date: day, Open: 100, High: 101, Low: 92, Close: 99}
+	closeMarks := []legMark{{Price: price(b.Close)}}
+	e := newEngine(IntrabarSpec{Mode: IntrabarPessimistic})
+	tr := newTrade()
+	if reason, ok := stopHit(tr, e.premiumAt(tr, closeMarks), e.cfg.Exit); ok {
+		t.Fatalf("close should not hit the stop, got %s", reason)
+	}
+	hit, marks, path := e.checkIntrabar(tr, b, closeMarks)
+	if hit == nil || !hit.stop {
+		t.Fatalf("expected intrabar stop, got %+v", hit)
+	}
+	if path != "O-L-H-C" {
+		t.Fatalf("expected path O-L-H-C, got %s", path)
+	}
+	if hit.spot <= b.Low || hit.spot >= b.Open {
+		t.Fatalf("expected fill between low and open, got %.4f", hit.spot)
+	}
+	// fills at the stop threshold, not at the extreme
+	if pct := changePct(tr, e.premiumAt(tr, marks)); math.Abs(pct+stop) > 0.01 {
+		t.Fatalf("expected fill at -%.0f%%, got %.4f%%", stop, pct)
+	}
+
+	// a quiet bar crosses nothing
+	quiet := data.Bar{Date: day, Open: 100, High: 100.5, Low: 99.5, Close: 100}
+	if hit, _, _ := e.checkIntrabar(newTrade(), quiet, []legMark{{Price: price(100)}}); hit != nil {
+		t.Fatalf("expected no intrabar exit, got %+v", hit)
+	}
+
+	// a wide bar crossing both: pessimistic stops, optimistic takes profit
+	wide := data.Bar{Date: day, Open: 100, High: 125, Low: 90, Close: 100}
+	wideMarks := []legMark{{Price: price(100)}}
+	if hit, _, _ := e.checkIntrabar(newTrade(), wide, wideMarks); hit == nil || !hit.stop {
+		t.Fatalf("pessimistic: expected stop, got %+v", hit)
+	}
+	e = newEngine(IntrabarSpec{Mode: IntrabarOptimistic})
+	if hit, _, _ := e.checkIntrabar(newTrade(), wide, wideMarks); hit == nil || hit.stop || !strings.HasPrefix(hit.reason, "profit_target") {
+		t.Fatalf("optimistic: expected target, got %+v", hit)
+	}
+}
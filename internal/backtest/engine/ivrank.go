@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"math"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+// hvWindow is the daily bars behind each realized volatility IV rank ranks
+// against.
+const hvWindow = 20
+
+// ivRankWindow returns the daily bars the underlying's IV rank looks back
+// over, default 252.
+func (cfg *Config) ivRankWindow() int {
+	if cfg.IVRankWindow > 0 {
+		return cfg.IVRankWindow
+	}
+	return 252
+}
+
+// loadHistory returns the daily bars of the IV rank lookback before the
+// start date followed by bars, so that IV rank has its full window on the
+// first entry. A provider without the earlier bars leaves bars as they are.
+func (e *Engine) loadHistory(bars []data.Bar) []data.Bar {
+	start := e.cfg.Entry.StartDate
+	// about 5 trading days a week, with room for holidays
+	from := start.AddDate(0, 0, -(e.cfg.ivRankWindow()+hvWindow)*7/5-10)
+	prior, err := e.prov.GetBars(e.cfg.Underlying, from, start.AddDate(0, 0, -1), 1, "day")
+	if err != nil {
+		logger.Infof("no bars before %s, IV rank starts with the run: %v", start.Format("2006-01-02"), err)
+		return bars
+	}
+	history := make([]data.Bar, 0, len(prior)+len(bars))
+	for _, b := range prior {
+		if b.Date.Before(start) {
+			history = append(history, b)
+		}
+	}
+	return append(history, bars...)
+}
+
+// knownDays returns the daily bars of days known on a trading day: up to the
+// day itself, or up to the day before in intraday runs, where the day's bar
+// is not complete yet.
+func (e *Engine) knownDays(days []data.Bar, day string) []data.Bar {
+	n := 0
+	for i, b := range days {
+		k := b.Date.Format("2006-01-02")
+		if k > day || (k == day && e.intraday()) {
+			break
+		}
+		n = i + 1
+	}
+	return days[:n]
+}
+
+// ivRank returns iv, in percent, as a percent of the range of the rolling
+// realized volatility over window bars across the last lookback bars of
+// days; the providers carry no implied volatility history to rank against.
+// It is -1 while days hold no range.
+func ivRank(days []data.Bar, window, lookback int, iv float64) float64 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for end := max(window, len(days)-lookback); end <= len(days); end++ {
+		if end < 2 {
+			continue
+		}
+		hv := AnnualizedVolatility(extractCloses(days[max(0, end-window):end])) * 100.0
+		lo, hi = math.Min(lo, hv), math.Max(hi, hv)
+	}
+	if hi <= lo {
+		return -1
+	}
+	return math.Max(0, math.Min(100, (iv-lo)/(hi-lo)*100.0))
+}
+
+// underlyingIV returns the at-the-money implied volatility of the underlying
+// at a bar, in percent, or the realized volatility of hist when the provider
+// has no option prices for it.
+func (e *Engine) underlyingIV(b data.Bar, hist []data.Bar) float64 {
+	if iv := e.atmIV(b); iv > 0 {
+		return iv * 100.0
+	}
+	return AnnualizedVolatility(extractCloses(hist)) * 100.0
+}
+
+// usesIVRank reports whether any of rules, or a child of an any or all rule
+// among them, reads the IV rank.
+func usesIVRank(rules []ExitRule) bool {
+	for _, r := range rules {
+		switch r := r.(type) {
+		case IVRankRule, *IVRankRule:
+			return true
+		case AnyRule:
+			if usesIVRank(r) {
+				return true
+			}
+		case AllRule:
+			if usesIVRank(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ivRankAt returns the IV rank of the underlying at a bar over the run's
+// IV rank window, computed once per bar for all open trades.
+func (e *Engine) ivRankAt(b data.Bar) float64 {
+	if e.rankedAt.Equal(b.Date) {
+		return e.rank
+	}
+	days := e.knownDays(e.history, e.dayKey(b))
+	e.rank = -1
+	if len(days) > 0 {
+		iv := e.underlyingIV(b, days[max(0, len(days)-hvWindow):])
+		e.rank = ivRank(days, hvWindow, e.cfg.ivRankWindow(), iv)
+	}
+	e.rankedAt = b.Date
+	return e.rank
+}
+
+// atmIV returns the at-the-money implied volatility of the underlying at a
+// bar's close, from the nearest expiry at least a week out, or 0 if the
+// provider has no option prices for it.
+func (e *Engine) atmIV(b data.Bar) float64 {
+	var exp time.Time
+	for _, x := range e.expiries {
+		if x.Sub(b.Date) >= 7*24*time.Hour {
+			exp = x
+			break
+		}
+	}
+	if exp.IsZero() {
+		return 0
+	}
+	strike, call, put, err := e.prov.GetATMOptionPrices(e.cfg.Underlying, exp, b.Date, b.Close)
+	if err != nil {
+		return 0
+	}
+	T := exp.Sub(b.Date).Hours() / (24 * 365)
+	s, q := e.escrowedSpot(b.Close, b.Date, exp)
+	iv, err := pricing.ImpliedVolATM(s*math.Exp(-q*T), strike, T, 0.02, call, put)
+	if err != nil {
+		return 0
+	}
+	return iv
+}
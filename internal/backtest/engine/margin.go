@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+const (
+	MarginOff       = "off"       // no margin tracking (default)
+	MarginRegT      = "reg_t"     // Reg-T strategy-based requirements
+	MarginPortfolio = "portfolio" // simplified portfolio margin: worst loss over an underlying stress
+)
+
+// MarginSpec enables margin requirement tracking and buying-power checks.
+//
+// Reg-T requirements are computed per trade from its legs: stock at a
+// percent of its value, short options covered by stock at nothing beyond
+// the stock requirement, defined-risk option structures (verticals, iron
+// condors, butterflies, long options) at their maximum loss, and other
+// short options at the greater of NakedPct of the underlying less the
+// out-of-the-money amount or NakedMinPct of the underlying (calls) or strike
+// (puts), plus the option value; short strangles and straddles pay the
+// larger side plus the other side's value.
+//
+// Portfolio margin reprices the position over StressPoints underlying moves
+// on each side, up to StressPct, and requires its worst loss.
+//
+// The requirement is tracked on every bar, entries whose initial
+// requirement exceeds the account's buying power (equity less the
+// requirement of open trades) are rejected, and each trade reports its
+// return on margin.
+type MarginSpec struct {
+	Mode            string  `json:"mode,omitempty"`                  // "off", "reg_t" or "portfolio", default: "off"
+	NakedPct        float64 `json:"naked_pct,omitempty"`             // reg_t: e.g. 20.0, default: 20 (15 for cash-settled indices)
+	NakedMinPct     float64 `json:"naked_min_pct,omitempty"`         // reg_t: e.g. 10.0, default: 10
+	StockInitialPct float64 `json:"stock_initial_pct,omitempty"`     // reg_t: percent of stock value at entry, default: 50
+	StockMaintPct   float64 `json:"stock_maintenance_pct,omitempty"` // reg_t: percent of stock value while open, default: 25
+	StressPct       float64 `json:"stress_pct,omitempty"`            // portfolio: e.g. 15.0 stresses the underlying ±15%, default: 15
+	StressPoints    int     `json:"stress_points,omitempty"`         // portfolio: scenarios on each side, default: 5
+}
+
+// enabled reports whether a margin mode is configured.
+func (m MarginSpec) enabled() bool {
+	mode := strings.ToLower(m.Mode)
+	return mode != "" && mode != MarginOff
+}
+
+func (m MarginSpec) validate() error {
+	switch strings.ToLower(m.Mode) {
+	case "", MarginOff, MarginRegT, MarginPortfolio:
+	default:
+		return fmt.Errorf("unknown margin mode %q", m.Mode)
+	}
+	if m.NakedPct < 0 || m.NakedMinPct < 0 || m.StockInitialPct < 0 || m.StockMaintPct < 0 || m.StressPct < 0 || m.StressPoints < 0 {
+		return fmt.Errorf("margin percents and stress points must not be negative")
+	}
+	return nil
+}
+
+// pct returns v, or def when v is unset.
+func pct(v, def float64) float64 {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// marginFor returns the margin requirement of a trade with its legs valued
+// at marks on a bar. initial selects the entry requirement of stock legs
+// rather than their maintenance requirement.
+func (e *Engine) marginFor(tr *Trade, b data.Bar, marks []legMark, initial bool) float64 {
+	if strings.ToLower(e.cfg.Margin.Mode) == MarginPortfolio {
+		return e.stressMargin(tr, b, marks)
+	}
+	return e.regTMargin(tr, b, marks, initial)
+}
+
+// regTMargin returns the Reg-T requirement of a trade on a bar. Expired legs
+// have settled and require nothing.
+func (e *Engine) regTMargin(tr *Trade, b data.Bar, marks []legMark, initial bool) float64 {
+	m := e.cfg.Margin
+	s := b.Close
+	units := float64(tr.Contracts)
+	if units <= 0 {
+		units = 1
+	}
+	stockPct := pct(m.StockMaintPct, 25)
+	if initial {
+		stockPct = pct(m.StockInitialPct, 50)
+	}
+
+	// stock legs, and the shares per unit available to cover short options
+	req := 0.0
+	long, short := 0.0, 0.0
+	for i, leg := range tr.Legs {
+		if !leg.Spec.IsStock() {
+			continue
+		}
+		shares := float64(leg.Spec.Qty)
+		req += stockPct / 100.0 * shares * units * marks[i].Price
+		if legSign(leg) > 0 {
+			long += shares
+		} else {
+			short += shares
+		}
+	}
+
+	// short calls covered by long stock and short puts covered by short stock
+	// need nothing beyond the stock requirement
+	var rest []st.TradeLeg
+	var restMarks []legMark
+	for i, leg := range tr.Legs {
+		if leg.Spec.IsStock() || e.legExpired(leg, b.Date) {
+			continue
+		}
+		qty := float64(leg.Spec.Qty)
+		if legSign(leg) < 0 {
+			cover := &long
+			if strings.ToLower(leg.Spec.OptionType) == "put" {
+				cover = &short
+			}
+			covered := math.Min(qty, math.Floor(*cover/legMultiplier(leg)))
+			*cover -= covered * legMultiplier(leg)
+			qty -= covered
+		}
+		if qty <= 0 {
+			continue
+		}
+		leg.Spec.Qty = int(qty)
+		rest = append(rest, leg)
+		restMarks = append(restMarks, marks[i])
+	}
+	if len(rest) == 0 {
+		return req
+	}
+
+	// structures whose risk the long options define require their maximum loss
+	value, longOptions := 0.0, false
+	for i, leg := range rest {
+		value += legSign(leg) * restMarks[i].Price * float64(leg.Spec.Qty) * legMultiplier(leg)
+		longOptions = longOptions || legSign(leg) > 0
+	}
+	if risk, ok := definedRisk(rest, value); ok && longOptions {
+		return req + risk*units
+	}
+
+	// naked: each short leg on its own, long legs paid in full
+	nakedPct := pct(m.NakedPct, 20)
+	if m.NakedPct <= 0 && e.product().Settlement == data.SettleCash {
+		nakedPct = 15
+	}
+	minPct := pct(m.NakedMinPct, 10)
+	var calls, puts, callValue, putValue, longs float64
+	for i, leg := range rest {
+		n := float64(leg.Spec.Qty) * legMultiplier(leg)
+		p := restMarks[i].Price
+		if legSign(leg) > 0 {
+			longs += p * n
+			continue
+		}
+		if strings.ToLower(leg.Spec.OptionType) == "call" {
+			otm := math.Max(0, leg.Strike-s)
+			calls += math.Max(nakedPct/100.0*s-otm, minPct/100.0*s)*n + p*n
+			callValue += p * n
+		} else {
+			otm := math.Max(0, s-leg.Strike)
+			puts += math.Max(nakedPct/100.0*s-otm, minPct/100.0*leg.Strike)*n + p*n
+			putValue += p * n
+		}
+	}
+	naked := calls + puts
+	if calls > 0 && puts > 0 {
+		naked = math.Max(calls+putValue, puts+callValue)
+	}
+	return req + (naked+longs)*units
+}
+
+// stressMargin returns the worst loss of a trade over underlying moves of
+// up to StressPct either way, at the volatility of the latest marks.
+func (e *Engine) stressMargin(tr *Trade, b data.Bar, marks []legMark) float64 {
+	m := e.cfg.Margin
+	move := pct(m.StressPct, 15)
+	points := m.StressPoints
+	if points <= 0 {
+		points = 5
+	}
+	base := e.premiumAt(tr, marks)
+	worst := base
+	for i := -points; i <= points; i++ {
+		spot := b.Close * (1 + move/100.0*float64(i)/float64(points))
+		if spot <= 0 || i == 0 {
+			continue
+		}
+		worst = math.Min(worst, e.premiumAt(tr, e.marksAt(tr, b, marks, spot)))
+	}
+	return base - worst
+}
+
+// trackMargin records a trade's requirement on a bar at its latest marks.
+func (e *Engine) trackMargin(tr *Trade, b data.Bar) {
+	tr.margin = e.marginFor(tr, b, tr.legPrices, false)
+	tr.MaxMargin = math.Max(tr.MaxMargin, tr.margin)
+}
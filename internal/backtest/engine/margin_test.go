@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestRegTMargin(t *testing.T) {
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	exp := day.AddDate(0, 0, 30)
+	b := data.Bar{Date: day, Close: 100}
+	e := &Engine{cfg: &Config{Margin: MarginSpec{Mode: MarginRegT}}}
+	leg := func(side, typ string, strike float64) st.TradeLeg {
+		return st.TradeLeg{Spec: st.LegSpec{Side: side, OptionType: typ, Qty: 1}, Strike: strike, Expiration: exp}
+	}
+	cases := []struct {
+		name  string
+		legs  []st.TradeLeg
+		marks []legMark
+		want  float64
+	}{
+		// max(20% * 100 - 5 OTM, 10% * 95) + 2 = 17 per share
+		{"naked put", []st.TradeLeg{leg("sell", "put", 95)}, []legMark{{Price: 2}}, 1700},
+		// 5 wide less the 1.50 credit still marked
+		{"put vertical", []st.TradeLeg{leg("sell", "put", 95), leg("buy", "put", 90)}, []legMark{{Price: 2}, {Price: 0.5}}, 350},
+		{"iron condor", []st.TradeLeg{leg("sell", "put", 95), leg("buy", "put", 90), leg("sell", "call", 105), leg("buy", "call", 110)},
+			[]legMark{{Price: 2}, {Price: 0.5}, {Price: 2}, {Price: 0.5}}, 200},
+		// 20 - 10 OTM = 10 < 10% floor of 10; call side 10+1.5, put side 10+1.5: larger side plus the other's value
+		{"strangle", []st.TradeLeg{leg("sell", "put", 90), leg("sell", "call", 110)}, []legMark{{Price: 1.5}, {Price: 1.5}}, 1300},
+		// 25% maintenance on the shares, the call is covered
+		{"covered call", []st.TradeLeg{{Spec: st.LegSpec{Side: "buy", OptionType: st.LegStock, Qty: 100}}, leg("sell", "call", 105)},
+			[]legMark{{Price: 100}, {Price: 1}}, 2500},
+	}
+	for _, c := range cases {
+		tr := &Trade{Contracts: 2, Legs: c.legs}
+		if got := e.regTMargin(tr, b, c.marks, false); math.Abs(got-2*c.want) > 1e-6 {
+			t.Errorf("%s: expected margin %.2f, got %.2f", c.name, 2*c.want, got)
+		}
+	}
+
+	// portfolio margin of a short put is its loss at the largest down move
+	e.cfg.Margin.Mode = MarginPortfolio
+	e.hv = 0.2
+	tr := &Trade{Contracts: 1, Legs: []st.TradeLeg{leg("sell", "put", 95)}}
+	pm := e.marginFor(tr, b, []legMark{{Price: 2, IV: 0.2}}, true)
+	if pm < 900 || pm > 1700 {
+		t.Fatalf("expected portfolio margin near the 15%% down loss, got %.2f", pm)
+	}
+
+	if err := (MarginSpec{Mode: "span"}).validate(); err == nil {
+		t.Fatalf("expected error for unknown margin mode")
+	}
+}
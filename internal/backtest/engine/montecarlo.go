@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+const (
+	MonteCarloBootstrap = "bootstrap" // draw trades with replacement
+	MonteCarloShuffle   = "shuffle"   // reorder the same trades
+)
+
+// MonteCarloSpec enables Monte Carlo resampling of a run's trade P&L.
+//
+// Each of Runs sequences replays the net P&L of the run's trades from the
+// starting capital, either bootstrapped (as many trades drawn with
+// replacement) or shuffled (the same trades in a random order). Sequences
+// are drawn from Config.Seed, so a fixed seed reproduces the analysis.
+// Drawdowns and streaks are measured trade by trade.
+type MonteCarloSpec struct {
+	Runs        int       `json:"runs,omitempty"`        // resampled sequences, e.g. 5000, 0 = off
+	Method      string    `json:"method,omitempty"`      // "bootstrap" or "shuffle", default: "bootstrap"
+	RuinPct     float64   `json:"ruin_pct,omitempty"`    // loss of starting capital counted as ruin, default: 50
+	Percentiles []float64 `json:"percentiles,omitempty"` // percentile bands to report, default: [5, 25, 50, 75, 95]
+}
+
+// Band is one percentile of a distribution.
+type Band struct {
+	Pct   float64 `json:"pct"`   // percentile, e.g. 5
+	Value float64 `json:"value"` // value at the percentile
+}
+
+// Distribution summarizes one metric over the resampled sequences.
+type Distribution struct {
+	Mean       float64 `json:"mean"`
+	Bands      []Band  `json:"bands"`       // percentile bands, ascending
+	Actual     float64 `json:"actual"`      // value of the run's own trade sequence
+	ActualRank float64 `json:"actual_rank"` // percent of sequences below Actual
+}
+
+// MonteCarloResult holds the distributions of a Monte Carlo analysis.
+type MonteCarloResult struct {
+	Method         string       `json:"method"`
+	Runs           int          `json:"runs"`
+	Seed           int64        `json:"seed"`
+	FinalEquity    Distribution `json:"final_equity"`     // equity after the last trade
+	MaxDrawdownPct Distribution `json:"max_drawdown_pct"` // largest peak-to-trough fall, in percent of the peak
+	LosingStreak   Distribution `json:"losing_streak"`    // longest run of consecutive losing trades
+	RiskOfRuin     float64      `json:"risk_of_ruin"`     // percent of sequences losing RuinPct of starting capital
+}
+
+// enabled reports whether Monte Carlo runs are configured.
+func (m MonteCarloSpec) enabled() bool {
+	return m.Runs > 0
+}
+
+func (m MonteCarloSpec) validate() error {
+	switch strings.ToLower(m.Method) {
+	case "", MonteCarloBootstrap, MonteCarloShuffle:
+	default:
+		return fmt.Errorf("unknown monte carlo method %q", m.Method)
+	}
+	if m.Runs < 0 || m.RuinPct < 0 || m.RuinPct > 100 {
+		return fmt.Errorf("runs must not be negative and ruin_pct must be within 0..100")
+	}
+	for _, p := range m.Percentiles {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("percentile %.2f outside 0..100", p)
+		}
+	}
+	return nil
+}
+
+// pathStats returns the final equity, the max drawdown in percent and the
+// longest losing streak of a P&L sequence from capital, and whether it fell
+// to the ruin level.
+func pathStats(pnls []float64, capital, ruin float64) (final, maxDD float64, streak int, ruined bool) {
+	equity, peak := capital, capital
+	run := 0
+	for _, p := range pnls {
+		equity += p
+		if equity <= ruin {
+			ruined = true
+		}
+		peak = math.Max(peak, equity)
+		if peak > 0 {
+			maxDD = math.Max(maxDD, (peak-equity)/peak*100.0)
+		}
+		if p < 0 {
+			run++
+			streak = max(streak, run)
+		} else {
+			run = 0
+		}
+	}
+	return equity, maxDD, streak, ruined
+}
+
+// MonteCarlo resamples the net P&L of trades, in their order, and returns
+// the distributions of the resampled sequences.
+func MonteCarlo(trades []Trade, capital float64, spec MonteCarloSpec, seed int64) *MonteCarloResult {
+	method := strings.ToLower(spec.Method)
+	if method == "" {
+		method = MonteCarloBootstrap
+	}
+	ruinPct := spec.RuinPct
+	if ruinPct <= 0 {
+		ruinPct = 50
+	}
+	pcts := spec.Percentiles
+	if len(pcts) == 0 {
+		pcts = []float64{5, 25, 50, 75, 95}
+	}
+	ruin := capital * (1 - ruinPct/100.0)
+
+	pnls := make([]float64, len(trades))
+	for i, tr := range trades {
+		pnls[i] = tr.NetPnL
+	}
+	res := &MonteCarloResult{Method: method, Runs: spec.Runs, Seed: seed}
+	actualFinal, actualDD, actualStreak, _ := pathStats(pnls, capital, ruin)
+
+	rng := rand.New(rand.NewSource(seed))
+	finals := make([]float64, spec.Runs)
+	dds := make([]float64, spec.Runs)
+	streaks := make([]float64, spec.Runs)
+	seq := make([]float64, len(pnls))
+	ruined := 0
+	for r := 0; r < spec.Runs; r++ {
+		if method == MonteCarloShuffle {
+			copy(seq, pnls)
+			rng.Shuffle(len(seq), func(i, j int) { seq[i], seq[j] = seq[j], seq[i] })
+		} else {
+			for i := range seq {
+				seq[i] = pnls[rng.Intn(len(pnls))]
+			}
+		}
+		final, dd, streak, hit := pathStats(seq, capital, ruin)
+		finals[r], dds[r], streaks[r] = final, dd, float64(streak)
+		if hit {
+			ruined++
+		}
+	}
+	if spec.Runs > 0 {
+		res.RiskOfRuin = float64(ruined) / float64(spec.Runs) * 100.0
+	}
+	res.FinalEquity = distribution(finals, pcts, actualFinal)
+	res.MaxDrawdownPct = distribution(dds, pcts, actualDD)
+	res.LosingStreak = distribution(streaks, pcts, float64(actualStreak))
+	return res
+}
+
+// distribution summarizes samples at percentiles and ranks actual among them.
+func distribution(samples, pcts []float64, actual float64) Distribution {
+	d := Distribution{Actual: actual}
+	if len(samples) == 0 {
+		return d
+	}
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	below := 0
+	for _, s := range sorted {
+		d.Mean += s
+		if s < actual {
+			below++
+		}
+	}
+	d.Mean /= float64(len(sorted))
+	d.ActualRank = float64(below) / float64(len(sorted)) * 100.0
+
+	ps := append([]float64{}, pcts...)
+	sort.Float64s(ps)
+	for _, p := range ps {
+		d.Bands = append(d.Bands, Band{Pct: p, Value: percentile(sorted, p)})
+	}
+	return d
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating
+// linearly between ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := p / 100.0 * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
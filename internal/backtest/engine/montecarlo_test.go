@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMonteCarlo(t *testing.T) {
+	var trades []Trade
+	for _, pnl := range []float64{500, -200, 300, -200, -200, 400, 100, -300} {
+		trades = append(trades, Trade{NetPnL: pnl})
+	}
+
+	final, dd, streak, ruined := pathStats([]float64{500, -200, 300, -200, -200, 400, 100, -300}, 10000, 5000)
+	if final != 10400 || streak != 2 || ruined || math.Abs(dd-400.0/10600*100) > 1e-9 {
+		t.Fatalf("unexpected path stats final=%.2f dd=%.4f streak=%d ruined=%v", final, dd, streak, ruined)
+	}
+
+	spec := MonteCarloSpec{Runs: 2000, Method: MonteCarloShuffle, RuinPct: 5}
+	mc := MonteCarlo(trades, 10000, spec, 42)
+	// reordering never changes the final equity
+	for _, b := range mc.FinalEquity.Bands {
+		if math.Abs(b.Value-10400) > 1e-9 {
+			t.Fatalf("expected shuffled final equity 10400 at every band, got %+v", mc.FinalEquity.Bands)
+		}
+	}
+	if len(mc.MaxDrawdownPct.Bands) != 5 || mc.MaxDrawdownPct.Bands[0].Value > mc.MaxDrawdownPct.Bands[4].Value {
+		t.Fatalf("expected ascending drawdown bands, got %+v", mc.MaxDrawdownPct.Bands)
+	}
+	if mc.LosingStreak.Bands[4].Value < 2 || mc.RiskOfRuin < 0 || mc.RiskOfRuin > 100 {
+		t.Fatalf("unexpected streaks %+v or ruin %.2f", mc.LosingStreak, mc.RiskOfRuin)
+	}
+
+	// a fixed seed reproduces the analysis
+	a := MonteCarlo(trades, 10000, MonteCarloSpec{Runs: 500}, 7)
+	b := MonteCarlo(trades, 10000, MonteCarloSpec{Runs: 500}, 7)
+	if !reflect.DeepEqual(a, b) || a.Method != MonteCarloBootstrap {
+		t.Fatalf("expected identical bootstrap results for the same seed")
+	}
+	if a.FinalEquity.Bands[0].Value >= a.FinalEquity.Bands[4].Value {
+		t.Fatalf("expected bootstrapped final equity to vary, got %+v", a.FinalEquity.Bands)
+	}
+
+	if err := (MonteCarloSpec{Method: "jackknife"}).validate(); err == nil {
+		t.Fatalf("expected error for unknown method")
+	}
+	if got := percentile([]float64{1, 2, 3, 4}, 50); got != 2.5 {
+		t.Fatalf("expected median 2.5, got %.2f", got)
+	}
+}
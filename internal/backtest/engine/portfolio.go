@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EquityPoint is one mark-to-market observation of the account.
+type EquityPoint struct {
+	Date          time.Time `json:"date"`           // bar date
+	Equity        float64   `json:"equity"`         // starting capital + realized + unrealized P&L
+	RealizedPnL   float64   `json:"realized_pnl"`   // P&L of trades closed on or before Date
+	UnrealizedPnL float64   `json:"unrealized_pnl"` // P&L of trades still open at Date
+	OpenTrades    int       `json:"open_trades"`    // number of trades open at Date
+	Margin        float64   `json:"margin"`         // margin requirement of the trades open at Date
+}
+
+// portfolio holds the open positions of a run against a shared capital base.
+//
+// Open trades are kept as pointers so the event loop can mark them in place;
+// closed trades are moved to the closed list and contribute realized P&L.
+type portfolio struct {
+	capital  float64  // starting capital
+	open     []*Trade // positions currently open, in open order
+	closed   []*Trade // positions already closed, in close order
+	realized float64  // cumulative realized P&L, net of costs
+	opened   int      // number of positions ever opened
+}
+
+func newPortfolio(capital float64) *portfolio {
+	return &portfolio{capital: capital}
+}
+
+// add registers a newly opened trade.
+func (p *portfolio) add(tr *Trade) {
+	p.open = append(p.open, tr)
+	p.opened++
+}
+
+// close moves a trade from the open list to the closed list. The trade must
+// already carry its close details.
+func (p *portfolio) close(tr *Trade) {
+	for i, o := range p.open {
+		if o == tr {
+			p.open = append(p.open[:i], p.open[i+1:]...)
+			break
+		}
+	}
+	p.closed = append(p.closed, tr)
+	p.realized += tr.NetPnL
+}
+
+// openTrades returns a copy of the open list, safe to iterate while closing.
+func (p *portfolio) openTrades() []*Trade {
+	out := make([]*Trade, len(p.open))
+	copy(out, p.open)
+	return out
+}
+
+// unrealized returns the mark-to-market P&L of all open positions.
+func (p *portfolio) unrealized() float64 {
+	total := 0.0
+	for _, tr := range p.open {
+		total += tr.mark - tr.OpenPremium - tr.OpenCosts.Total() - tr.AdjustmentCosts.Total() - tr.HedgeCosts.Total()
+	}
+	return total
+}
+
+// equity returns starting capital plus realized and unrealized P&L.
+func (p *portfolio) equity() float64 {
+	return p.capital + p.realized + p.unrealized()
+}
+
+// snapshot returns the account state as an EquityPoint.
+func (p *portfolio) snapshot(date time.Time) EquityPoint {
+	unrealized := p.unrealized()
+	return EquityPoint{
+		Date:          date,
+		Equity:        p.capital + p.realized + unrealized,
+		RealizedPnL:   p.realized,
+		UnrealizedPnL: unrealized,
+		OpenTrades:    len(p.open),
+		Margin:        p.margin(),
+	}
+}
+
+// margin returns the latest margin requirement of all open positions.
+func (p *portfolio) margin() float64 {
+	total := 0.0
+	for _, tr := range p.open {
+		total += tr.margin
+	}
+	return total
+}
+
+// marginBlocked reports why a newly opened trade breaches the account's
+// buying power (equity less the requirement of open positions), or "" if it
+// fits or margin is not tracked.
+func (p *portfolio) marginBlocked(cfg *Config, tr *Trade) string {
+	if !cfg.Margin.enabled() {
+		return ""
+	}
+	if bp := p.equity() - p.margin(); tr.InitialMargin > bp {
+		return fmt.Sprintf("margin %.2f exceeds buying power %.2f", tr.InitialMargin, bp)
+	}
+	return ""
+}
+
+// entryBlocked reports why a new entry is not allowed, or "" if it is.
+func (p *portfolio) entryBlocked(cfg *Config) string {
+	if cfg.MaxTrades > 0 && p.opened >= cfg.MaxTrades {
+		return fmt.Sprintf("max_trades %d reached", cfg.MaxTrades)
+	}
+	if cfg.OneAtATime && len(p.open) > 0 {
+		return "position already open"
+	}
+	if cfg.MaxConcurrent > 0 && len(p.open) >= cfg.MaxConcurrent {
+		return fmt.Sprintf("max_concurrent %d reached", cfg.MaxConcurrent)
+	}
+	return ""
+}
+
+// trades returns every trade of the run, open or closed, sorted by ID.
+func (p *portfolio) trades() []Trade {
+	out := make([]Trade, 0, len(p.closed)+len(p.open))
+	for _, tr := range p.closed {
+		out = append(out, *tr)
+	}
+	for _, tr := range p.open {
+		out = append(out, *tr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPortfolioEntryLimits(t *testing.T) {
+	pf := newPortfolio(100000)
+	cfg := &Config{MaxConcurrent: 2, MaxTrades: 3}
+
+	for i := 1; i <= 2; i++ {
+		if reason := pf.entryBlocked(cfg); reason != "" {
+			t.Fatalf("entry %d unexpectedly blocked: %s", i, reason)
+		}
+		pf.add(&Trade{ID: i, OpenPremium: -100, mark: -100})
+	}
+	if reason := pf.entryBlocked(cfg); reason == "" {
+		t.Fatalf("expected max_concurrent to block third entry")
+	}
+
+	// closing one frees a slot
+	first := pf.openTrades()[0]
+	first.ClosePremium = -40
+	pf.close(first)
+	if reason := pf.entryBlocked(cfg); reason != "" {
+		t.Fatalf("entry unexpectedly blocked after close: %s", reason)
+	}
+	pf.add(&Trade{ID: 3, OpenPremium: 200, mark: 250})
+
+	// max_trades counts every position ever opened
+	pf.close(pf.openTrades()[0])
+	if reason := pf.entryBlocked(cfg); reason == "" {
+		t.Fatalf("expected max_trades to block fourth entry")
+	}
+
+	cfg = &Config{OneAtATime: true}
+	if reason := pf.entryBlocked(cfg); reason == "" {
+		t.Fatalf("expected one_at_a_time to block entry while a position is open")
+	}
+}
+
+func TestPortfolioSnapshot(t *testing.T) {
+	pf := newPortfolio(100000)
+	a := &Trade{ID: 1, OpenPremium: -500, mark: -300}
+	b := &Trade{ID: 2, OpenPremium: 400, mark: 350}
+	pf.add(a)
+	pf.add(b)
+
+	a.ClosePremium = -200
+	a.NetPnL = 300
+	pf.close(a)
+
+	pt := pf.snapshot(time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC))
+	if math.Abs(pt.RealizedPnL-300) > 1e-9 {
+		t.Fatalf("expected realized 300, got %f", pt.RealizedPnL)
+	}
+	if math.Abs(pt.UnrealizedPnL+50) > 1e-9 {
+		t.Fatalf("expected unrealized -50, got %f", pt.UnrealizedPnL)
+	}
+	if math.Abs(pt.Equity-100250) > 1e-9 {
+		t.Fatalf("expected equity 100250, got %f", pt.Equity)
+	}
+	if pt.OpenTrades != 1 {
+		t.Fatalf("expected 1 open trade, got %d", pt.OpenTrades)
+	}
+
+	trades := pf.trades()
+	if len(trades) != 2 || trades[0].ID != 1 || trades[1].ID != 2 {
+		t.Fatalf("expected trades sorted by ID, got %+v", trades)
+	}
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sch "github.com/contactkeval/option-replay/internal/backtest/scheduler"
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+const (
+	Resolution1Min  = "1m"
+	Resolution5Min  = "5m"
+	Resolution15Min = "15m"
+	Resolution1Hour = "1h"
+	ResolutionDay   = "day"
+)
+
+// parseResolution maps a resolution name to the (timespan, multiplier) pair
+// expected by data.Provider.GetBars.
+func parseResolution(res string) (int, string, error) {
+	switch strings.ToLower(strings.TrimSpace(res)) {
+	case "", ResolutionDay:
+		return 1, "day", nil
+	case Resolution1Min:
+		return 1, "minute", nil
+	case Resolution5Min:
+		return 5, "minute", nil
+	case Resolution15Min:
+		return 15, "minute", nil
+	case Resolution1Hour:
+		return 1, "hour", nil
+	}
+	return 0, "", fmt.Errorf("unsupported resolution %q (want 1m, 5m, 15m, 1h or day)", res)
+}
+
+// intraday reports whether the run simulates below daily granularity.
+func (e *Engine) intraday() bool {
+	_, unit, _ := parseResolution(e.cfg.Resolution)
+	return unit != "day"
+}
+
+// loadLocation resolves Entry.Timezone, default "America/New_York".
+func (cfg *Config) loadLocation() (*time.Location, error) {
+	tz := cfg.Entry.Timezone
+	if tz == "" {
+		tz = "America/New_York"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %s: %w", tz, err)
+	}
+	return loc, nil
+}
+
+// entryLocation returns the timezone used for entry times and market close.
+// prepare resolves it once; engines used without prepare resolve it on
+// first use and fall back to UTC for an invalid timezone.
+func (e *Engine) entryLocation() *time.Location {
+	if e.loc == nil {
+		loc, err := e.cfg.loadLocation()
+		if err != nil {
+			logger.Errorf("%v, using UTC", err)
+			loc = time.UTC
+		}
+		e.loc = loc
+	}
+	return e.loc
+}
+
+// simulationBars returns the bars that drive the mark-to-market loop.
+//
+// At daily resolution these are the daily bars already fetched for
+// scheduling. Intraday bars are fetched in monthly windows to stay under
+// the provider's per-request result limit.
+func (e *Engine) simulationBars(daily []data.Bar) ([]data.Bar, error) {
+	n, unit, err := parseResolution(e.cfg.Resolution)
+	if err != nil {
+		return nil, err
+	}
+	if unit == "day" {
+		return daily, nil
+	}
+
+	cfg := e.cfg
+	var out []data.Bar
+	for from := cfg.Entry.StartDate; !from.After(cfg.Entry.EndDate); {
+		to := from.AddDate(0, 1, -1)
+		if to.After(cfg.Entry.EndDate) {
+			to = cfg.Entry.EndDate
+		}
+		bars, err := e.prov.GetBars(cfg.Underlying, from, to, n, unit)
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s bars %s..%s: %w", cfg.Resolution, from.Format("2006-01-02"), to.Format("2006-01-02"), err)
+		}
+		out = append(out, bars...)
+		from = to.AddDate(0, 0, 1)
+	}
+	logger.Infof("%d %s bars fetched for simulation", len(out), cfg.Resolution)
+	return out, nil
+}
+
+// entryTimes maps each scheduled date to the time an entry may be opened,
+// keyed by trading day.
+//
+// At daily resolution the scheduled date is used as is. Intraday, the
+// scheduled day is combined with Entry.TimeOfDay in Entry.Timezone so the
+// entry opens on the first bar at or after that time.
+func (e *Engine) entryTimes(dates []time.Time) (map[string]time.Time, error) {
+	out := make(map[string]time.Time, len(dates))
+	if !e.intraday() {
+		for _, dt := range dates {
+			out[dt.Format("2006-01-02")] = dt
+		}
+		return out, nil
+	}
+
+	tod, tz := e.cfg.Entry.TimeOfDay, e.cfg.Entry.Timezone
+	if tod == "" {
+		tod = "09:30"
+	}
+	if tz == "" {
+		tz = "America/New_York"
+	}
+	for _, dt := range dates {
+		at, err := sch.CombineDateTime(dt, tod, tz)
+		if err != nil {
+			return nil, err
+		}
+		out[at.Format("2006-01-02")] = at
+	}
+	return out, nil
+}
+
+// dayKey returns the trading day a simulation bar belongs to.
+func (e *Engine) dayKey(b data.Bar) string {
+	if !e.intraday() {
+		return b.Date.Format("2006-01-02")
+	}
+	return b.Date.In(e.entryLocation()).Format("2006-01-02")
+}
+
+// expiryTime returns the instant a leg stops trading.
+//
+// At daily resolution this is the expiration date itself, matching the
+// daily bar of that date. Intraday it is the market close on the
+// expiration date, so same-day options keep their time value until the
+// product's market close, or until its market open for AM-settled
+// underlyings.
+func (e *Engine) expiryTime(leg st.TradeLeg) time.Time {
+	if !e.intraday() {
+		return leg.Expiration
+	}
+	at := e.product().MarketClose
+	if e.settlesAM() {
+		at = e.product().MarketOpen
+	}
+	hm, err := time.Parse("15:04", at)
+	if err != nil {
+		return leg.Expiration
+	}
+	d := leg.Expiration
+	return time.Date(d.Year(), d.Month(), d.Day(), hm.Hour(), hm.Minute(), 0, 0, e.entryLocation())
+}
+
+// legExpired reports whether a leg has stopped trading at time t. Stock
+// legs never expire.
+func (e *Engine) legExpired(leg st.TradeLeg, t time.Time) bool {
+	if leg.Spec.IsStock() {
+		return false
+	}
+	return !t.Before(e.expiryTime(leg))
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestParseResolution(t *testing.T) {
+	cases := map[string]struct {
+		n    int
+		unit string
+	}{
+		"":    {1, "day"},
+		"day": {1, "day"},
+		"1m":  {1, "minute"},
+		"5m":  {5, "minute"},
+		"15M": {15, "minute"},
+		"1h":  {1, "hour"},
+	}
+	for res, want := range cases {
+		n, unit, err := parseResolution(res)
+		if err != nil || n != want.n || unit != want.unit {
+			t.Errorf("%q: expected %d %s, got %d %s (%v)", res, want.n, want.unit, n, unit, err)
+		}
+	}
+	if _, _, err := parseResolution("2m"); err == nil {
+		t.Errorf("expected an unsupported resolution to be rejected")
+	}
+}
+
+func TestIntradayClock(t *testing.T) {
+	expiry := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	spy := st.TradeLeg{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 500, Expiration: expiry}
+
+	daily := &Engine{cfg: &Config{Underlying: "SPY"}}
+	if !daily.expiryTime(spy).Equal(expiry) || daily.dayKey(data.Bar{Date: expiry}) != "2024-03-15" {
+		t.Fatalf("expected daily runs to use the expiration date as is, got %s", daily.expiryTime(spy))
+	}
+
+	e := &Engine{cfg: &Config{Underlying: "SPY", Resolution: Resolution15Min}}
+	// 01:00 UTC is still the previous evening in New York
+	if k := e.dayKey(data.Bar{Date: time.Date(2024, 3, 15, 1, 0, 0, 0, time.UTC)}); k != "2024-03-14" {
+		t.Fatalf("expected the bar on the New York day 2024-03-14, got %s", k)
+	}
+	// SPY trades to 16:15 New York time, EDT from March 10
+	want := time.Date(2024, 3, 15, 20, 15, 0, 0, time.UTC)
+	if got := e.expiryTime(spy); !got.Equal(want) {
+		t.Fatalf("expected SPY to expire at %s, got %s", want, got)
+	}
+	if e.legExpired(spy, want.Add(-time.Minute)) || !e.legExpired(spy, want) {
+		t.Fatalf("expected the leg to trade until %s", want)
+	}
+
+	// AM-settled index options stop at the open
+	spx := spy
+	spx.Strike = 5000
+	idx := &Engine{cfg: &Config{Underlying: "SPX", Resolution: Resolution1Hour}}
+	if got := idx.expiryTime(spx); !got.Equal(time.Date(2024, 3, 15, 13, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected SPX to expire at the 09:30 open, got %s", got)
+	}
+
+	// the timezone is resolved once, falling back to UTC
+	bad := &Engine{cfg: &Config{Underlying: "SPY", Resolution: Resolution1Hour, Entry: e.cfg.Entry}}
+	bad.cfg.Entry.Timezone = "Mars/Olympus"
+	if bad.entryLocation() != time.UTC || bad.loc != time.UTC {
+		t.Fatalf("expected an invalid timezone to fall back to UTC")
+	}
+	if _, err := bad.prepare(); err == nil {
+		t.Fatalf("expected prepare to reject an invalid timezone")
+	}
+}
+
+// modelProvider has no option prices, so legs are marked with the model.
+type modelProvider struct{ data.Provider }
+
+func (modelProvider) GetOptionPrice(string, float64, time.Time, string, time.Time) (float64, error) {
+	return 0, fmt.Errorf("no option prices")
+}
+
+func TestIntradayStop(t *testing.T) {
+	stop := 50.0
+	e := NewEngine(&Config{Underlying: "SPY", Resolution: Resolution15Min, Exit: ExitSpec{StopLossPct: &stop}}, modelProvider{data.NewSyntheticProvider()})
+	e.hv = 0.20
+	exits, err := e.cfg.exitRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.exits = exits
+
+	open := time.Date(2024, 6, 3, 13, 30, 0, 0, time.UTC) // 09:30 New York
+	leg := st.TradeLeg{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 100, Expiration: open.AddDate(0, 0, 30)}
+	m, _ := e.priceLeg(leg, 100, open)
+	tr := &Trade{ID: 1, Underlying: "SPY", OpenDateTime: open, Legs: []st.TradeLeg{leg}, Contracts: 1, OpenPremium: -m.Price * 100}
+	tr.HighPremium, tr.LowPremium = tr.OpenPremium, tr.OpenPremium
+
+	var bars []data.Bar
+	for i, c := range []float64{100, 99.6, 99.2, 94, 93, 92} {
+		bars = append(bars, data.Bar{Date: open.Add(time.Duration(i+1) * 15 * time.Minute), Open: c, High: c, Low: c, Close: c})
+	}
+	pf := newPortfolio(100000)
+	pf.add(tr)
+	r := &run{e: e, bars: bars, entries: map[string]time.Time{}, pf: pf, account: pf, limits: pf}
+	for r.next < len(r.bars) {
+		r.step(new(int))
+	}
+
+	if tr.CloseDateTime == nil || !tr.CloseDateTime.Equal(bars[3].Date) || tr.ClosedBy == "data_end" {
+		t.Fatalf("expected the stop on the 10:30 bar %s, got %v closed by %q", bars[3].Date, tr.CloseDateTime, tr.ClosedBy)
+	}
+}
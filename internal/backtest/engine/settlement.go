@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"strings"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+const (
+	SettlePhysical = data.SettlePhysical // in-the-money options deliver shares (equities, ETFs)
+	SettleCash     = data.SettleCash     // in-the-money options pay intrinsic value in cash (indices)
+
+	SettlePM = data.SettlePM // settles at the expiration day's close
+	SettleAM = data.SettleAM // settles at the expiration day's opening print, stops trading the day before
+)
+
+// SettlementSpec overrides the expiration settlement metadata an
+// underlying has in the run's product registry.
+type SettlementSpec struct {
+	Style      string  `json:"style,omitempty"`      // "physical" or "cash", default: "physical"
+	Price      string  `json:"price,omitempty"`      // "pm" (expiry close) or "am" (expiry open), default: "pm"
+	Multiplier float64 `json:"multiplier,omitempty"` // underlying units per contract, default: 100
+}
+
+// settlement returns the settlement metadata of a product, with the fields
+// set in its Config.Settlements entry taking precedence.
+func (cfg *Config) settlement(p data.Product) SettlementSpec {
+	s := SettlementSpec{Style: p.Settlement, Price: p.SettlementPrice, Multiplier: p.Multiplier}
+	if o, ok := cfg.Settlements[strings.ToUpper(p.Symbol)]; ok {
+		if o.Style != "" {
+			s.Style = strings.ToLower(o.Style)
+		}
+		if o.Price != "" {
+			s.Price = strings.ToLower(o.Price)
+		}
+		if o.Multiplier > 0 {
+			s.Multiplier = o.Multiplier
+		}
+	}
+	return s
+}
+
+// product returns the registry metadata of the run's underlying.
+func (e *Engine) product() data.Product {
+	return e.registry().Get(e.cfg.Underlying)
+}
+
+// registry returns the product registry of the run, the shared defaults for
+// an engine not built by NewEngine.
+func (e *Engine) registry() *data.ProductRegistry {
+	if e.products == nil {
+		return data.Products
+	}
+	return e.products
+}
+
+// stampMultiplier sets the contract multiplier of the run's underlying on
+// option legs that have none.
+func (e *Engine) stampMultiplier(legs []st.TradeLeg) {
+	m := e.cfg.settlement(e.product()).Multiplier
+	for i := range legs {
+		if !legs[i].Spec.IsStock() && legs[i].Multiplier <= 0 {
+			legs[i].Multiplier = m
+		}
+	}
+}
+
+// settlementPrice returns the underlying price an expired leg settles at:
+// the opening print (AM) or close (PM) of its expiration day. Without a
+// daily bar for that day the bar close is used.
+func (e *Engine) settlementPrice(leg st.TradeLeg, b data.Bar) float64 {
+	d, ok := e.daily[leg.Expiration.Format("2006-01-02")]
+	if !ok {
+		return b.Close
+	}
+	if e.cfg.settlement(e.product()).Price == SettleAM && d.Open > 0 {
+		return d.Open
+	}
+	return d.Close
+}
+
+// expiredMark returns the per-share settlement value of an expired leg.
+func (e *Engine) expiredMark(leg st.TradeLeg, b data.Bar) legMark {
+	return legMark{Price: intrinsic(leg, e.settlementPrice(leg, b))}
+}
+
+// deliveryFills returns the stock fills needed to liquidate the shares
+// delivered by expired in-the-money legs of a physically settled underlying.
+// Cash-settled legs deliver nothing.
+func (e *Engine) deliveryFills(legs []st.TradeLeg, units int, b data.Bar) []Fill {
+	if e.cfg.settlement(e.product()).Style != SettlePhysical {
+		return nil
+	}
+	var fills []Fill
+	for _, leg := range legs {
+		if leg.Spec.IsStock() || !e.legExpired(leg, b.Date) {
+			continue
+		}
+		px := e.settlementPrice(leg, b)
+		if intrinsic(leg, px) <= 0 {
+			continue
+		}
+		shares := st.TradeLeg{Spec: st.LegSpec{OptionType: st.LegStock, Qty: leg.Spec.Qty * int(legMultiplier(leg))}}
+		fills = append(fills, Fill{Leg: shares, Qty: shares.Spec.Qty * units, Price: px})
+	}
+	return fills
+}
+
+// dailyIndex keys daily bars by date for settlement lookups.
+func dailyIndex(bars []data.Bar) map[string]data.Bar {
+	out := make(map[string]data.Bar, len(bars))
+	for _, b := range bars {
+		out[b.Date.Format("2006-01-02")] = b
+	}
+	return out
+}
+
+// settlesAM reports whether the run's underlying is AM-settled.
+func (e *Engine) settlesAM() bool {
+	return e.cfg.settlement(e.product()).Price == SettleAM
+}
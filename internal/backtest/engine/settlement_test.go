@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestSettlementMetadata(t *testing.T) {
+	cfg := &Config{Settlements: map[string]SettlementSpec{"XYZ": {Multiplier: 10}}}
+	cases := []struct {
+		underlying string
+		want       SettlementSpec
+	}{
+		{"spx", SettlementSpec{Style: SettleCash, Price: SettleAM, Multiplier: 100}},
+		{"AAPL", SettlementSpec{Style: SettlePhysical, Price: SettlePM, Multiplier: 100}},
+		{"XYZ", SettlementSpec{Style: SettlePhysical, Price: SettlePM, Multiplier: 10}},
+	}
+	for _, c := range cases {
+		if got := cfg.settlement(data.Products.Get(c.underlying)); got != c.want {
+			t.Errorf("%s: expected %+v, got %+v", c.underlying, c.want, got)
+		}
+	}
+
+	cfg.Underlying = "XYZ"
+	e := &Engine{cfg: cfg}
+	legs := []st.TradeLeg{
+		{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}},
+		{Spec: st.LegSpec{Side: "buy", OptionType: "stock", Qty: 10}},
+	}
+	e.stampMultiplier(legs)
+	if legMultiplier(legs[0]) != 10 || legMultiplier(legs[1]) != 1 {
+		t.Fatalf("expected mini multiplier on the option only, got %+v", legs)
+	}
+}
+
+func TestRunProducts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.csv")
+	if err := os.WriteFile(path, []byte("symbol,multiplier\nXYZ,10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prov := data.NewSyntheticProvider()
+	mini := NewEngine(&Config{Underlying: "XYZ", Products: path}, prov)
+	mini.prepare() // loads the products file before failing on the missing schedule
+	if m := mini.product().Multiplier; m != 10 {
+		t.Fatalf("expected the products file's multiplier 10, got %.0f", m)
+	}
+
+	// the next run, and the shared defaults, do not see the first run's products
+	if m := NewEngine(&Config{Underlying: "XYZ"}, prov).product().Multiplier; m != 100 {
+		t.Fatalf("expected the default multiplier 100 in another run, got %.0f", m)
+	}
+	if _, ok := data.Products.Lookup("XYZ"); ok {
+		t.Fatalf("expected the products file to leave data.Products alone")
+	}
+}
+
+func TestExpirySettlement(t *testing.T) {
+	exp := time.Date(2025, 3, 21, 0, 0, 0, 0, time.UTC)
+	daily := dailyIndex([]data.Bar{{Date: exp, Open: 4000, Close: 4100}})
+	put := st.TradeLeg{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 4050, Expiration: exp}
+	after := data.Bar{Date: exp.AddDate(0, 0, 3), Close: 3900}
+
+	// AM-settled index: the opening print settles the put, whatever the later close
+	spx := &Engine{cfg: &Config{Underlying: "SPX"}, daily: daily}
+	tr := &Trade{Legs: []st.TradeLeg{put}, Contracts: 1}
+	if total, _ := spx.markTrade(tr, after); math.Abs(total-(-50*100)) > 1e-9 {
+		t.Fatalf("expected put settled at the open (-5000), got %.2f", total)
+	}
+	// PM-settled: the expiration close leaves it worthless
+	xyz := &Engine{cfg: &Config{Underlying: "XYZ"}, daily: daily}
+	if total, _ := xyz.markTrade(tr, after); total != 0 {
+		t.Fatalf("expected put worthless at the close, got %.2f", total)
+	}
+
+	// physical delivery of an in-the-money call liquidates shares, cash settlement does not
+	call := st.TradeLeg{Spec: st.LegSpec{Side: "buy", OptionType: "call", Qty: 1}, Strike: 4000, Expiration: exp}
+	costs := CostSpec{CommissionPerShare: 0.01, CommissionPerContract: 1}
+	for _, c := range []struct {
+		underlying string
+		want       float64
+	}{{"XYZ", 0.01 * 100 * 2}, {"SPX", 0}} {
+		e := &Engine{cfg: &Config{Underlying: c.underlying, Costs: costs}, daily: daily}
+		tr := &Trade{Legs: []st.TradeLeg{call}, Contracts: 2}
+		e.closeTrade(tr, data.Bar{Date: exp, Close: 4100}, mustMarks(e, tr, 4100, exp), "expired")
+		if got := tr.CloseCosts.Commission; math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s: expected close commission %.2f, got %.2f", c.underlying, c.want, got)
+		}
+	}
+
+	// intraday, AM-settled options stop trading at the open
+	e := &Engine{cfg: &Config{Underlying: "SPX", Resolution: Resolution1Hour}}
+	ny, _ := time.LoadLocation("America/New_York")
+	if got := e.expiryTime(put); !got.Equal(time.Date(2025, 3, 21, 9, 30, 0, 0, ny)) {
+		t.Fatalf("expected AM expiry at 09:30, got %s", got)
+	}
+}
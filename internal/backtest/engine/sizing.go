@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+)
+
+const (
+	SizingFixed         = "fixed"          // fixed number of contracts per trade
+	SizingPercentEquity = "percent_equity" // commit a percent of equity per trade
+	SizingMaxRisk       = "max_risk"       // risk at most a percent of equity per trade
+)
+
+// SizingSpec controls how many strategy units are opened per trade.
+//
+// One unit is the strategy exactly as described by its legs (leg Qty
+// included); Contracts on the Trade multiplies every leg by that amount.
+type SizingSpec struct {
+	Mode          string  `json:"mode,omitempty"`           // "fixed", "percent_equity", "max_risk", default: "fixed"
+	Contracts     int     `json:"contracts,omitempty"`      // fixed mode: units per trade, default: 1
+	PercentEquity float64 `json:"percent_equity,omitempty"` // percent_equity mode: e.g. 5.0 commits 5% of equity
+	MaxRiskPct    float64 `json:"max_risk_pct,omitempty"`   // max_risk mode: e.g. 2.0 risks at most 2% of equity
+	MaxContracts  int     `json:"max_contracts,omitempty"`  // upper bound on units per trade, 0 = unlimited
+}
+
+// contractsFor returns the number of strategy units to open.
+//
+// Parameters:
+//   - equity: account equity at the time of entry
+//   - unitPremium: signed open premium of one unit (positive = debit)
+//   - unitRisk: defined max loss of one unit, 0 if undefined
+//
+// Returns 0 when the account cannot afford a single unit under the
+// selected mode; callers skip the entry in that case.
+func (s SizingSpec) contractsFor(equity, unitPremium, unitRisk float64) int {
+	n := 0
+	switch strings.ToLower(s.Mode) {
+	case SizingPercentEquity:
+		// commit pct of equity to the capital required by one unit:
+		// premium paid for debits, defined risk (or premium if undefined) for credits
+		required := math.Abs(unitPremium)
+		if unitPremium < 0 && unitRisk > 0 {
+			required = unitRisk
+		}
+		if required < 1e-9 || equity <= 0 {
+			return 0
+		}
+		n = int(math.Floor(equity * s.PercentEquity / 100.0 / required))
+	case SizingMaxRisk:
+		// undefined risk cannot be bounded by a risk budget
+		if unitRisk <= 0 || equity <= 0 {
+			return 0
+		}
+		n = int(math.Floor(equity * s.MaxRiskPct / 100.0 / unitRisk))
+	default:
+		n = s.Contracts
+		if n <= 0 {
+			n = 1
+		}
+	}
+
+	if s.MaxContracts > 0 && n > s.MaxContracts {
+		n = s.MaxContracts
+	}
+	return n
+}
+
+// definedRisk returns the maximum loss of one strategy unit at expiry.
+//
+// The payoff of the legs is piecewise linear in the underlying price with
+// kinks at the strikes, so the minimum is found by evaluating the payoff at
+// zero and at every strike, and by checking the slope above the highest
+// strike. All legs are treated as expiring together, which is exact for
+// verticals, condors and butterflies and an approximation for calendars.
+//
+// Parameters:
+//   - legs: resolved strategy legs
+//   - unitPremium: signed open premium of one unit (positive = debit)
+//
+// Returns:
+//   - float64: max loss in dollars (positive), 0 if risk is undefined
+//   - bool: false if the loss is unbounded (e.g. naked short calls)
+func definedRisk(legs []st.TradeLeg, unitPremium float64) (float64, bool) {
+	if len(legs) == 0 {
+		return 0, false
+	}
+
+	// slope of the payoff above the highest strike, in shares, comes from
+	// calls and stock only
+	slope := 0.0
+	for _, leg := range legs {
+		if leg.Spec.IsStock() || strings.ToLower(leg.Spec.OptionType) == "call" {
+			slope += legSign(leg) * float64(leg.Spec.Qty) * legMultiplier(leg)
+		}
+	}
+	if slope < 0 {
+		return 0, false
+	}
+
+	points := []float64{0}
+	for _, leg := range legs {
+		points = append(points, leg.Strike)
+	}
+	sort.Float64s(points)
+
+	minPayoff := math.MaxFloat64
+	for _, s := range points {
+		payoff := 0.0
+		for _, leg := range legs {
+			payoff += legSign(leg) * intrinsic(leg, s) * float64(leg.Spec.Qty) * legMultiplier(leg)
+		}
+		if payoff < minPayoff {
+			minPayoff = payoff
+		}
+	}
+
+	risk := unitPremium - minPayoff
+	if risk <= 0 {
+		return 0, false
+	}
+	return risk, true
+}
+
+// legSign returns -1 for short legs and +1 for long legs.
+func legSign(leg st.TradeLeg) float64 {
+	if strings.ToLower(leg.Spec.Side) == "sell" {
+		return -1.0
+	}
+	return 1.0
+}
+
+// legMultiplier returns the shares behind one unit of leg quantity: the
+// contract multiplier of option legs (default 100), 1 for stock legs.
+func legMultiplier(leg st.TradeLeg) float64 {
+	if leg.Spec.IsStock() {
+		return 1.0
+	}
+	if leg.Multiplier > 0 {
+		return leg.Multiplier
+	}
+	return 100.0
+}
+
+// intrinsic returns the per-share payoff of a leg at underlying price s;
+// a share of stock is worth s.
+func intrinsic(leg st.TradeLeg, s float64) float64 {
+	if leg.Spec.IsStock() {
+		return s
+	}
+	if strings.ToLower(leg.Spec.OptionType) == "call" {
+		return math.Max(0.0, s-leg.Strike)
+	}
+	return math.Max(0.0, leg.Strike-s)
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+)
+
+func TestDefinedRisk(t *testing.T) {
+	tests := []struct {
+		name        string
+		legs        []st.TradeLeg
+		unitPremium float64
+		expected    float64
+		defined     bool
+	}{
+		{
+			name: "put credit spread",
+			legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 100},
+				{Spec: st.LegSpec{Side: "buy", OptionType: "put", Qty: 1}, Strike: 95},
+			},
+			unitPremium: -150,
+			expected:    350,
+			defined:     true,
+		},
+		{
+			name: "long call",
+			legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "buy", OptionType: "call", Qty: 1}, Strike: 100},
+			},
+			unitPremium: 420,
+			expected:    420,
+			defined:     true,
+		},
+		{
+			name: "short put",
+			legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 100},
+			},
+			unitPremium: -200,
+			expected:    9800,
+			defined:     true,
+		},
+		{
+			name: "short straddle",
+			legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 100},
+				{Spec: st.LegSpec{Side: "sell", OptionType: "put", Qty: 1}, Strike: 100},
+			},
+			unitPremium: -800,
+			expected:    0,
+			defined:     false,
+		},
+		{
+			name: "covered call",
+			legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "buy", OptionType: "stock", Qty: 100}},
+				{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 105},
+			},
+			unitPremium: 9800,
+			expected:    9800,
+			defined:     true,
+		},
+		{
+			name: "collar",
+			legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "buy", OptionType: "stock", Qty: 100}},
+				{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 105},
+				{Spec: st.LegSpec{Side: "buy", OptionType: "put", Qty: 1}, Strike: 95},
+			},
+			unitPremium: 9950,
+			expected:    450,
+			defined:     true,
+		},
+		{
+			name: "short stock",
+			legs: []st.TradeLeg{
+				{Spec: st.LegSpec{Side: "sell", OptionType: "underlying", Qty: 100}},
+			},
+			unitPremium: -10000,
+			expected:    0,
+			defined:     false,
+		},
+	}
+
+	for _, test := range tests {
+		actual, ok := definedRisk(test.legs, test.unitPremium)
+		if ok != test.defined {
+			t.Fatalf("%s: expected defined=%v, got %v", test.name, test.defined, ok)
+		}
+		if math.Abs(actual-test.expected) > 1e-9 {
+			t.Fatalf("%s: expected risk %f, got %f", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestContractsFor(t *testing.T) {
+	tests := []struct {
+		spec        SizingSpec
+		equity      float64
+		unitPremium float64
+		unitRisk    float64
+		expected    int
+	}{
+		{SizingSpec{}, 100000, -150, 350, 1},
+		{SizingSpec{Mode: SizingFixed, Contracts: 3}, 100000, -150, 350, 3},
+		{SizingSpec{Mode: SizingPercentEquity, PercentEquity: 5}, 100000, 420, 420, 11},
+		{SizingSpec{Mode: SizingPercentEquity, PercentEquity: 5}, 100000, -150, 350, 14},
+		{SizingSpec{Mode: SizingMaxRisk, MaxRiskPct: 2}, 100000, -150, 350, 5},
+		{SizingSpec{Mode: SizingMaxRisk, MaxRiskPct: 2, MaxContracts: 4}, 100000, -150, 350, 4},
+		{SizingSpec{Mode: SizingMaxRisk, MaxRiskPct: 2}, 100000, -800, 0, 0},
+	}
+
+	for _, test := range tests {
+		actual := test.spec.contractsFor(test.equity, test.unitPremium, test.unitRisk)
+		if actual != test.expected {
+			t.Fatalf("for spec %+v, expected %d contracts, got %d", test.spec, test.expected, actual)
+		}
+	}
+}
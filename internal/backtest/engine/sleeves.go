@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+// PortfolioConfig runs several strategy sleeves together against one account.
+//
+// Each sleeve is a full Config with its own underlying, entry schedule,
+// strategy, exits and limits. Sleeves share the account: their bars are
+// walked in one chronological stream, every sleeve sizes its entries against
+// its allocation of the combined account equity, and margin checks see the
+// requirement of every open position. MaxTrades, MaxConcurrent and
+// OneAtATime apply per sleeve.
+//
+// Example:
+//
+//	{"starting_capital": 250000, "sleeves": [
+//	  {"name": "spy_puts", "allocation_pct": 50, "underlying": "SPY", ...},
+//	  {"name": "qqq_condors", "allocation_pct": 30, "underlying": "QQQ", ...},
+//	  {"name": "aapl_earnings", "allocation_pct": 20, "underlying": "AAPL", ...}]}
+type PortfolioConfig struct {
+	StartingCapital float64  `json:"starting_capital,omitempty"` // shared account capital at start, default: 100000
+	Sleeves         []Sleeve `json:"sleeves"`                    // strategy sleeves, at least one
+	ReportDir       string   `json:"report_dir,omitempty"`       // report directory
+	Verbosity       int      `json:"verbosity,omitempty"`        // 0=errors,1=info,2=debug,3=trace
+}
+
+// Sleeve is one strategy of a portfolio run. The embedded Config's
+// StartingCapital, ReportDir and Verbosity are set from the portfolio; its
+// Universe and MonteCarlo must be left unset.
+type Sleeve struct {
+	Name          string  `json:"name,omitempty"`           // unique sleeve name, default: underlying and position, e.g. "SPY_1"
+	AllocationPct float64 `json:"allocation_pct,omitempty"` // percent of account equity the sleeve sizes against, default: equal split of the rest
+	Config
+}
+
+// SleeveResult is the breakdown of one sleeve of a portfolio run.
+type SleeveResult struct {
+	Name          string  `json:"name"`
+	AllocationPct float64 `json:"allocation_pct"` // percent of account equity the sleeve sized against
+	NetPnL        float64 `json:"net_pnl"`        // net P&L of the sleeve's trades
+	Result                // the sleeve's trades and equity curve on its allocated capital
+}
+
+// PortfolioResult holds the combined and per-sleeve results of a portfolio
+// run.
+type PortfolioResult struct {
+	Result                     // trades of every sleeve and the account equity curve
+	Sleeves     []SleeveResult `json:"sleeves"`     // per-sleeve breakdown, in config order
+	Correlation [][]float64    `json:"correlation"` // correlation of sleeve daily P&L, in sleeve order
+}
+
+// PortfolioEngine runs a PortfolioConfig.
+type PortfolioEngine struct {
+	cfg  *PortfolioConfig
+	prov data.Provider
+}
+
+func NewPortfolioEngine(cfg *PortfolioConfig, prov data.Provider) *PortfolioEngine {
+	return &PortfolioEngine{cfg: cfg, prov: prov}
+}
+
+// Run executes the sleeves of the portfolio together.
+//
+// Every sleeve is prepared as in Engine.Run, then the simulation bars of all
+// sleeves are merged by date, ties going to the earlier sleeve, and stepped
+// one at a time so that positions closed by any sleeve free capital and
+// margin for the next entry of every sleeve. The account is snapshotted into
+// the combined equity curve at the end of each trading day of the merged
+// stream, each sleeve into its own curve at the end of its trading days.
+func (p *PortfolioEngine) Run() (*PortfolioResult, error) {
+	cfg := p.cfg
+	if cfg.ReportDir == "" {
+		cfg.ReportDir = "./out"
+	}
+	if cfg.StartingCapital <= 0 {
+		cfg.StartingCapital = 100000
+	}
+	if cfg.Verbosity < VerbosityError || cfg.Verbosity > VerbosityTrace {
+		cfg.Verbosity = VerbosityInfo
+	}
+	logger.SetVerbosity(cfg.Verbosity)
+
+	allocs, err := cfg.allocations()
+	if err != nil {
+		return nil, err
+	}
+
+	account := newPortfolio(cfg.StartingCapital)
+	runs := make([]*run, len(cfg.Sleeves))
+	for i := range cfg.Sleeves {
+		sl := &cfg.Sleeves[i]
+		sl.AllocationPct = allocs[i]
+		sl.StartingCapital = cfg.StartingCapital * allocs[i] / 100.0
+		sl.ReportDir = cfg.ReportDir
+		sl.Verbosity = cfg.Verbosity
+
+		r, err := NewEngine(&sl.Config, p.prov).prepare()
+		if err != nil {
+			return nil, fmt.Errorf("sleeve %s: %w", sl.Name, err)
+		}
+		r.name = sl.Name
+		r.pf = newPortfolio(sl.StartingCapital)
+		r.account, r.limits = account, r.pf
+		runs[i] = r
+		logger.Infof("sleeve %s: %s, %.1f%% allocation, %d bars", sl.Name, sl.Underlying, allocs[i], len(r.bars))
+	}
+
+	curve := stepAll(runs, account)
+	res := &PortfolioResult{
+		Result: Result{Trades: account.trades(), Equity: curve},
+	}
+	curves := make([][]EquityPoint, len(runs))
+	for i, r := range runs {
+		sr := SleeveResult{
+			Name:          r.name,
+			AllocationPct: allocs[i],
+			Result:        Result{Trades: r.pf.trades(), Equity: r.curve},
+		}
+		for _, tr := range sr.Trades {
+			sr.NetPnL += tr.NetPnL
+		}
+		res.Sleeves = append(res.Sleeves, sr)
+		curves[i] = r.curve
+	}
+	res.Correlation = pnlCorrelation(curves)
+	return res, nil
+}
+
+// allocations names unnamed sleeves, validates them and returns the
+// allocation of each sleeve in percent. Sleeves without an allocation split what the others
+// leave equally.
+func (cfg *PortfolioConfig) allocations() ([]float64, error) {
+	if len(cfg.Sleeves) == 0 {
+		return nil, fmt.Errorf("portfolio has no sleeves")
+	}
+	names := make(map[string]bool)
+	total, unset := 0.0, 0
+	for i := range cfg.Sleeves {
+		sl := &cfg.Sleeves[i]
+		if sl.Name == "" {
+			sl.Name = fmt.Sprintf("%s_%d", strings.ToUpper(sl.Underlying), i+1)
+		}
+		if names[sl.Name] {
+			return nil, fmt.Errorf("duplicate sleeve name %q", sl.Name)
+		}
+		names[sl.Name] = true
+		if sl.AllocationPct < 0 {
+			return nil, fmt.Errorf("sleeve %s: negative allocation_pct", sl.Name)
+		}
+		// a sleeve runs on its Underlying alone and reports with the portfolio
+		if sl.Universe.enabled() {
+			return nil, fmt.Errorf("sleeve %s: universe is not supported in a sleeve", sl.Name)
+		}
+		if sl.MonteCarlo.enabled() {
+			return nil, fmt.Errorf("sleeve %s: monte_carlo is not supported in a sleeve", sl.Name)
+		}
+		if sl.AllocationPct == 0 {
+			unset++
+		}
+		total += sl.AllocationPct
+	}
+	if total > 100+1e-9 {
+		return nil, fmt.Errorf("sleeve allocations add up to %.2f%%, more than 100%%", total)
+	}
+	if unset > 0 && total >= 100 {
+		return nil, fmt.Errorf("no allocation left for %d sleeves without allocation_pct", unset)
+	}
+
+	out := make([]float64, len(cfg.Sleeves))
+	for i, sl := range cfg.Sleeves {
+		out[i] = sl.AllocationPct
+		if out[i] == 0 {
+			out[i] = (100 - total) / float64(unset)
+		}
+	}
+	return out, nil
+}
+
+// stepAll steps several runs in one chronological stream of their bars and
+// returns the account snapshotted at the end of each trading day of the
+// stream.
+func stepAll(runs []*run, account *portfolio) []EquityPoint {
+	curve := []EquityPoint{}
+	id := 1
+	for r := nextRun(runs); r != nil; {
+		b := r.bars[r.next]
+		r.step(&id)
+		next := nextRun(runs)
+		if next == nil || next.e.dayKey(next.bars[next.next]) != r.e.dayKey(b) {
+			curve = append(curve, account.snapshot(b.Date))
+		}
+		r = next
+	}
+	return curve
+}
+
+// nextRun returns the run whose next bar comes first, or nil when every run
+// is done.
+func nextRun(runs []*run) *run {
+	var best *run
+	for _, r := range runs {
+		if r.next >= len(r.bars) {
+			continue
+		}
+		if best == nil || r.bars[r.next].Date.Before(best.bars[best.next].Date) {
+			best = r
+		}
+	}
+	return best
+}
+
+// pnlCorrelation returns the Pearson correlation matrix of the daily equity
+// changes of several curves. Curves are aligned on the union of their dates,
+// carrying a curve's last equity over days it has no point for. A curve that
+// never changes correlates 0 with the others.
+func pnlCorrelation(curves [][]EquityPoint) [][]float64 {
+	days := make(map[string]bool)
+	for _, c := range curves {
+		for _, pt := range c {
+			days[pt.Date.Format("2006-01-02")] = true
+		}
+	}
+	keys := make([]string, 0, len(days))
+	for k := range days {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	changes := make([][]float64, len(curves))
+	for i, c := range curves {
+		byDay := make(map[string]float64, len(c))
+		for _, pt := range c {
+			byDay[pt.Date.Format("2006-01-02")] = pt.Equity
+		}
+		prev := math.NaN()
+		for _, k := range keys {
+			eq, ok := byDay[k]
+			if !ok {
+				eq = prev
+			}
+			if !math.IsNaN(prev) && !math.IsNaN(eq) {
+				changes[i] = append(changes[i], eq-prev)
+			} else {
+				changes[i] = append(changes[i], 0)
+			}
+			prev = eq
+		}
+	}
+
+	out := make([][]float64, len(curves))
+	for i := range curves {
+		out[i] = make([]float64, len(curves))
+		for j := range curves {
+			if i == j {
+				out[i][j] = 1
+				continue
+			}
+			out[i][j] = pearson(changes[i], changes[j])
+		}
+	}
+	return out
+}
+
+// pearson returns the correlation of two equal-length series, or 0 if
+// either has no variance.
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	if n < 2 {
+		return 0
+	}
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= n
+	my /= n
+	var cov, vx, vy float64
+	for i := range x {
+		cov += (x[i] - mx) * (y[i] - my)
+		vx += (x[i] - mx) * (x[i] - mx)
+		vy += (y[i] - my) * (y[i] - my)
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPortfolioAllocations(t *testing.T) {
+	cfg := &PortfolioConfig{Sleeves: []Sleeve{
+		{AllocationPct: 50, Config: Config{Underlying: "spy"}},
+		{Name: "condors", Config: Config{Underlying: "QQQ"}},
+		{Config: Config{Underlying: "AAPL"}},
+	}}
+	allocs, err := cfg.allocations()
+	if err != nil {
+		t.Fatalf("allocations: %v", err)
+	}
+	if allocs[0] != 50 || allocs[1] != 25 || allocs[2] != 25 {
+		t.Fatalf("expected 50/25/25 split, got %v", allocs)
+	}
+	if cfg.Sleeves[0].Name != "SPY_1" || cfg.Sleeves[2].Name != "AAPL_3" {
+		t.Fatalf("expected default sleeve names, got %q and %q", cfg.Sleeves[0].Name, cfg.Sleeves[2].Name)
+	}
+
+	for _, bad := range []*PortfolioConfig{
+		{},
+		{Sleeves: []Sleeve{{AllocationPct: 70}, {AllocationPct: 40}}},
+		{Sleeves: []Sleeve{{AllocationPct: 100}, {}}},
+		{Sleeves: []Sleeve{{Name: "a"}, {Name: "a"}}},
+	} {
+		if _, err := bad.allocations(); err == nil {
+			t.Errorf("expected error for sleeves %+v", bad.Sleeves)
+		}
+	}
+
+	// a sleeve runs on its underlying alone, so universe and Monte Carlo settings are rejected
+	for _, sl := range []Sleeve{
+		{Config: Config{Underlying: "SPY", Universe: UniverseSpec{Symbols: []string{"SPY", "QQQ"}}}},
+		{Config: Config{Underlying: "SPY", MonteCarlo: MonteCarloSpec{Runs: 1000}}},
+	} {
+		_, err := NewPortfolioEngine(&PortfolioConfig{Sleeves: []Sleeve{sl}}, nil).Run()
+		if err == nil || !strings.Contains(err.Error(), "not supported in a sleeve") {
+			t.Errorf("expected the sleeve rejected, got %v", err)
+		}
+	}
+}
+
+func TestSleeveSizingEquity(t *testing.T) {
+	account := newPortfolio(200000)
+	r := &run{pf: newPortfolio(50000), account: account}
+	account.add(&Trade{OpenPremium: -1000, mark: 1000})
+	// a quarter of the account equity, profits of other sleeves included
+	if got := r.sizingEquity(); math.Abs(got-50500) > 1e-9 {
+		t.Fatalf("expected sizing equity 50500, got %.2f", got)
+	}
+}
+
+func TestPnLCorrelation(t *testing.T) {
+	day := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	curve := func(equity ...float64) []EquityPoint {
+		out := make([]EquityPoint, len(equity))
+		for i, eq := range equity {
+			out[i] = EquityPoint{Date: day.AddDate(0, 0, i), Equity: eq}
+		}
+		return out
+	}
+	a := curve(100, 110, 105, 120, 118)
+	b := curve(50, 55, 52.5, 60, 59)  // a scaled down
+	c := curve(100, 90, 95, 80, 82)   // a mirrored
+	flat := curve(100, 100, 100, 100) // one day short, never changes
+	m := pnlCorrelation([][]EquityPoint{a, b, c, flat})
+
+	if math.Abs(m[0][1]-1) > 1e-9 || math.Abs(m[0][2]+1) > 1e-9 {
+		t.Fatalf("expected correlations 1 and -1, got %.4f and %.4f", m[0][1], m[0][2])
+	}
+	if m[0][3] != 0 || m[3][3] != 1 || m[1][0] != m[0][1] {
+		t.Fatalf("unexpected correlation matrix %v", m)
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"math"
+)
+
+// maxProfitFactor caps Summary.ProfitFactor so that runs without losing
+// trades stay comparable and encodable.
+const maxProfitFactor = 999
+
+// Summary holds the headline metrics of a run.
+type Summary struct {
+	Trades         int     `json:"trades"`           // trades opened
+	WinRate        float64 `json:"win_rate"`         // percent of trades with positive net P&L
+	NetPnL         float64 `json:"net_pnl"`          // net P&L of all trades
+	AvgPnL         float64 `json:"avg_pnl"`          // net P&L per trade
+	ProfitFactor   float64 `json:"profit_factor"`    // gross wins over gross losses, capped at 999 (no losses)
+	ReturnPct      float64 `json:"return_pct"`       // NetPnL as a percent of starting capital
+	CAGR           float64 `json:"cagr"`             // compound annual growth of equity, in percent
+	MaxDrawdownPct float64 `json:"max_drawdown_pct"` // largest peak-to-trough fall of equity, in percent of the peak
+	Sharpe         float64 `json:"sharpe"`           // annualized Sharpe ratio of daily equity returns, risk-free 0
+}
+
+// Summarize computes the headline metrics of a result against the starting
+// capital of its run.
+func Summarize(res *Result, capital float64) Summary {
+	s := Summary{Trades: len(res.Trades)}
+	var wins, won, lost float64
+	for _, tr := range res.Trades {
+		s.NetPnL += tr.NetPnL
+		if tr.NetPnL > 0 {
+			wins++
+			won += tr.NetPnL
+		} else {
+			lost -= tr.NetPnL
+		}
+	}
+	if s.Trades > 0 {
+		s.WinRate = wins / float64(s.Trades) * 100.0
+		s.AvgPnL = s.NetPnL / float64(s.Trades)
+		s.ProfitFactor = maxProfitFactor
+		if lost > 0 {
+			s.ProfitFactor = math.Min(won/lost, maxProfitFactor)
+		}
+	}
+	if capital > 0 {
+		s.ReturnPct = s.NetPnL / capital * 100.0
+	}
+
+	curve := res.Equity
+	if len(curve) < 2 || capital <= 0 {
+		return s
+	}
+	peak := capital
+	var rets []float64
+	prev := capital
+	for _, pt := range curve {
+		peak = math.Max(peak, pt.Equity)
+		if peak > 0 {
+			s.MaxDrawdownPct = math.Max(s.MaxDrawdownPct, (peak-pt.Equity)/peak*100.0)
+		}
+		if prev > 0 {
+			rets = append(rets, pt.Equity/prev-1)
+		}
+		prev = pt.Equity
+	}
+	if years := curve[len(curve)-1].Date.Sub(curve[0].Date).Hours() / (24 * 365.25); years > 0 {
+		if last := curve[len(curve)-1].Equity; last > 0 {
+			if g := (math.Pow(last/capital, 1/years) - 1) * 100.0; !math.IsInf(g, 0) {
+				s.CAGR = g
+			}
+		}
+	}
+
+	mean, sd := meanStd(rets)
+	if sd > 0 {
+		s.Sharpe = mean / sd * math.Sqrt(252)
+	}
+	return s
+}
+
+// meanStd returns the mean and sample standard deviation of xs.
+func meanStd(xs []float64) (float64, float64) {
+	if len(xs) < 2 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	v := 0.0
+	for _, x := range xs {
+		v += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(v / float64(len(xs)-1))
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	res := &Result{
+		Trades: []Trade{{NetPnL: 300}, {NetPnL: -100}, {NetPnL: 200}, {NetPnL: -100}},
+	}
+	for i, eq := range []float64{100000, 101000, 99000, 100500, 100300} {
+		res.Equity = append(res.Equity, EquityPoint{Date: day.AddDate(0, 0, i), Equity: eq})
+	}
+	s := Summarize(res, 100000)
+
+	if s.Trades != 4 || s.WinRate != 50 || s.NetPnL != 300 || s.AvgPnL != 75 || s.ProfitFactor != 2.5 {
+		t.Fatalf("unexpected trade metrics %+v", s)
+	}
+	if math.Abs(s.ReturnPct-0.3) > 1e-9 {
+		t.Fatalf("expected return 0.3%%, got %.4f", s.ReturnPct)
+	}
+	// 101000 -> 99000
+	if want := 2000.0 / 101000 * 100; math.Abs(s.MaxDrawdownPct-want) > 1e-9 {
+		t.Fatalf("expected max drawdown %.4f%%, got %.4f", want, s.MaxDrawdownPct)
+	}
+	if s.Sharpe == 0 || s.CAGR <= 0 {
+		t.Fatalf("expected sharpe and cagr, got %+v", s)
+	}
+
+	if s := Summarize(&Result{Trades: []Trade{{NetPnL: 10}}}, 1000); s.ProfitFactor != maxProfitFactor || s.Sharpe != 0 {
+		t.Fatalf("expected capped profit factor without losses, got %+v", s)
+	}
+}
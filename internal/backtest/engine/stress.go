@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+// stressVolDays is the window of the realized volatility that stands in for
+// implied volatility when historical episodes are replayed.
+const stressVolDays = 20
+
+// StressSpec reprices a position under shocked scenarios before, or while,
+// it is on.
+//
+// The position is either Trade, e.g. copied from trades.json, or the
+// embedded Config's Strategy planned at Date on Underlying. Its legs are
+// valued at Date like an open trade (implied volatility from the provider's
+// prices, historical volatility otherwise), then repriced with
+// Black-Scholes at every combination of Days of time decay, IVPoints of
+// volatility shift and SpotPct of underlying move. Historical episodes
+// replay the moves of real bars on the position. Example, a planned put
+// spread:
+//
+//	{"underlying": "SPY", "date": "2025-03-03T00:00:00Z",
+//	 "strategy": {"dte": 30, "strategy": [...]},
+//	 "spot_pct": [-20, -10, -5, 0, 5], "iv_points": [0, 10, 25], "days": [0, 7],
+//	 "historical": [{"name": "2020-03"}, {"name": "2022-06", "symbol": "QQQ"}]}
+type StressSpec struct {
+	Config
+	Date       time.Time         `json:"date,omitempty"`       // valuation date, default: the trade's open date
+	Trade      *Trade            `json:"trade,omitempty"`      // position to stress, default: Strategy planned at Date
+	Contracts  int               `json:"contracts,omitempty"`  // strategy units of a planned position, default: 1
+	SpotPct    []float64         `json:"spot_pct,omitempty"`   // underlying moves in percent, default: [-20, -10, -5, 0, 5, 10, 20]
+	IVPoints   []float64         `json:"iv_points,omitempty"`  // implied volatility shifts in vol points, default: [-10, 0, 10, 20]
+	Days       []int             `json:"days,omitempty"`       // calendar days of time decay, default: [0]
+	Historical []HistoricalShock `json:"historical,omitempty"` // historical episodes to replay
+}
+
+// HistoricalShock is a market episode replayed on a position: the move of
+// Symbol's close from Start to each day through End, the change of its
+// realized volatility as an implied volatility shift, and the calendar days
+// elapsed as time decay.
+type HistoricalShock struct {
+	Name   string    `json:"name"`             // preset, e.g. "2020-03", or a label for Start..End
+	Symbol string    `json:"symbol,omitempty"` // bars to replay, default: the position's underlying
+	Start  time.Time `json:"start,omitempty"`  // close the episode is measured from, default: the preset's
+	End    time.Time `json:"end,omitempty"`    // last day of the episode, default: the preset's
+}
+
+// historicalShocks are the preset episodes by name, from the last close
+// before the sell-off to its trough.
+var historicalShocks = map[string]HistoricalShock{
+	"2008-10": {Start: time.Date(2008, 9, 19, 0, 0, 0, 0, time.UTC), End: time.Date(2008, 10, 10, 0, 0, 0, 0, time.UTC)},
+	"2010-05": {Start: time.Date(2010, 4, 23, 0, 0, 0, 0, time.UTC), End: time.Date(2010, 5, 7, 0, 0, 0, 0, time.UTC)},
+	"2011-08": {Start: time.Date(2011, 7, 22, 0, 0, 0, 0, time.UTC), End: time.Date(2011, 8, 8, 0, 0, 0, 0, time.UTC)},
+	"2015-08": {Start: time.Date(2015, 8, 17, 0, 0, 0, 0, time.UTC), End: time.Date(2015, 8, 24, 0, 0, 0, 0, time.UTC)},
+	"2018-02": {Start: time.Date(2018, 1, 26, 0, 0, 0, 0, time.UTC), End: time.Date(2018, 2, 8, 0, 0, 0, 0, time.UTC)},
+	"2018-12": {Start: time.Date(2018, 11, 30, 0, 0, 0, 0, time.UTC), End: time.Date(2018, 12, 24, 0, 0, 0, 0, time.UTC)},
+	"2020-03": {Start: time.Date(2020, 2, 19, 0, 0, 0, 0, time.UTC), End: time.Date(2020, 3, 23, 0, 0, 0, 0, time.UTC)},
+	"2022-06": {Start: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC)},
+}
+
+// StressLeg is a leg of the stressed position valued at the stress date.
+type StressLeg struct {
+	Leg   st.TradeLeg `json:"leg"`
+	Price float64     `json:"price"` // per-share value at the stress date
+	IV    float64     `json:"iv"`    // volatility the leg is repriced from
+}
+
+// StressGrid is the P&L of the position across the spot moves of one time
+// decay and volatility shift.
+type StressGrid struct {
+	Days     int       `json:"days"`
+	IVPoints float64   `json:"iv_points"`
+	PnL      []float64 `json:"pnl"` // P&L at each StressResult.SpotPct
+}
+
+// HistoricalResult is the outcome of replaying a historical episode.
+type HistoricalResult struct {
+	HistoricalShock
+	SpotPct   float64   `json:"spot_pct"`        // underlying move from Start to End, in percent
+	IVPoints  float64   `json:"iv_points"`       // change in realized volatility from Start to End, in vol points
+	Days      int       `json:"days"`            // calendar days from Start to End
+	PnL       float64   `json:"pnl"`             // P&L with the moves of End
+	WorstPnL  float64   `json:"worst_pnl"`       // lowest P&L over the days of the episode
+	WorstDate time.Time `json:"worst_date"`      // day of WorstPnL
+	Error     string    `json:"error,omitempty"` // why the episode could not be replayed
+}
+
+// StressResult holds the scenario P&L of a stressed position, relative to
+// its value at Date.
+type StressResult struct {
+	Underlying string             `json:"underlying"`
+	Date       time.Time          `json:"date"`       // valuation date
+	Spot       float64            `json:"spot"`       // underlying close at Date
+	Contracts  int                `json:"contracts"`  // strategy units
+	Value      float64            `json:"value"`      // position value at Date, negative for net short premium
+	Legs       []StressLeg        `json:"legs"`       // legs still open at Date
+	SpotPct    []float64          `json:"spot_pct"`   // spot moves of the grids, in percent
+	Grids      []StressGrid       `json:"grids"`      // one per time decay and volatility shift
+	Historical []HistoricalResult `json:"historical"` // replayed episodes, in spec order
+}
+
+// Stress values a position at spec.Date and reprices it under the spec's
+// scenarios.
+func Stress(spec *StressSpec, prov data.Provider) (*StressResult, error) {
+	cfg := &spec.Config
+	if spec.Trade != nil {
+		if cfg.Underlying == "" {
+			cfg.Underlying = spec.Trade.Underlying
+		}
+		if spec.Date.IsZero() {
+			spec.Date = spec.Trade.OpenDateTime
+		}
+	}
+	cfg.fillDefaults()
+	if cfg.Underlying == "" || spec.Date.IsZero() {
+		return nil, fmt.Errorf("stress needs an underlying and a date")
+	}
+	if spec.Trade == nil && len(cfg.Strategy.Legs) == 0 {
+		return nil, fmt.Errorf("stress needs a trade or a strategy")
+	}
+	if len(spec.SpotPct) == 0 {
+		spec.SpotPct = []float64{-20, -10, -5, 0, 5, 10, 20}
+	}
+	if len(spec.IVPoints) == 0 {
+		spec.IVPoints = []float64{-10, 0, 10, 20}
+	}
+	if len(spec.Days) == 0 {
+		spec.Days = []int{0}
+	}
+	for _, d := range spec.Days {
+		if d < 0 {
+			return nil, fmt.Errorf("days must not be negative")
+		}
+	}
+
+	e := NewEngine(cfg, prov)
+	if cfg.Products != "" {
+		if err := e.registry().LoadFile(cfg.Products); err != nil {
+			return nil, err
+		}
+	}
+	bars, err := prov.GetBars(cfg.Underlying, spec.Date.AddDate(0, 0, -90), spec.Date, 1, "day")
+	if err != nil || len(bars) == 0 {
+		return nil, fmt.Errorf("no %s bars on or before %s: %v", cfg.Underlying, spec.Date.Format("2006-01-02"), err)
+	}
+	b := bars[len(bars)-1]
+	e.hv = AnnualizedVolatility(extractCloses(bars))
+	e.loadDividends(b.Date, b.Date)
+
+	legs, contracts := []st.TradeLeg(nil), spec.Contracts
+	if spec.Trade != nil {
+		contracts = spec.Trade.Contracts
+		for _, leg := range spec.Trade.Legs {
+			if !e.legExpired(leg, b.Date) {
+				legs = append(legs, leg)
+			}
+		}
+	} else {
+		e.expiries, err = prov.GetRelevantExpiries(cfg.Underlying, b.Date, b.Date.AddDate(1, 0, 0))
+		if err != nil {
+			return nil, fmt.Errorf("get relevant expiries: %w", err)
+		}
+		legs, err = st.PlanStrategy(cfg.Strategy, b.Date, cfg.Underlying, b.Close, e.expiries, prov, e.registry())
+		if err != nil {
+			return nil, fmt.Errorf("build legs error: %w", err)
+		}
+		e.stampMultiplier(legs)
+	}
+	if contracts <= 0 {
+		contracts = 1
+	}
+
+	res := &StressResult{Underlying: cfg.Underlying, Date: b.Date, Spot: b.Close, Contracts: contracts, SpotPct: spec.SpotPct}
+	for _, leg := range legs {
+		m, _ := e.priceLeg(leg, b.Close, b.Date)
+		res.Legs = append(res.Legs, StressLeg{Leg: leg, Price: m.Price, IV: m.IV})
+	}
+	res.Value = e.stressValue(res, b.Close, 0, 0)
+	logger.Infof("stress %s at %s: spot=%.2f value=%.2f legs=%d", cfg.Underlying, b.Date.Format("2006-01-02"), b.Close, res.Value, len(res.Legs))
+
+	for _, d := range spec.Days {
+		for _, iv := range spec.IVPoints {
+			g := StressGrid{Days: d, IVPoints: iv}
+			for _, pct := range spec.SpotPct {
+				g.PnL = append(g.PnL, e.stressValue(res, b.Close*(1+pct/100.0), d, iv)-res.Value)
+			}
+			res.Grids = append(res.Grids, g)
+		}
+	}
+	for _, h := range spec.Historical {
+		res.Historical = append(res.Historical, e.replay(res, h))
+	}
+	return res, nil
+}
+
+// stressValue returns the value of the stressed position with the
+// underlying at spot, days later and with volatility shifted by ivPoints.
+// Legs expired by then are worth their intrinsic value.
+func (e *Engine) stressValue(res *StressResult, spot float64, days int, ivPoints float64) float64 {
+	at := res.Date.AddDate(0, 0, days)
+	total := 0.0
+	for _, sl := range res.Legs {
+		leg := sl.Leg
+		p := intrinsic(leg, spot)
+		if !e.legExpired(leg, at) {
+			p = e.modelPrice(leg, spot, at, math.Max(sl.IV+ivPoints/100.0, 0.01))
+		}
+		total += legSign(leg) * p * float64(leg.Spec.Qty) * float64(res.Contracts) * legMultiplier(leg)
+	}
+	return total
+}
+
+// replay applies a historical episode to the stressed position day by day.
+func (e *Engine) replay(res *StressResult, h HistoricalShock) HistoricalResult {
+	if p, ok := historicalShocks[h.Name]; ok {
+		if h.Start.IsZero() {
+			h.Start = p.Start
+		}
+		if h.End.IsZero() {
+			h.End = p.End
+		}
+	}
+	if h.Symbol == "" {
+		h.Symbol = res.Underlying
+	}
+	out := HistoricalResult{HistoricalShock: h}
+	if h.Start.IsZero() || !h.End.After(h.Start) {
+		out.Error = fmt.Sprintf("unknown episode %q: set start and end", h.Name)
+		return out
+	}
+
+	bars, err := e.prov.GetBars(h.Symbol, h.Start.AddDate(0, 0, -3*stressVolDays), h.End, 1, "day")
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	base := sort.Search(len(bars), func(i int) bool { return bars[i].Date.After(h.Start) }) - 1
+	if base < stressVolDays || base >= len(bars)-1 {
+		out.Error = fmt.Sprintf("not enough %s bars around %s..%s", h.Symbol, h.Start.Format("2006-01-02"), h.End.Format("2006-01-02"))
+		return out
+	}
+	closes := extractCloses(bars)
+	vol := func(i int) float64 { return AnnualizedVolatility(closes[i-stressVolDays : i+1]) }
+
+	out.WorstPnL = math.Inf(1)
+	for i := base + 1; i < len(bars); i++ {
+		out.SpotPct = (closes[i]/closes[base] - 1) * 100.0
+		out.IVPoints = (vol(i) - vol(base)) * 100.0
+		out.Days = int(math.Round(bars[i].Date.Sub(bars[base].Date).Hours() / 24))
+		out.PnL = e.stressValue(res, res.Spot*(1+out.SpotPct/100.0), out.Days, out.IVPoints) - res.Value
+		if out.PnL < out.WorstPnL {
+			out.WorstPnL, out.WorstDate = out.PnL, bars[i].Date
+		}
+	}
+	logger.Infof("stress %s replayed on %s: spot %.1f%% iv %+.1f pts pnl=%.2f worst=%.2f",
+		h.Name, h.Symbol, out.SpotPct, out.IVPoints, out.PnL, out.WorstPnL)
+	return out
+}
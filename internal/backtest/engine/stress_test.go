@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	st "github.com/contactkeval/option-replay/internal/backtest/strategy"
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestStressPlannedPosition(t *testing.T) {
+	spec := &StressSpec{
+		Config: Config{
+			Underlying: "SPY",
+			Strategy: st.StrategySpec{DaysToExpiry: 30, Legs: []st.LegSpec{
+				{Side: "sell", OptionType: "put", StrikeRule: "ATM", Qty: 1},
+			}},
+		},
+		Date:       time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		SpotPct:    []float64{-20, 0, 20},
+		IVPoints:   []float64{0, 10},
+		Days:       []int{0, 14},
+		Historical: []HistoricalShock{{Name: "2020-03"}, {Name: "1929-10"}},
+	}
+	res, err := Stress(spec, data.NewSyntheticProvider())
+	if err != nil {
+		t.Fatalf("Stress: %v", err)
+	}
+	if len(res.Legs) != 1 || res.Value >= 0 || len(res.Grids) != 4 {
+		t.Fatalf("expected one short leg valued below 0 and 4 grids, got %+v", res)
+	}
+	if p := res.Legs[0].Price * 100; math.Abs(res.Value+p) > 1e-6 {
+		t.Fatalf("expected the model to reproduce the leg price %.4f, got value %.4f", p, res.Value)
+	}
+
+	flat, volUp, decayed := res.Grids[0], res.Grids[1], res.Grids[2]
+	if math.Abs(flat.PnL[1]) > 1e-9 {
+		t.Fatalf("expected no P&L without a shock, got %.4f", flat.PnL[1])
+	}
+	if flat.PnL[0] >= 0 || flat.PnL[2] <= 0 {
+		t.Fatalf("expected a short put to lose on a drop and gain on a rally, got %v", flat.PnL)
+	}
+	if volUp.PnL[1] >= 0 || decayed.PnL[1] <= 0 {
+		t.Fatalf("expected a short put to lose on a vol rise and gain on decay, got %.2f and %.2f", volUp.PnL[1], decayed.PnL[1])
+	}
+
+	crash, unknown := res.Historical[0], res.Historical[1]
+	if crash.Error != "" || crash.Symbol != "SPY" || crash.Days != 33 || crash.WorstPnL > crash.PnL {
+		t.Fatalf("expected the 2020-03 episode replayed on SPY over 33 days, got %+v", crash)
+	}
+	if unknown.Error == "" {
+		t.Fatalf("expected an unknown episode without dates to fail")
+	}
+}
+
+func TestStressTrade(t *testing.T) {
+	exp := time.Date(2021, 7, 16, 0, 0, 0, 0, time.UTC)
+	tr := &Trade{
+		Underlying:   "SPY",
+		OpenDateTime: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		Contracts:    2,
+		Legs: []st.TradeLeg{
+			{Spec: st.LegSpec{Side: "buy", OptionType: "call", Qty: 1}, Strike: 1, Expiration: exp},
+			{Spec: st.LegSpec{Side: "sell", OptionType: "call", Qty: 1}, Strike: 1, Expiration: exp.AddDate(0, 0, -14)},
+		},
+	}
+	spec := &StressSpec{Trade: tr, Date: exp.AddDate(0, 0, -7), SpotPct: []float64{0, 10}, IVPoints: []float64{0}}
+	res, err := Stress(spec, data.NewSyntheticProvider())
+	if err != nil {
+		t.Fatalf("Stress: %v", err)
+	}
+	if res.Underlying != "SPY" || res.Contracts != 2 || len(res.Legs) != 1 {
+		t.Fatalf("expected the expired short call dropped from a 2-lot SPY trade, got %+v", res)
+	}
+	// a deep in-the-money call moves one for one with the underlying
+	if want := res.Spot * 0.10 * 200; math.Abs(res.Grids[0].PnL[1]-want) > 0.01*want {
+		t.Fatalf("expected about %.2f on a 10%% rally, got %.2f", want, res.Grids[0].PnL[1])
+	}
+}
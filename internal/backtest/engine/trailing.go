@@ -0,0 +1,91 @@
+package engine
+
+import "fmt"
+
+// TrailingStopRule exits once the trade's P&L retraces from its best level.
+//
+// P&L follows the ProfitTargetRule sign convention: premium minus open
+// premium, so the best level is reached at Trade.HighPremium for credits and
+// debits alike. Percent values are measured against the absolute open
+// premium. Either or both of RetracePct and RetraceAmount may be set; the
+// first one breached closes the trade.
+type TrailingStopRule struct {
+	ActivationPct float64 `json:"activation_pct,omitempty"` // start trailing once best P&L reaches this %, 0 = from open
+	RetracePct    float64 `json:"retrace_pct,omitempty"`    // exit when P&L falls this many % points below its best, 0 = off
+	RetraceAmount float64 `json:"retrace_amount,omitempty"` // exit when P&L falls this many dollars below its best, 0 = off
+}
+
+// Check implements ExitRule.
+func (r TrailingStopRule) Check(ctx ExitContext) ExitDecision {
+	tr := ctx.Trade
+	best := tr.HighPremium - tr.OpenPremium
+	bestPct := changePct(tr, tr.HighPremium)
+	if bestPct < r.ActivationPct {
+		return ExitDecision{}
+	}
+
+	pnl := ctx.Premium - tr.OpenPremium
+	if r.RetracePct > 0 && bestPct-changePct(tr, ctx.Premium) >= r.RetracePct {
+		return ExitDecision{Exit: true, Reason: fmt.Sprintf("trailing_stop_%.2f%%", r.RetracePct)}
+	}
+	if r.RetraceAmount > 0 && best-pnl >= r.RetraceAmount {
+		return ExitDecision{Exit: true, Reason: fmt.Sprintf("trailing_stop_$%.2f", r.RetraceAmount)}
+	}
+	return ExitDecision{}
+}
+
+func (r TrailingStopRule) validate() error {
+	if r.RetracePct <= 0 && r.RetraceAmount <= 0 {
+		return fmt.Errorf("trailing stop needs retrace_pct or retrace_amount")
+	}
+	return nil
+}
+
+// ProfitLockStep is one rung of a profit-lock ladder.
+type ProfitLockStep struct {
+	TriggerPct float64 `json:"trigger_pct"` // rung activates once best P&L reaches this %, e.g. 50.0
+	LockPct    float64 `json:"lock_pct"`    // then exit if P&L falls back to this %, e.g. 25.0 (0 = breakeven)
+}
+
+// ProfitLockRule exits when the P&L falls back to the level locked in by
+// the highest rung reached so far, e.g. "once up 30%, stop at breakeven;
+// once up 50%, lock in 25%". Percentages follow the ProfitTargetRule sign
+// convention and are measured against the absolute open premium.
+type ProfitLockRule struct {
+	Steps []ProfitLockStep `json:"steps"` // ladder rungs, in any order
+}
+
+// Check implements ExitRule.
+func (r ProfitLockRule) Check(ctx ExitContext) ExitDecision {
+	tr := ctx.Trade
+	bestPct := changePct(tr, tr.HighPremium)
+
+	// the highest rung reached sets the lock
+	var lock *ProfitLockStep
+	for i, s := range r.Steps {
+		if bestPct >= s.TriggerPct && (lock == nil || s.TriggerPct > lock.TriggerPct) {
+			lock = &r.Steps[i]
+		}
+	}
+	if lock == nil || changePct(tr, ctx.Premium) > lock.LockPct {
+		return ExitDecision{}
+	}
+	return ExitDecision{Exit: true, Reason: fmt.Sprintf("profit_lock_%.2f%%", lock.LockPct)}
+}
+
+func (r ProfitLockRule) validate() error {
+	if len(r.Steps) == 0 {
+		return fmt.Errorf("profit lock needs at least one step")
+	}
+	for _, s := range r.Steps {
+		if s.LockPct >= s.TriggerPct {
+			return fmt.Errorf("profit lock step lock_pct %.2f must be below trigger_pct %.2f", s.LockPct, s.TriggerPct)
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterExitRule("trailing_stop", decodeRule(TrailingStopRule{}))
+	RegisterExitRule("profit_lock", decodeRule(ProfitLockRule{}))
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTrailingStopRule(t *testing.T) {
+	r := TrailingStopRule{ActivationPct: 20, RetracePct: 15, RetraceAmount: 150}
+
+	// credit of 400: best premium -200 is +50%
+	credit := &Trade{OpenPremium: -400, HighPremium: -200}
+	cases := []struct {
+		premium float64
+		want    string
+	}{
+		{-220, ""},                     // +45%, 5 points off the best
+		{-260, "trailing_stop_15.00%"}, // +35%, 15 points off the best
+	}
+	for _, c := range cases {
+		if d := r.Check(ExitContext{Trade: credit, Premium: c.premium}); d.Reason != c.want {
+			t.Errorf("credit premium %.0f: expected %q, got %+v", c.premium, c.want, d)
+		}
+	}
+
+	// debit of 2000: best premium 2600 is +30%, a $160 retrace is only 8 points
+	debit := &Trade{OpenPremium: 2000, HighPremium: 2600}
+	if d := r.Check(ExitContext{Trade: debit, Premium: 2440}); d.Reason != "trailing_stop_$150.00" {
+		t.Errorf("debit: expected dollar trailing stop, got %+v", d)
+	}
+
+	// not activated below +20%
+	quiet := &Trade{OpenPremium: 1000, HighPremium: 1100}
+	if d := r.Check(ExitContext{Trade: quiet, Premium: 900}); d.Exit {
+		t.Errorf("expected inactive trailing stop, got %+v", d)
+	}
+
+	if _, err := NewExitRule(ExitRuleSpec{Name: "trailing_stop", Params: json.RawMessage(`{"activation_pct": 10}`)}); err == nil {
+		t.Errorf("expected error without a retrace threshold")
+	}
+}
+
+func TestProfitLockRule(t *testing.T) {
+	rule, err := NewExitRule(ExitRuleSpec{
+		Name:   "profit_lock",
+		Params: json.RawMessage(`{"steps": [{"trigger_pct": 50, "lock_pct": 25}, {"trigger_pct": 30, "lock_pct": 0}]}`),
+	})
+	if err != nil {
+		t.Fatalf("build profit lock: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		high    float64
+		premium float64
+		want    string
+	}{
+		{"no rung reached", -300, -500, ""},
+		{"breakeven rung holds", -260, -390, ""},
+		{"breakeven rung fires", -260, -400, "profit_lock_0.00%"},
+		{"25% rung holds", -180, -280, ""},
+		{"25% rung fires", -180, -300, "profit_lock_25.00%"},
+	}
+	for _, c := range cases {
+		tr := &Trade{OpenPremium: -400, HighPremium: c.high}
+		if d := rule.Check(ExitContext{Trade: tr, Premium: c.premium}); d.Reason != c.want {
+			t.Errorf("%s: expected %q, got %+v", c.name, c.want, d)
+		}
+	}
+
+	bad := json.RawMessage(`{"steps": [{"trigger_pct": 30, "lock_pct": 40}]}`)
+	if _, err := NewExitRule(ExitRuleSpec{Name: "profit_lock", Params: bad}); err == nil {
+		t.Errorf("expected error for lock above trigger")
+	}
+}
@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+const (
+	RankIV        = "iv"        // ATM implied volatility of the nearest expiry a week or more out
+	RankIVRank    = "iv_rank"   // IV within the range of the underlying's realized volatility
+	RankLiquidity = "liquidity" // average daily dollar volume
+	RankPrice     = "price"     // last close
+	RankExpr      = "expr"      // expression over bar data, see UniverseSpec.Expr
+)
+
+// UniverseSpec points a strategy at a universe of underlyings instead of
+// Config.Underlying.
+//
+// Every symbol is scheduled by Config.Entry on its own bars. On each
+// scheduled date the symbols scheduled that day are ranked and positions are
+// opened in the Top of them; the rest skip the date. Scores use daily bars up
+// to the entry date (intraday: up to the day before). All symbols share the
+// account, and MaxTrades, MaxConcurrent and OneAtATime apply to the whole
+// universe.
+//
+// Expressions may use CLOSE, OPEN, HIGH, LOW and VOLUME of the last bar,
+// DOLLAR_VOLUME (average close × volume over Window bars), RETURN (percent
+// change over Window bars), HV (realized volatility over Window bars, in
+// percent), IV and IV_RANK. Example, selling premium in the 5 highest-IV
+// names each week:
+// {"symbols": ["AAPL", "MSFT", "NVDA", ...], "rank_by": "iv", "top": 5}
+type UniverseSpec struct {
+	Symbols    []string `json:"symbols,omitempty"`     // underlyings, e.g. ["AAPL", "MSFT"]
+	File       string   `json:"file,omitempty"`        // local CSV of underlyings: a "symbol" column, else the first column
+	RankBy     string   `json:"rank_by,omitempty"`     // "iv", "iv_rank", "liquidity", "price" or "expr", default: "iv"
+	Expr       string   `json:"expr,omitempty"`        // expr: score expression, e.g. "HV / IV"
+	Ascending  bool     `json:"ascending,omitempty"`   // pick the lowest scores, default: highest
+	Top        int      `json:"top,omitempty"`         // symbols opened per scheduled date, default: 1
+	Window     int      `json:"window,omitempty"`      // daily bars behind DOLLAR_VOLUME, RETURN and HV, default: 20
+	RankWindow int      `json:"rank_window,omitempty"` // daily bars IV_RANK and iv_rank exits look back over, default: Config.IVRankWindow
+}
+
+// enabled reports whether a universe is configured.
+func (u UniverseSpec) enabled() bool {
+	return len(u.Symbols) > 0 || u.File != ""
+}
+
+func (u UniverseSpec) validate() error {
+	switch strings.ToLower(u.RankBy) {
+	case "", RankIV, RankIVRank, RankLiquidity, RankPrice:
+	case RankExpr:
+		if strings.TrimSpace(u.Expr) == "" {
+			return fmt.Errorf("expr ranking needs an expr")
+		}
+		if _, err := govaluate.NewEvaluableExpression(u.Expr); err != nil {
+			return fmt.Errorf("expr %q: %w", u.Expr, err)
+		}
+	default:
+		return fmt.Errorf("unknown rank_by %q", u.RankBy)
+	}
+	if u.Top < 0 || u.Window < 0 || u.RankWindow < 0 {
+		return fmt.Errorf("top, window and rank_window must not be negative")
+	}
+	return nil
+}
+
+// symbols returns the universe's underlyings, listed ones first, upper-cased
+// and without duplicates.
+func (u UniverseSpec) symbols() ([]string, error) {
+	list := append([]string{}, u.Symbols...)
+	if u.File != "" {
+		f, err := os.Open(u.File)
+		if err != nil {
+			return nil, fmt.Errorf("open universe file: %w", err)
+		}
+		defer f.Close()
+		rd := csv.NewReader(f)
+		rd.FieldsPerRecord = -1
+		rd.Comment = '#'
+		records, err := rd.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("read universe %s: %w", u.File, err)
+		}
+		col := 0
+		if len(records) > 0 {
+			for i, h := range records[0] {
+				if strings.EqualFold(strings.TrimSpace(h), "symbol") {
+					col, records = i, records[1:]
+					break
+				}
+			}
+		}
+		for _, row := range records {
+			if col < len(row) {
+				list = append(list, row[col])
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range list {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("universe has no symbols")
+	}
+	return out, nil
+}
+
+// runUniverse runs the strategy over Config.Universe: one run per symbol on
+// a shared account, stepped in one chronological stream after the scheduled
+// entries have been screened.
+func (e *Engine) runUniverse() (*Result, error) {
+	cfg := e.cfg
+	cfg.fillDefaults()
+	u := cfg.Universe
+	if err := u.validate(); err != nil {
+		return nil, fmt.Errorf("invalid universe: %w", err)
+	}
+	symbols, err := u.symbols()
+	if err != nil {
+		return nil, err
+	}
+
+	prov := data.NewBarCache(e.prov)
+	account := newPortfolio(cfg.StartingCapital)
+	var runs []*run
+	for _, sym := range symbols {
+		c := *cfg
+		c.Underlying, c.Entry.Underlying = sym, sym
+		c.Universe = UniverseSpec{}
+		if u.RankWindow > 0 {
+			c.IVRankWindow = u.RankWindow
+		}
+		r, err := NewEngine(&c, prov).prepare()
+		if err != nil {
+			logger.Infof("universe symbol %s skipped: %v", sym, err)
+			continue
+		}
+		r.pf, r.account, r.limits = newPortfolio(cfg.StartingCapital), account, account
+		runs = append(runs, r)
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no universe symbol could be prepared")
+	}
+	logger.Infof("universe of %d symbols, ranking by %s", len(runs), u.rankBy())
+
+	if err := u.screen(runs); err != nil {
+		return nil, err
+	}
+	curve := stepAll(runs, account)
+	return &Result{Trades: account.trades(), Equity: curve}, nil
+}
+
+func (u UniverseSpec) rankBy() string {
+	if u.RankBy == "" {
+		return RankIV
+	}
+	return strings.ToLower(u.RankBy)
+}
+
+// screen keeps, on every scheduled trading day, the entries of the Top
+// ranked symbols scheduled that day and drops the others. Symbols that
+// cannot be scored on a day are dropped as well.
+func (u UniverseSpec) screen(runs []*run) error {
+	top := u.Top
+	if top <= 0 {
+		top = 1
+	}
+	var expr *govaluate.EvaluableExpression
+	if u.rankBy() == RankExpr {
+		var err error
+		if expr, err = govaluate.NewEvaluableExpression(u.Expr); err != nil {
+			return fmt.Errorf("invalid universe expr: %w", err)
+		}
+	}
+
+	byDay := make(map[string][]*run)
+	for _, r := range runs {
+		for day := range r.entries {
+			byDay[day] = append(byDay[day], r)
+		}
+	}
+	days := make([]string, 0, len(byDay))
+	for day := range byDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	type ranked struct {
+		r     *run
+		score float64
+	}
+	for _, day := range days {
+		var picks []ranked
+		for _, r := range byDay[day] {
+			vars, err := u.screenVars(r, day)
+			if err == nil {
+				var score float64
+				if score, err = u.score(vars, expr); err == nil {
+					picks = append(picks, ranked{r, score})
+					continue
+				}
+			}
+			logger.Debugf("screen %s: %s not scored: %v", day, r.e.cfg.Underlying, err)
+			delete(r.entries, day)
+		}
+		// byDay lists runs in universe order, keep it among equal scores
+		sort.SliceStable(picks, func(i, j int) bool {
+			if u.Ascending {
+				return picks[i].score < picks[j].score
+			}
+			return picks[i].score > picks[j].score
+		})
+		var names []string
+		for i, p := range picks {
+			if i >= top {
+				delete(p.r.entries, day)
+				continue
+			}
+			names = append(names, fmt.Sprintf("%s=%.2f", p.r.e.cfg.Underlying, p.score))
+		}
+		logger.Infof("screen %s: %s", day, strings.Join(names, " "))
+	}
+	return nil
+}
+
+// score returns a symbol's ranking score from its screening variables.
+func (u UniverseSpec) score(vars map[string]interface{}, expr *govaluate.EvaluableExpression) (float64, error) {
+	var v interface{}
+	switch u.rankBy() {
+	case RankIV:
+		v = vars["IV"]
+	case RankIVRank:
+		v = vars["IV_RANK"]
+	case RankLiquidity:
+		v = vars["DOLLAR_VOLUME"]
+	case RankPrice:
+		v = vars["CLOSE"]
+	case RankExpr:
+		out, err := expr.Evaluate(vars)
+		if err != nil {
+			return 0, err
+		}
+		v = out
+	}
+	f, ok := v.(float64)
+	if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("score %v is not a number", v)
+	}
+	return f, nil
+}
+
+// screenVars returns the screening variables of a run's underlying on a
+// trading day.
+func (u UniverseSpec) screenVars(r *run, day string) (map[string]interface{}, error) {
+	// daily bars known at entry
+	days := r.e.knownDays(r.days, day)
+	if len(days) == 0 {
+		return nil, fmt.Errorf("no bars before %s", day)
+	}
+
+	window := u.Window
+	if window <= 0 {
+		window = 20
+	}
+	b := days[len(days)-1]
+	hist := days[max(0, len(days)-window):]
+	dollarVol := 0.0
+	for _, h := range hist {
+		dollarVol += h.Close * h.Vol
+	}
+	dollarVol /= float64(len(hist))
+	ret := 0.0
+	if first := hist[0].Close; first > 0 {
+		ret = (b.Close/first - 1) * 100.0
+	}
+	hv := AnnualizedVolatility(extractCloses(hist)) * 100.0
+
+	vars := map[string]interface{}{
+		"CLOSE":         b.Close,
+		"OPEN":          b.Open,
+		"HIGH":          b.High,
+		"LOW":           b.Low,
+		"VOLUME":        b.Vol,
+		"DOLLAR_VOLUME": dollarVol,
+		"RETURN":        ret,
+		"HV":            hv,
+	}
+	mode := u.rankBy()
+	if mode == RankIV || mode == RankIVRank || strings.Contains(u.Expr, "IV") {
+		iv := r.e.underlyingIV(b, hist)
+		vars["IV"] = iv
+		vars["IV_RANK"] = ivRank(days, window, r.e.cfg.ivRankWindow(), iv)
+	}
+	return vars, nil
+}
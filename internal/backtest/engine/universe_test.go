@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/data"
+)
+
+func TestUniverseSymbols(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "universe.csv")
+	if err := os.WriteFile(path, []byte("sector,symbol\n# comment\ntech,msft\ntech,AAPL\nenergy,XOM\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := UniverseSpec{Symbols: []string{"aapl", "NVDA"}, File: path}.symbols()
+	if err != nil {
+		t.Fatalf("symbols: %v", err)
+	}
+	if want := []string{"AAPL", "NVDA", "MSFT", "XOM"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for _, bad := range []UniverseSpec{{RankBy: "beta"}, {RankBy: RankExpr}, {RankBy: RankExpr, Expr: "CLOSE +"}, {Top: -1}} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestUniverseScreen(t *testing.T) {
+	start := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	newRun := func(sym string, close, vol float64) *run {
+		r := &run{e: &Engine{cfg: &Config{Underlying: sym}}, entries: make(map[string]time.Time)}
+		for i := 0; i < 5; i++ {
+			d := start.AddDate(0, 0, i)
+			r.days = append(r.days, data.Bar{Date: d, Open: close, High: close, Low: close, Close: close + float64(i), Vol: vol})
+		}
+		r.entries["2025-03-05"] = start.AddDate(0, 0, 2)
+		return r
+	}
+	entered := func(runs []*run) []string {
+		var out []string
+		for _, r := range runs {
+			if _, ok := r.entries["2025-03-05"]; ok {
+				out = append(out, r.e.cfg.Underlying)
+			}
+		}
+		return out
+	}
+
+	cases := []struct {
+		spec UniverseSpec
+		want []string
+	}{
+		{UniverseSpec{RankBy: RankPrice, Top: 2}, []string{"AAA", "CCC"}},
+		{UniverseSpec{RankBy: RankPrice, Ascending: true}, []string{"BBB"}},
+		{UniverseSpec{RankBy: RankLiquidity}, []string{"BBB"}},
+		{UniverseSpec{RankBy: RankExpr, Expr: "RETURN * (CLOSE < 100 ? 1 : -1)"}, []string{"BBB"}},
+	}
+	for _, c := range cases {
+		runs := []*run{newRun("AAA", 300, 1000), newRun("BBB", 20, 1e6), newRun("CCC", 150, 2000)}
+		if err := c.spec.screen(runs); err != nil {
+			t.Fatalf("%+v: screen: %v", c.spec, err)
+		}
+		if got := entered(runs); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%+v: expected entries in %v, got %v", c.spec, c.want, got)
+		}
+	}
+}
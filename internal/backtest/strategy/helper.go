@@ -20,7 +20,8 @@ import (
 // ==========================
 //
 
-// resolveDeltaStrike computes a strike corresponding to a target delta.
+// resolveDeltaStrike computes a strike corresponding to a target delta on
+// the dividend forward of the underlying.
 //
 // Parameters:
 //   - underlying: Underlying symbol
@@ -29,6 +30,7 @@ import (
 //   - asOfPrice: Spot price
 //   - targetDelta: Desired option delta
 //   - dataProv: Market data provider
+//   - products: Product registry of the run, for the dividend yield
 //
 // Returns:
 //   - float64: Estimated strike price
@@ -40,6 +42,7 @@ func resolveDeltaStrike(
 	asOfPrice float64,
 	targetDelta float64,
 	dataProv data.Provider,
+	products *data.ProductRegistry,
 ) (float64, error) {
 
 	// Fetch ATM option prices
@@ -53,16 +56,43 @@ func resolveDeltaStrike(
 		return 0, err
 	}
 
+	// Price on the dividend forward: cash dividends going ex before expiry
+	// are escrowed out of the spot and the product's yield applied on top
+	daysToExpiry := expiryDate.Sub(openDate).Hours() / (24 * 365) // same day count as the dividend times
+	spot, q := asOfPrice, products.Get(underlying).DividendYield
+	divs, err := dataProv.GetDividends(underlying, openDate, expiryDate)
+	if err != nil {
+		logger.Tracef("event=dividends_unavailable underlying=%s err=%v", underlying, err)
+	}
+	spot = pricing.EscrowedSpot(spot, 0.02, daysToExpiry, data.CashDividends(divs, openDate, expiryDate))
+
 	// Estimate implied volatility
-	daysToExpiry := expiryDate.Sub(openDate).Hours() / 24 / 365.25
-	iv, err := pricing.ImpliedVolATM(asOfPrice, strike, daysToExpiry, 0.02, callPrice, putPrice)
+	iv, err := pricing.ImpliedVolATM(spot*math.Exp(-q*daysToExpiry), strike, daysToExpiry, 0.02, callPrice, putPrice)
 	if err != nil {
 		return 0, err
 	}
 
-	logger.Tracef("event=iv_estimated iv=%.4f dte=%.3f", iv, daysToExpiry)
+	logger.Tracef("event=iv_estimated iv=%.4f dte=%.3f spot=%.2f q=%.4f", iv, daysToExpiry, spot, q)
+
+	return pricing.StrikeFromDelta(spot, targetDelta, 0.02, q, iv, daysToExpiry, true), nil
+}
+
+// roundStrike rounds a target strike with the provider, unless the run's
+// products (a products file or populated product) give the underlying a
+// strike spacing other than the defaults the providers round on.
+func roundStrike(
+	underlying string,
+	expiryDate time.Time,
+	openDate time.Time,
+	target float64,
+	prov data.Provider,
+	products *data.ProductRegistry,
+) float64 {
 
-	return pricing.StrikeFromDelta(asOfPrice, targetDelta, 0.02, 0.0, iv, daysToExpiry, true), nil
+	if iv := products.StrikeInterval(underlying, target); iv > 0 && iv != data.Products.StrikeInterval(underlying, target) {
+		return math.Round(target/iv) * iv
+	}
+	return prov.RoundToNearestStrike(underlying, expiryDate, openDate, target)
 }
 
 // resolveATMOffset applies an absolute or percentage offset to a price.
@@ -103,7 +133,7 @@ func resolveATMOffset(offset string, asOfPrice float64) (float64, error) {
 //   - error: If expression is invalid or cannot be evaluated
 func evaluateLegExpression(expr string, legs []TradeLeg) (float64, error) {
 
-	re := regexp.MustCompile(`\{LEG(\d)\.(STRIKE|PREMIUM)\}`)
+	re := regexp.MustCompile(`\{LEG(\d)\.(STRIKE|PREMIUM|PRICE)\}`)
 	matches := re.FindAllStringSubmatch(expr, -1)
 	if matches == nil {
 		return 0, ErrInvalidStrikeExpression
@@ -123,7 +153,7 @@ func evaluateLegExpression(expr string, legs []TradeLeg) (float64, error) {
 		if match[2] == "STRIKE" {
 			value = legs[idx].Strike
 		} else {
-			// "PREMIUM"
+			// "PREMIUM" or "PRICE": option premium or stock entry price
 			value = legs[idx].OpenPremium
 		}
 
@@ -43,29 +43,44 @@ var (
 // ==========================
 //
 
-// TradeLeg represents a fully resolved option leg.
+// TradeLeg represents a fully resolved option or stock leg.
 //
 // It is the output of strategy planning and contains concrete market
 // values derived from a LegSpec.
 type TradeLeg struct {
 	Spec         LegSpec   // Original leg specification
-	Strike       float64   // Resolved option strike
-	Expiration   time.Time // Resolved option expiration date
-	OpenPremium  float64   // Premium at trade open
-	ClosePremium float64   // Premium at trade close (filled later)
+	Strike       float64   // Resolved option strike, 0 for stock legs
+	Expiration   time.Time // Resolved option expiration date, zero for stock legs
+	OpenPremium  float64   // Premium (share price for stock legs) at trade open
+	ClosePremium float64   // Premium (share price for stock legs) at trade close (filled later)
+	Multiplier   float64   // Underlying units per option contract, 0 = 100
+	Hedge        bool      // Stock held by the engine's delta hedge rather than the strategy
 }
 
-// LegSpec defines a single option leg as provided by the user or strategy JSON.
+// Leg types accepted in LegSpec.OptionType besides "call" and "put".
+const (
+	LegStock      = "stock"      // shares of the underlying
+	LegUnderlying = "underlying" // alias of LegStock
+)
+
+// LegSpec defines a single option or stock leg as provided by the user or strategy JSON.
 //
-// This struct represents *intent*, not resolved market values.
+// This struct represents *intent*, not resolved market values. Stock legs
+// take no strike rule or expiration; their Qty is a number of shares.
 type LegSpec struct {
 	Side       string `json:"side,omitempty"`        // buy or sell (default: buy)
-	OptionType string `json:"option_type,omitempty"` // call or put (default: call)
+	OptionType string `json:"option_type,omitempty"` // call, put or stock (default: call)
 	StrikeRule string `json:"strike_rule"`           // ATM, ATM:+10, DELTA:0.3, {LEG1.STRIKE}, etc.
-	Qty        int    `json:"qty,omitempty"`         // Quantity for ratio spreads
+	Qty        int    `json:"qty,omitempty"`         // Quantity for ratio spreads, shares for stock legs
 	Expiration int    `json:"expiration,omitempty"`  // DTE override for this leg
 }
 
+// IsStock reports whether the leg holds shares of the underlying rather than options.
+func (l LegSpec) IsStock() bool {
+	t := strings.ToLower(l.OptionType)
+	return t == LegStock || t == LegUnderlying
+}
+
 // StrategySpec defines a multi-leg option strategy.
 //
 // Shared defaults apply unless overridden at the leg level.
@@ -93,6 +108,7 @@ type StrategySpec struct {
 //   - openPrice: Spot price of the underlying at open
 //   - expiryList: Available option expiration dates
 //   - prov: Market data provider
+//   - products: Product registry of the run
 //
 // Returns:
 //   - []TradeLeg: Fully resolved trade legs in order
@@ -104,6 +120,7 @@ func PlanStrategy(
 	openPrice float64,
 	expiryList []time.Time,
 	prov data.Provider,
+	products *data.ProductRegistry,
 ) ([]TradeLeg, error) {
 
 	logger.Infof(
@@ -118,6 +135,20 @@ func PlanStrategy(
 	for i, legSpec := range strategy.Legs {
 		logger.Debugf("event=resolve_leg index=%d spec=%+v", i+1, legSpec)
 
+		// Stock legs trade at the underlying price and never expire
+		if legSpec.IsStock() {
+			logger.Infof(
+				"event=leg_resolved leg=%d side=%s type=%s shares=%d price=%.2f",
+				i+1,
+				legSpec.Side,
+				legSpec.OptionType,
+				legSpec.Qty,
+				openPrice,
+			)
+			legs = append(legs, TradeLeg{Spec: legSpec, OpenPremium: openPrice})
+			continue
+		}
+
 		// Determine expiration offset
 		offset := strategy.DaysToExpiry
 		if legSpec.Expiration != 0 {
@@ -136,6 +167,7 @@ func PlanStrategy(
 			expiryDate,
 			legs,
 			prov,
+			products,
 		)
 		if err != nil {
 			logger.Errorf("event=strike_resolution_failed leg=%d err=%v", i+1, err)
@@ -215,6 +247,7 @@ func ResolveExpiration(
 //   - ATM:+10, ATM:-5%
 //   - DELTA:0.3
 //   - {LEG1.STRIKE}+{LEG1.PREMIUM}
+//   - {LEG1.PRICE}+5 (PRICE is the leg's open price, e.g. the stock leg entry)
 //
 // Parameters:
 //   - strikeExpr: Strike expression
@@ -224,6 +257,7 @@ func ResolveExpiration(
 //   - expiryDate: Option expiration date
 //   - legs: Previously resolved legs
 //   - prov: Market data provider
+//   - products: Product registry of the run
 //
 // Returns:
 //   - float64: Resolved strike price
@@ -236,13 +270,14 @@ func ResolveStrike(
 	expiryDate time.Time,
 	legs []TradeLeg,
 	prov data.Provider,
+	products *data.ProductRegistry,
 ) (float64, error) {
 
 	strikeExpr = strings.TrimSpace(strings.ToUpper(strikeExpr))
 	logger.Debugf("event=resolve_strike expr=%s", strikeExpr)
 
 	if strikeExpr == "ATM" {
-		return prov.RoundToNearestStrike(underlying, expiryDate, openDate, asOfPrice), nil
+		return roundStrike(underlying, expiryDate, openDate, asOfPrice, prov, products), nil
 	}
 
 	if strings.HasPrefix(strikeExpr, "ATM:") {
@@ -250,7 +285,7 @@ func ResolveStrike(
 		if err != nil {
 			return 0, err
 		}
-		return prov.RoundToNearestStrike(underlying, expiryDate, openDate, target), nil
+		return roundStrike(underlying, expiryDate, openDate, target, prov, products), nil
 	}
 
 	if strings.HasPrefix(strikeExpr, "DELTA:") {
@@ -268,13 +303,14 @@ func ResolveStrike(
 			asOfPrice,
 			targetDelta,
 			prov,
+			products,
 		)
 		if err != nil {
 			logger.Errorf("resolve strike failed for DELTA expression:%s, %v", deltaStr, err)
 			return 0, err
 		}
 
-		return prov.RoundToNearestStrike(underlying, expiryDate, openDate, target), nil
+		return roundStrike(underlying, expiryDate, openDate, target, prov, products), nil
 	}
 
 	// Expression using previous legs
@@ -283,7 +319,7 @@ func ResolveStrike(
 		if err != nil {
 			return 0, err
 		}
-		return prov.RoundToNearestStrike(underlying, expiryDate, openDate, target), nil
+		return roundStrike(underlying, expiryDate, openDate, target, prov, products), nil
 	}
 
 	return 0, fmt.Errorf("%w: %s", ErrInvalidStrikeExpression, strikeExpr)
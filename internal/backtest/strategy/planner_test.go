@@ -44,6 +44,7 @@ func TestEvalLegExp(t *testing.T) {
 	legs := []TradeLeg{
 		{Strike: 580.0, OpenPremium: 2.5},
 		{Strike: 590.0, OpenPremium: 3.0},
+		{Spec: LegSpec{OptionType: LegStock, Qty: 100}, OpenPremium: 580.0},
 	}
 	tests := []struct {
 		expr     string
@@ -54,6 +55,7 @@ func TestEvalLegExp(t *testing.T) {
 		{"{LEG1.PREMIUM}+{LEG2.PREMIUM}", 5.5},
 		{"({LEG1.PREMIUM}+{LEG2.PREMIUM})/2.0", 2.75},
 		{"{LEG1.STRIKE}+({LEG1.PREMIUM}+{LEG2.PREMIUM})/2", 582.75},
+		{"{LEG3.PRICE}*1.05", 609.0},
 	}
 
 	for _, test := range tests {
@@ -92,7 +94,7 @@ func TestResolveStrike(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		actual, err := ResolveStrike(test.expr, underlying, asOfPrice, openDate, expiryDate, legs, provMassive)
+		actual, err := ResolveStrike(test.expr, underlying, asOfPrice, openDate, expiryDate, legs, provMassive, data.Products)
 		if err != nil {
 			t.Fatalf("Failed to resolve strike for expression {%s}: %v", test.expr, err)
 		}
@@ -110,7 +112,7 @@ func TestPlanStrategyStrangle(t *testing.T) {
 		},
 		DateMatchType: data.MatchNearest,
 	}
-	legs, err := PlanStrategy(strategy, openDate, underlying, asOfPrice, []time.Time{expiryDate}, provMassive)
+	legs, err := PlanStrategy(strategy, openDate, underlying, asOfPrice, []time.Time{expiryDate}, provMassive, data.Products)
 	if err != nil {
 		t.Fatalf("Failed to plan strategy: %v", err)
 	}
@@ -135,7 +137,7 @@ func TestPlanStrategyCustom(t *testing.T) {
 		},
 		DateMatchType: data.MatchHigher,
 	}
-	legs, err := PlanStrategy(strategy, openDate, underlying, asOfPrice, expiryList, provMassive)
+	legs, err := PlanStrategy(strategy, openDate, underlying, asOfPrice, expiryList, provMassive, data.Products)
 	if err != nil {
 		t.Fatalf("Failed to plan strategy: %v", err)
 	}
@@ -162,7 +164,7 @@ func TestPlanStrategyCustom3(t *testing.T) {
 		},
 		DateMatchType: data.MatchHigher,
 	}
-	legs, err := PlanStrategy(strategy, openDate, underlying, asOfPrice, expiryList, provMassive)
+	legs, err := PlanStrategy(strategy, openDate, underlying, asOfPrice, expiryList, provMassive, data.Products)
 	if err != nil {
 		t.Fatalf("Failed to plan strategy: %v", err)
 	}
@@ -172,3 +174,15 @@ func TestPlanStrategyCustom3(t *testing.T) {
 
 	tests.CompareWithGolden(t, "strategy_custom3", legs)
 }
+
+func TestRoundStrikeRunProducts(t *testing.T) {
+	synth := data.NewSyntheticProvider()
+	if k, _ := ResolveStrike("ATM", "SPY", 503.2, openDate, expiryDate, nil, synth, data.Products); k != 503 {
+		t.Fatalf("expected the default $1 SPY strikes, got %.2f", k)
+	}
+	run := data.Products.Clone()
+	run.Register(data.Product{Symbol: "SPY", StrikeBands: []data.StrikeBand{{Interval: 5}}})
+	if k, _ := ResolveStrike("ATM", "SPY", 503.2, openDate, expiryDate, nil, synth, run); k != 505 {
+		t.Fatalf("expected the run's $5 SPY strikes, got %.2f", k)
+	}
+}
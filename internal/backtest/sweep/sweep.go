@@ -0,0 +1,374 @@
+// Package sweep runs a base engine config over a grid of parameter values
+// and ranks the combinations by a summary metric.
+//
+// A sweep spec names the base config and the swept fields by their JSON
+// path:
+//
+//	{
+//	  "base": "spy_puts.json",
+//	  "params": [
+//	    {"path": "strategy.dte", "from": 20, "to": 60, "step": 5},
+//	    {"path": "strategy.strategy.0.strike_rule", "from": 0.10, "to": 0.30, "step": 0.05, "format": "DELTA:%.2f"},
+//	    {"path": "exit.profit_target_pct", "values": [25, 50, 75]}
+//	  ],
+//	  "rank_by": "sharpe"
+//	}
+//
+// Every combination runs concurrently against one bar cache, so each price
+// series is fetched once for the whole grid.
+package sweep
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/backtest/engine"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+// Summary metrics a sweep can rank by.
+const (
+	RankSharpe       = "sharpe"
+	RankNetPnL       = "net_pnl"
+	RankReturn       = "return_pct"
+	RankCAGR         = "cagr"
+	RankWinRate      = "win_rate"
+	RankProfitFactor = "profit_factor"
+	RankDrawdown     = "max_drawdown_pct"
+)
+
+// Param is one swept config field. Values are either listed or generated
+// from From to To (inclusive) in Step increments.
+type Param struct {
+	Path   string        `json:"path"`             // dotted JSON path into the base config, list items by index, e.g. "strategy.strategy.0.strike_rule"
+	Values []interface{} `json:"values,omitempty"` // explicit values, e.g. [25, 50, 75]
+	From   float64       `json:"from,omitempty"`   // first value of a range
+	To     float64       `json:"to,omitempty"`     // last value of a range
+	Step   float64       `json:"step,omitempty"`   // range increment, > 0
+	Format string        `json:"format,omitempty"` // fmt format turning numbers into strings, e.g. "DELTA:%.2f"
+}
+
+// Spec is a parameter sweep.
+type Spec struct {
+	Base      json.RawMessage `json:"base"`                 // base engine config: an inline object or a path relative to the spec file
+	Params    []Param         `json:"params"`               // swept fields
+	Workers   int             `json:"workers,omitempty"`    // concurrent runs, default: number of CPUs
+	RankBy    string          `json:"rank_by,omitempty"`    // summary metric to rank by, default: "sharpe"
+	Ascending bool            `json:"ascending,omitempty"`  // rank lowest first, default: highest first (lowest for max_drawdown_pct)
+	ReportDir string          `json:"report_dir,omitempty"` // report directory, default: "./out/sweep"
+}
+
+// Row is the outcome of one combination.
+type Row struct {
+	Rank    int            `json:"rank"`            // 1 = best, failed runs rank last
+	Values  []interface{}  `json:"values"`          // parameter values, in Spec.Params order
+	Summary engine.Summary `json:"summary"`         // summary metrics of the run
+	Error   string         `json:"error,omitempty"` // why the run failed, if it did
+	Config  *engine.Config `json:"-"`               // config the combination ran
+	Result  *engine.Result `json:"-"`               // result of the run, nil if it failed
+}
+
+// Result is a ranked sweep.
+type Result struct {
+	Params []string `json:"params"` // parameter paths, in Spec.Params order
+	RankBy string   `json:"rank_by"`
+	Rows   []Row    `json:"rows"` // combinations, best first
+}
+
+// Load reads a sweep spec from a JSON file and resolves a base config given
+// as a path.
+func Load(path string) (*Spec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read sweep spec: %w", err)
+	}
+	var s Spec
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("decode sweep spec %s: %w", path, err)
+	}
+	if err := s.resolveBase(path); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// resolveBase replaces a base config given as a path, relative to the spec
+// file at specPath, with the file's content.
+func (s *Spec) resolveBase(specPath string) error {
+	var basePath string
+	if err := json.Unmarshal(s.Base, &basePath); err != nil {
+		return nil // inline config
+	}
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(specPath), basePath)
+	}
+	b, err := os.ReadFile(basePath)
+	if err != nil {
+		return fmt.Errorf("read base config: %w", err)
+	}
+	s.Base = b
+	return nil
+}
+
+func (s *Spec) validate() error {
+	if len(s.Base) == 0 {
+		return fmt.Errorf("sweep has no base config")
+	}
+	if len(s.Params) == 0 {
+		return fmt.Errorf("sweep has no params")
+	}
+	for _, p := range s.Params {
+		if p.Path == "" {
+			return fmt.Errorf("param without path")
+		}
+		if len(p.Values) == 0 && (p.Step <= 0 || p.To < p.From) {
+			return fmt.Errorf("param %s: needs values or a range with from <= to and step > 0", p.Path)
+		}
+	}
+	switch s.rankBy() {
+	case RankSharpe, RankNetPnL, RankReturn, RankCAGR, RankWinRate, RankProfitFactor, RankDrawdown:
+	default:
+		return fmt.Errorf("unknown rank_by %q", s.RankBy)
+	}
+	return nil
+}
+
+func (s *Spec) rankBy() string {
+	if s.RankBy == "" {
+		return RankSharpe
+	}
+	return strings.ToLower(s.RankBy)
+}
+
+// values returns the values a param takes, formatted.
+func (p Param) values() []interface{} {
+	vals := p.Values
+	if len(vals) == 0 {
+		n := int(math.Floor((p.To-p.From)/p.Step + 1e-9))
+		for i := 0; i <= n; i++ {
+			// round off float drift so that integer fields stay integers
+			v := math.Round((p.From+float64(i)*p.Step)*1e9) / 1e9
+			vals = append(vals, v)
+		}
+	}
+	if p.Format == "" {
+		return vals
+	}
+	out := make([]interface{}, len(vals))
+	for i, v := range vals {
+		out[i] = v
+		if f, ok := v.(float64); ok {
+			out[i] = fmt.Sprintf(p.Format, f)
+		}
+	}
+	return out
+}
+
+// Combinations returns every combination of param values, the last param
+// varying fastest.
+func (s *Spec) Combinations() [][]interface{} {
+	combos := [][]interface{}{{}}
+	for _, p := range s.Params {
+		var next [][]interface{}
+		for _, c := range combos {
+			for _, v := range p.values() {
+				combo := append(append([]interface{}{}, c...), v)
+				next = append(next, combo)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// Apply returns the engine config of base with the params set to values.
+func Apply(base []byte, params []Param, values []interface{}) (*engine.Config, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(base, &doc); err != nil {
+		return nil, fmt.Errorf("decode base config: %w", err)
+	}
+	for i, p := range params {
+		if err := setPath(doc, strings.Split(p.Path, "."), values[i]); err != nil {
+			return nil, fmt.Errorf("param %s: %w", p.Path, err)
+		}
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var cfg engine.Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// setPath sets a value in a decoded JSON document. Missing object keys are
+// created; list indexes must exist.
+func setPath(node interface{}, path []string, v interface{}) error {
+	key := path[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			n[key] = v
+			return nil
+		}
+		child, ok := n[key]
+		if !ok || child == nil {
+			child = map[string]interface{}{}
+			n[key] = child
+		}
+		return setPath(child, path[1:], v)
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(n) {
+			return fmt.Errorf("no list item %q", key)
+		}
+		if len(path) == 1 {
+			n[i] = v
+			return nil
+		}
+		return setPath(n[i], path[1:], v)
+	}
+	return fmt.Errorf("%q is not an object or list", key)
+}
+
+// Run runs every combination of the sweep on a shared bar cache and ranks
+// them. Runs that fail are kept with their error and ranked last.
+func Run(s *Spec, prov data.Provider) (*Result, error) {
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid sweep: %w", err)
+	}
+	if s.ReportDir == "" {
+		s.ReportDir = "./out/sweep"
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	base, err := seeded(s.Base)
+	if err != nil {
+		return nil, err
+	}
+	combos := s.Combinations()
+	logger.Infof("sweep of %d combinations on %d workers", len(combos), workers)
+	rows := runGrid(base, s.Params, combos, data.NewBarCache(prov), workers, nil)
+
+	rank(rows, s.rankBy(), s.Ascending)
+	res := &Result{RankBy: s.rankBy(), Rows: rows}
+	for _, p := range s.Params {
+		res.Params = append(res.Params, p.Path)
+	}
+	return res, nil
+}
+
+// seeded returns the base config with a seed set, so that every combination
+// runs on the same one and they stay comparable.
+func seeded(base []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(base, &doc); err != nil {
+		return nil, fmt.Errorf("decode base config: %w", err)
+	}
+	if seed, _ := doc["seed"].(float64); seed != 0 {
+		return base, nil
+	}
+	doc["seed"] = time.Now().UnixNano()
+	return json.Marshal(doc)
+}
+
+// runGrid runs combinations on a number of workers and returns their rows
+// in combination order. adjust, if set, edits each config before it runs.
+func runGrid(base []byte, params []Param, combos [][]interface{}, prov data.Provider, workers int, adjust func(*engine.Config)) []Row {
+	rows := make([]Row, len(combos))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				rows[i] = runOne(base, params, combos[i], prov, adjust)
+			}
+		}()
+	}
+	for i := range combos {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return rows
+}
+
+// runOne runs one combination.
+func runOne(base []byte, params []Param, values []interface{}, prov data.Provider, adjust func(*engine.Config)) Row {
+	row := Row{Values: values}
+	cfg, err := Apply(base, params, values)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	if adjust != nil {
+		adjust(cfg)
+	}
+	row.Config = cfg
+	res, err := engine.NewEngine(cfg, prov).Run()
+	if err != nil {
+		row.Error = err.Error()
+		logger.Infof("sweep %v failed: %v", values, err)
+		return row
+	}
+	row.Result = res
+	row.Summary = engine.Summarize(res, cfg.StartingCapital)
+	return row
+}
+
+// Metric returns a summary metric by rank_by name.
+func Metric(s engine.Summary, name string) float64 {
+	switch name {
+	case RankNetPnL:
+		return s.NetPnL
+	case RankReturn:
+		return s.ReturnPct
+	case RankCAGR:
+		return s.CAGR
+	case RankWinRate:
+		return s.WinRate
+	case RankProfitFactor:
+		return s.ProfitFactor
+	case RankDrawdown:
+		return s.MaxDrawdownPct
+	}
+	return s.Sharpe
+}
+
+// rank sorts rows best first by a metric and numbers them. Drawdown ranks
+// lowest first unless ascending flips it; failed runs go last.
+func rank(rows []Row, by string, ascending bool) {
+	if by == RankDrawdown {
+		ascending = !ascending
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if (rows[i].Error == "") != (rows[j].Error == "") {
+			return rows[i].Error == ""
+		}
+		a, b := Metric(rows[i].Summary, by), Metric(rows[j].Summary, by)
+		if ascending {
+			return a < b
+		}
+		return a > b
+	})
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+}
@@ -0,0 +1,67 @@
+package sweep
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/contactkeval/option-replay/internal/backtest/engine"
+)
+
+func TestCombinationsAndApply(t *testing.T) {
+	s := &Spec{
+		Base: []byte(`{"underlying": "SPY", "strategy": {"dte": 30, "strategy": [{"side": "sell", "option_type": "put", "strike_rule": "ATM"}]}}`),
+		Params: []Param{
+			{Path: "strategy.dte", From: 20, To: 30, Step: 5},
+			{Path: "strategy.strategy.0.strike_rule", From: 0.1, To: 0.3, Step: 0.1, Format: "DELTA:%.2f"},
+			{Path: "exit.profit_target_pct", Values: []interface{}{25.0, 50.0}},
+		},
+	}
+	if err := s.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	combos := s.Combinations()
+	if len(combos) != 3*3*2 {
+		t.Fatalf("expected 18 combinations, got %d", len(combos))
+	}
+	if want := []interface{}{20.0, "DELTA:0.30", 50.0}; !reflect.DeepEqual(combos[5], want) {
+		t.Fatalf("expected combination %v, got %v", want, combos[5])
+	}
+
+	cfg, err := Apply(s.Base, s.Params, combos[len(combos)-1])
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if cfg.Strategy.DaysToExpiry != 30 || cfg.Strategy.Legs[0].StrikeRule != "DELTA:0.30" || cfg.Strategy.Legs[0].Side != "sell" ||
+		cfg.Exit.ProfitTargetPct == nil || *cfg.Exit.ProfitTargetPct != 50 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	if _, err := Apply(s.Base, []Param{{Path: "strategy.strategy.3.qty"}}, []interface{}{2.0}); err == nil {
+		t.Fatalf("expected error for a missing list item")
+	}
+	for _, bad := range []*Spec{
+		{Base: s.Base},
+		{Base: s.Base, Params: []Param{{Path: "strategy.dte", From: 30, To: 20, Step: 5}}},
+		{Base: s.Base, Params: s.Params, RankBy: "alpha"},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	rows := []Row{
+		{Values: []interface{}{1.0}, Summary: engine.Summary{Sharpe: 0.5, MaxDrawdownPct: 10}},
+		{Values: []interface{}{2.0}, Error: "no dates scheduled"},
+		{Values: []interface{}{3.0}, Summary: engine.Summary{Sharpe: 1.2, MaxDrawdownPct: 20}},
+	}
+	rank(rows, RankSharpe, false)
+	if rows[0].Values[0] != 3.0 || rows[2].Error == "" || rows[2].Rank != 3 {
+		t.Fatalf("unexpected sharpe ranking %+v", rows)
+	}
+	rank(rows, RankDrawdown, false)
+	if rows[0].Values[0] != 1.0 {
+		t.Fatalf("expected lowest drawdown first, got %+v", rows)
+	}
+}
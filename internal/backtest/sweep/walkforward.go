@@ -0,0 +1,286 @@
+package sweep
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/backtest/engine"
+	"github.com/contactkeval/option-replay/internal/data"
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+// WalkForwardSpec is a walk-forward optimisation: the base config's
+// Entry.StartDate..EndDate is split into rolling in-sample windows, each
+// followed by an out-of-sample window. The parameter grid is searched in
+// sample, ranked by RankBy (the objective), and the best combination is run
+// out of sample. Example, one year in sample and a quarter out:
+//
+//	{"base": "spy_puts.json", "params": [...], "rank_by": "sharpe",
+//	 "in_sample_days": 365, "out_of_sample_days": 91}
+type WalkForwardSpec struct {
+	Spec
+	InSampleDays    int  `json:"in_sample_days"`      // calendar days of each in-sample window
+	OutOfSampleDays int  `json:"out_of_sample_days"`  // calendar days of each out-of-sample window
+	StepDays        int  `json:"step_days,omitempty"` // days between window starts, at least OutOfSampleDays, default: OutOfSampleDays
+	Anchored        bool `json:"anchored,omitempty"`  // in-sample windows all start at Entry.StartDate and grow
+}
+
+// Window is one in-sample/out-of-sample split of a walk-forward run.
+type Window struct {
+	InStart   time.Time      `json:"in_start"`
+	InEnd     time.Time      `json:"in_end"`
+	OutStart  time.Time      `json:"out_start"`
+	OutEnd    time.Time      `json:"out_end"`
+	Values    []interface{}  `json:"values"`          // best in-sample parameters, in Spec.Params order
+	InSample  engine.Summary `json:"in_sample"`       // summary of the best in-sample run
+	OutSample engine.Summary `json:"out_of_sample"`   // summary of the out-of-sample run
+	Error     string         `json:"error,omitempty"` // why the window has no out-of-sample run
+}
+
+// Stability describes how a parameter's chosen value moved across windows.
+type Stability struct {
+	Param     string      `json:"param"`
+	Distinct  int         `json:"distinct"`   // distinct values chosen
+	Mode      interface{} `json:"mode"`       // value chosen most often
+	ModeShare float64     `json:"mode_share"` // percent of windows choosing Mode
+	Mean      float64     `json:"mean"`       // mean of numeric values chosen, 0 if not numeric
+	StdDev    float64     `json:"std_dev"`    // standard deviation of numeric values chosen
+}
+
+// WalkForwardResult is the stitched out-of-sample outcome of a walk-forward
+// run.
+type WalkForwardResult struct {
+	Params     []string             `json:"params"`     // parameter paths, in Spec.Params order
+	Objective  string               `json:"objective"`  // in-sample ranking metric
+	Windows    []Window             `json:"windows"`    // windows in date order
+	Trades     []engine.Trade       `json:"trades"`     // out-of-sample trades, renumbered in date order
+	Equity     []engine.EquityPoint `json:"equity"`     // stitched out-of-sample equity curve
+	Summary    engine.Summary       `json:"summary"`    // metrics of the stitched out-of-sample run
+	Stability  []Stability          `json:"stability"`  // per-parameter stability of the chosen values
+	Efficiency float64              `json:"efficiency"` // annualized out-of-sample return as a percent of in-sample, over windows with an in-sample gain
+}
+
+// LoadWalkForward reads a walk-forward spec from a JSON file and resolves a
+// base config given as a path.
+func LoadWalkForward(path string) (*WalkForwardSpec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read walk-forward spec: %w", err)
+	}
+	var s WalkForwardSpec
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("decode walk-forward spec %s: %w", path, err)
+	}
+	if err := s.resolveBase(path); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// windows splits start..end into in-sample/out-of-sample windows. The last
+// out-of-sample window is cut at end.
+func (s *WalkForwardSpec) windows(start, end time.Time) ([]Window, error) {
+	if s.InSampleDays <= 0 || s.OutOfSampleDays <= 0 {
+		return nil, fmt.Errorf("in_sample_days and out_of_sample_days must be positive")
+	}
+	step := s.StepDays
+	if step <= 0 {
+		step = s.OutOfSampleDays
+	}
+	// overlapping out-of-sample windows would trade the same days twice in
+	// the stitched curve
+	if step < s.OutOfSampleDays {
+		return nil, fmt.Errorf("step_days %d is shorter than out_of_sample_days %d", step, s.OutOfSampleDays)
+	}
+	var out []Window
+	for k := 0; ; k++ {
+		inStart := start.AddDate(0, 0, k*step)
+		outStart := inStart.AddDate(0, 0, s.InSampleDays)
+		if !outStart.Before(end) {
+			break
+		}
+		if s.Anchored {
+			inStart = start
+		}
+		outEnd := outStart.AddDate(0, 0, s.OutOfSampleDays-1)
+		if outEnd.After(end) {
+			outEnd = end
+		}
+		out = append(out, Window{
+			InStart:  inStart,
+			InEnd:    outStart.AddDate(0, 0, -1),
+			OutStart: outStart,
+			OutEnd:   outEnd,
+		})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s..%s is shorter than one in-sample window of %d days",
+			start.Format("2006-01-02"), end.Format("2006-01-02"), s.InSampleDays)
+	}
+	return out, nil
+}
+
+// RunWalkForward runs a walk-forward optimisation. Windows run in date
+// order; each out-of-sample run starts from the equity the previous one
+// ended with, and positions still open at a window's end are closed there.
+func RunWalkForward(s *WalkForwardSpec, prov data.Provider) (*WalkForwardResult, error) {
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid walk-forward: %w", err)
+	}
+	if s.ReportDir == "" {
+		s.ReportDir = "./out/walkforward"
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	base, err := seeded(s.Base)
+	if err != nil {
+		return nil, err
+	}
+	var cfg engine.Config
+	if err := json.Unmarshal(base, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid base config: %w", err)
+	}
+	windows, err := s.windows(cfg.Entry.StartDate, cfg.Entry.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	capital := cfg.StartingCapital
+	if capital <= 0 {
+		capital = 100000
+	}
+
+	combos := s.Combinations()
+	logger.Infof("walk-forward over %d windows of %d combinations on %d workers", len(windows), len(combos), workers)
+	cache := data.NewBarCache(prov)
+	res := &WalkForwardResult{Objective: s.rankBy()}
+	for _, p := range s.Params {
+		res.Params = append(res.Params, p.Path)
+	}
+
+	equity := capital
+	for i := range windows {
+		w := &windows[i]
+		rows := runGrid(base, s.Params, combos, cache, workers, func(c *engine.Config) {
+			c.Entry.StartDate, c.Entry.EndDate = w.InStart, w.InEnd
+			c.StartingCapital = capital
+		})
+		rank(rows, s.rankBy(), s.Ascending)
+		if rows[0].Error != "" {
+			w.Error = "in sample: " + rows[0].Error
+			logger.Infof("walk-forward window %d: %s", i+1, w.Error)
+			continue
+		}
+		w.Values, w.InSample = rows[0].Values, rows[0].Summary
+
+		out := runOne(base, s.Params, w.Values, cache, func(c *engine.Config) {
+			c.Entry.StartDate, c.Entry.EndDate = w.OutStart, w.OutEnd
+			c.StartingCapital = equity
+		})
+		if out.Error != "" {
+			w.Error = "out of sample: " + out.Error
+			logger.Infof("walk-forward window %d: %s", i+1, w.Error)
+			continue
+		}
+		w.OutSample = out.Summary
+		for _, tr := range out.Result.Trades {
+			tr.ID = len(res.Trades) + 1
+			res.Trades = append(res.Trades, tr)
+		}
+		res.Equity = append(res.Equity, out.Result.Equity...)
+		if n := len(res.Equity); n > 0 {
+			equity = res.Equity[n-1].Equity
+		}
+		logger.Infof("walk-forward window %d: %v %s in=%.3f out=%.3f",
+			i+1, w.Values, res.Objective, Metric(w.InSample, res.Objective), Metric(w.OutSample, res.Objective))
+	}
+
+	res.Windows = windows
+	res.Summary = engine.Summarize(&engine.Result{Trades: res.Trades, Equity: res.Equity}, capital)
+	res.Stability = stability(res.Params, windows)
+	res.Efficiency = efficiency(windows)
+	return res, nil
+}
+
+// stability summarizes the values chosen for each parameter over the
+// windows that found one.
+func stability(params []string, windows []Window) []Stability {
+	out := make([]Stability, len(params))
+	for i, p := range params {
+		st := Stability{Param: p}
+		counts := make(map[string]int)
+		first := make(map[string]interface{})
+		var nums []float64
+		n := 0
+		for _, w := range windows {
+			if w.Values == nil {
+				continue
+			}
+			n++
+			v := w.Values[i]
+			k := fmt.Sprint(v)
+			if _, ok := first[k]; !ok {
+				first[k] = v
+			}
+			counts[k]++
+			if f, ok := v.(float64); ok {
+				nums = append(nums, f)
+			}
+		}
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		st.Distinct = len(keys)
+		best := 0
+		for _, k := range keys {
+			if counts[k] > best {
+				best, st.Mode = counts[k], first[k]
+			}
+		}
+		if n > 0 {
+			st.ModeShare = float64(best) / float64(n) * 100.0
+		}
+		if len(nums) == n && n > 0 {
+			for _, f := range nums {
+				st.Mean += f
+			}
+			st.Mean /= float64(n)
+			for _, f := range nums {
+				st.StdDev += (f - st.Mean) * (f - st.Mean)
+			}
+			st.StdDev = math.Sqrt(st.StdDev / float64(n))
+		}
+		out[i] = st
+	}
+	return out
+}
+
+// efficiency returns the walk-forward efficiency: the mean annualized
+// out-of-sample return as a percent of the mean annualized in-sample return,
+// over windows with an in-sample gain. 0 if there are none.
+func efficiency(windows []Window) float64 {
+	var in, out float64
+	n := 0
+	for _, w := range windows {
+		if w.Error != "" || w.InSample.ReturnPct <= 0 {
+			continue
+		}
+		inDays := w.InEnd.Sub(w.InStart).Hours()/24 + 1
+		outDays := w.OutEnd.Sub(w.OutStart).Hours()/24 + 1
+		in += w.InSample.ReturnPct * 365 / inDays
+		out += w.OutSample.ReturnPct * 365 / outDays
+		n++
+	}
+	if n == 0 || in <= 0 {
+		return 0
+	}
+	return out / in * 100.0
+}
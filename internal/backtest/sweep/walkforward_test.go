@@ -0,0 +1,64 @@
+package sweep
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/backtest/engine"
+)
+
+func TestWalkForwardWindows(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)
+	s := &WalkForwardSpec{InSampleDays: 180, OutOfSampleDays: 90}
+	ws, err := s.windows(start, end)
+	if err != nil {
+		t.Fatalf("windows: %v", err)
+	}
+	if len(ws) != 3 {
+		t.Fatalf("expected 3 windows, got %d", len(ws))
+	}
+	if !ws[0].OutStart.Equal(start.AddDate(0, 0, 180)) || !ws[0].InEnd.Equal(ws[0].OutStart.AddDate(0, 0, -1)) {
+		t.Fatalf("unexpected first window %+v", ws[0])
+	}
+	if !ws[1].InStart.Equal(start.AddDate(0, 0, 90)) || !ws[2].OutEnd.Equal(end) {
+		t.Fatalf("expected rolling windows cut at the end, got %+v", ws)
+	}
+
+	s.Anchored = true
+	ws, _ = s.windows(start, end)
+	if !ws[2].InStart.Equal(start) || !ws[2].OutStart.Equal(start.AddDate(0, 0, 360)) {
+		t.Fatalf("expected anchored in-sample windows, got %+v", ws[2])
+	}
+
+	if _, err := (&WalkForwardSpec{InSampleDays: 400, OutOfSampleDays: 30}).windows(start, end); err == nil {
+		t.Fatalf("expected error for a period shorter than the in-sample window")
+	}
+	if _, err := (&WalkForwardSpec{InSampleDays: 180, OutOfSampleDays: 90, StepDays: 30}).windows(start, end); err == nil {
+		t.Fatalf("expected error for overlapping out-of-sample windows")
+	}
+}
+
+func TestWalkForwardStability(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windows := []Window{
+		{Values: []interface{}{30.0, "DELTA:0.20"}, InStart: day, InEnd: day.AddDate(0, 0, 364), OutStart: day.AddDate(1, 0, 0), OutEnd: day.AddDate(1, 0, 364),
+			InSample: engine.Summary{ReturnPct: 10}, OutSample: engine.Summary{ReturnPct: 5}},
+		{Values: []interface{}{40.0, "DELTA:0.20"}, InStart: day, InEnd: day.AddDate(0, 0, 364), OutStart: day.AddDate(1, 0, 0), OutEnd: day.AddDate(1, 0, 364),
+			InSample: engine.Summary{ReturnPct: 10}, OutSample: engine.Summary{ReturnPct: 3}},
+		{Values: []interface{}{30.0, "DELTA:0.15"}, InSample: engine.Summary{ReturnPct: -5}},
+		{Error: "in sample: no dates scheduled"},
+	}
+	st := stability([]string{"strategy.dte", "strategy.strategy.0.strike_rule"}, windows)
+	if st[0].Distinct != 2 || st[0].Mode != 30.0 || math.Abs(st[0].ModeShare-200.0/3) > 1e-9 || math.Abs(st[0].Mean-100.0/3) > 1e-9 {
+		t.Fatalf("unexpected dte stability %+v", st[0])
+	}
+	if st[1].Mode != "DELTA:0.20" || st[1].Mean != 0 {
+		t.Fatalf("unexpected strike stability %+v", st[1])
+	}
+	// losing in-sample windows are left out
+	if got := efficiency(windows); math.Abs(got-40) > 1e-9 {
+		t.Fatalf("expected efficiency 40%%, got %.4f", got)
+	}
+}
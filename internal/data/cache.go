@@ -0,0 +1,49 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// barCacheProvider wraps a Provider and keeps the bars it returned in memory,
+// so that runs over the same symbols and windows (universe screening,
+// portfolio sleeves, parameter sweeps) fetch each series once.
+type barCacheProvider struct {
+	Provider // wrapped provider, serves everything but bars
+
+	mu   sync.Mutex
+	bars map[string][]Bar
+}
+
+// NewBarCache returns a Provider that caches the GetBars results of prov.
+// Errors are not cached. Wrapping a bar cache again returns it unchanged.
+// It is safe for concurrent use if prov is.
+func NewBarCache(prov Provider) Provider {
+	if c, ok := prov.(*barCacheProvider); ok {
+		return c
+	}
+	return &barCacheProvider{Provider: prov, bars: make(map[string][]Bar)}
+}
+
+func (c *barCacheProvider) GetBars(underlying string, fromDate, toDate time.Time, timespan int, multiplier string) ([]Bar, error) {
+	key := fmt.Sprintf("%s|%s|%s|%d|%s", strings.ToUpper(underlying), fromDate.Format(time.RFC3339), toDate.Format(time.RFC3339), timespan, multiplier)
+	c.mu.Lock()
+	cached, ok := c.bars[key]
+	c.mu.Unlock()
+	if !ok {
+		bars, err := c.Provider.GetBars(underlying, fromDate, toDate, timespan, multiplier)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.bars[key] = bars
+		c.mu.Unlock()
+		cached = bars
+	}
+	// callers own the returned slice
+	out := make([]Bar, len(cached))
+	copy(out, cached)
+	return out, nil
+}
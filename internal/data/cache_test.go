@@ -0,0 +1,37 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+// countingProvider counts GetBars calls.
+type countingProvider struct {
+	Provider
+	calls int
+}
+
+func (p *countingProvider) GetBars(underlying string, fromDate, toDate time.Time, timespan int, multiplier string) ([]Bar, error) {
+	p.calls++
+	return []Bar{{Date: fromDate, Close: 100}}, nil
+}
+
+func TestBarCache(t *testing.T) {
+	inner := &countingProvider{}
+	prov := NewBarCache(inner)
+	from := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	a, _ := prov.GetBars("spy", from, to, 1, "day")
+	a[0].Close = 0 // callers own their copy
+	b, _ := prov.GetBars("SPY", from, to, 1, "day")
+	if inner.calls != 1 || b[0].Close != 100 {
+		t.Fatalf("expected one fetch and an unmodified cached bar, got %d calls and close %.2f", inner.calls, b[0].Close)
+	}
+	if _, _ = prov.GetBars("SPY", from, to, 5, "minute"); inner.calls != 2 {
+		t.Fatalf("expected a new fetch for another resolution, got %d calls", inner.calls)
+	}
+	if NewBarCache(prov) != prov {
+		t.Fatalf("expected wrapping a cache to return it unchanged")
+	}
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+// Dividend is a cash dividend of an underlying.
+type Dividend struct {
+	ExDate  time.Time `json:"ex_date"`            // ex-dividend date, the first session trading without it
+	PayDate time.Time `json:"pay_date,omitempty"` // payment date, zero if unknown
+	Amount  float64   `json:"amount"`             // cash amount per share
+}
+
+// CashDividends returns the dividends going ex after asOf's session and no
+// later than expiry's, timed in years from asOf for the escrowed-dividend
+// model of the pricing package.
+func CashDividends(divs []Dividend, asOf, expiry time.Time) []pricing.CashDividend {
+	day := func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+	from, to := day(asOf), day(expiry)
+	var out []pricing.CashDividend
+	for _, d := range divs {
+		ex := day(d.ExDate)
+		if !ex.After(from) || ex.After(to) || d.Amount <= 0 {
+			continue
+		}
+		out = append(out, pricing.CashDividend{T: ex.Sub(asOf).Hours() / (24 * 365), Amount: d.Amount})
+	}
+	return out
+}
+
+// readDividendsCSV reads the dividends of one underlying going ex within
+// [fromDate, toDate] from a CSV with the header
+//
+//	symbol,ex_date,amount,pay_date
+//
+// where dates are YYYY-MM-DD and pay_date may be left out. Rows are returned
+// in ex-date order.
+func readDividendsCSV(rd io.Reader, underlying string, fromDate, toDate time.Time) ([]Dividend, error) {
+	records, err := csv.NewReader(rd).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	col := make(map[string]int)
+	for i, h := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, name := range []string{"symbol", "ex_date", "amount"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+
+	from := time.Date(fromDate.Year(), fromDate.Month(), fromDate.Day(), 0, 0, 0, 0, time.UTC)
+	var out []Dividend
+	for n, row := range records[1:] {
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		if !strings.EqualFold(get("symbol"), underlying) {
+			continue
+		}
+		ex, err := time.Parse("2006-01-02", get("ex_date"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: ex_date: %w", n+2, err)
+		}
+		if ex.Before(from) || ex.After(toDate) {
+			continue
+		}
+		amount, err := strconv.ParseFloat(get("amount"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: amount: %w", n+2, err)
+		}
+		d := Dividend{ExDate: ex, Amount: amount}
+		if s := get("pay_date"); s != "" {
+			if d.PayDate, err = time.Parse("2006-01-02", s); err != nil {
+				return nil, fmt.Errorf("row %d: pay_date: %w", n+2, err)
+			}
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExDate.Before(out[j].ExDate) })
+	return out, nil
+}
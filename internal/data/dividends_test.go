@@ -0,0 +1,46 @@
+package data
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalDividends(t *testing.T) {
+	dir := t.TempDir()
+	csv := "symbol,ex_date,amount,pay_date\n" +
+		"AAPL,2024-05-10,0.25,2024-05-16\n" +
+		"AAPL,2024-02-09,0.24,\n" +
+		"MSFT,2024-02-14,0.75,2024-03-14\n" +
+		"AAPL,2023-11-10,0.24,2023-11-16\n"
+	if err := os.WriteFile(filepath.Join(dir, "dividends.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prov := NewLocalFileDataProvider(dir, nil)
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	divs, err := prov.GetDividends("aapl", from, from.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("GetDividends: %v", err)
+	}
+	if len(divs) != 2 || divs[0].Amount != 0.24 || !divs[1].PayDate.Equal(time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected AAPL's two 2024 dividends in ex-date order, got %+v", divs)
+	}
+
+	// an underlying missing from the file falls back to the secondary provider
+	withSynth := NewLocalFileDataProvider(dir, NewSyntheticProvider())
+	if divs, err := withSynth.GetDividends("SPY", from, from.AddDate(1, 0, 0)); err != nil || len(divs) != 0 {
+		t.Fatalf("expected no SPY dividends from the secondary, got %+v (%v)", divs, err)
+	}
+	if _, err := NewLocalFileDataProvider(t.TempDir(), nil).GetDividends("AAPL", from, from); err == nil {
+		t.Fatalf("expected an error without a dividends file or secondary provider")
+	}
+
+	// only dividends going ex after the valuation day and by expiry count
+	asOf := time.Date(2024, 2, 9, 15, 0, 0, 0, time.UTC)
+	cash := CashDividends(divs, asOf, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC))
+	if len(cash) != 1 || cash[0].Amount != 0.25 || math.Abs(cash[0].T-(91*24-15)/(24*365.0)) > 1e-12 {
+		t.Fatalf("expected only the May dividend timed from asOf, got %+v", cash)
+	}
+}
@@ -56,6 +56,13 @@ func (localFileDataProv *localFileDataProvider) GetOptionPrice(underlying string
 	return 0, fmt.Errorf("GetOptionMidPrice not implemented for localFileDataProvider")
 }
 
+func (localFileDataProv *localFileDataProvider) GetOptionQuote(underlying string, strike float64, expiryDate time.Time, optType string, asOfDate time.Time) (OptionQuote, error) {
+	if localFileDataProv.secondary != nil {
+		return localFileDataProv.secondary.GetOptionQuote(underlying, strike, expiryDate, optType, asOfDate)
+	}
+	return OptionQuote{}, fmt.Errorf("GetOptionQuote not implemented for localFileDataProvider")
+}
+
 func (localFileDataProv *localFileDataProvider) GetRelevantExpiries(ticker string, fromDate, toDate time.Time) ([]time.Time, error) {
 	if localFileDataProv.secondary != nil {
 		return localFileDataProv.secondary.GetRelevantExpiries(ticker, fromDate, toDate)
@@ -63,6 +70,27 @@ func (localFileDataProv *localFileDataProvider) GetRelevantExpiries(ticker strin
 	return nil, fmt.Errorf("GetRelevantExpiries not implemented for localFileDataProvider")
 }
 
+// GetDividends reads the underlying's dividends going ex within the range
+// from dividends.csv in the provider's directory (see readDividendsCSV). An
+// underlying missing from the file is looked up in the secondary provider.
+func (localFileDataProv *localFileDataProvider) GetDividends(underlying string, fromDate, toDate time.Time) ([]Dividend, error) {
+	f, err := os.Open(filepath.Join(localFileDataProv.dir, "dividends.csv"))
+	if err == nil {
+		defer f.Close()
+		divs, err := readDividendsCSV(f, underlying, fromDate, toDate)
+		if err != nil {
+			return nil, fmt.Errorf("read dividends file: %w", err)
+		}
+		if len(divs) > 0 || localFileDataProv.secondary == nil {
+			return divs, nil
+		}
+	}
+	if localFileDataProv.secondary != nil {
+		return localFileDataProv.secondary.GetDividends(underlying, fromDate, toDate)
+	}
+	return nil, fmt.Errorf("open dividends file: %w", err)
+}
+
 // getIntervals reads the CSV once and caches it
 func (localFileDataProv *localFileDataProvider) getIntervals(underlying string) float64 {
 	intervals := make(map[string]float64)
@@ -115,6 +143,9 @@ func (localFileDataProv *localFileDataProvider) RoundToNearestStrike(underlying
 	loadOnce.Do(func() {
 		intervals = localFileDataProv.getIntervals(underlying)
 	})
+	if intervals == 0.0 {
+		intervals = Products.StrikeInterval(underlying, asOfPrice)
+	}
 
 	if intervals == 0.0 {
 		// fail safe: no rounding
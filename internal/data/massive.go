@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/contactkeval/option-replay/internal/logger"
@@ -68,6 +69,25 @@ type massiveContractsResp struct {
 	NextURL   string            `json:"next_url"`
 }
 
+// massiveDividend represents a single dividend returned by Massive's
+// dividends reference endpoint.
+type massiveDividend struct {
+	CashAmount     float64 `json:"cash_amount"`
+	DividendType   string  `json:"dividend_type"`
+	ExDividendDate string  `json:"ex_dividend_date"`
+	PayDate        string  `json:"pay_date"`
+	Ticker         string  `json:"ticker"`
+}
+
+// massiveDividendsResp models the paginated response returned by Massive's
+// dividends API.
+type massiveDividendsResp struct {
+	Results   []massiveDividend `json:"results"`
+	Status    string            `json:"status"`
+	RequestID string            `json:"request_id"`
+	NextURL   string            `json:"next_url"`
+}
+
 // NewMassiveDataProvider constructs a Massive-backed data provider.
 //
 // It initializes an HTTP client with sensible defaults for:
@@ -274,9 +294,11 @@ func (massiveDataProv *massiveDataProvider) GetContracts(
 			}
 
 			out = append(out, OptionContract{
-				ExpiryDate: t,
-				Strike:     result.StrikePrice,
-				Type:       result.ContractType,
+				ExpiryDate:        t,
+				Strike:            result.StrikePrice,
+				Type:              result.ContractType,
+				SharesPerContract: result.SharesPerContract,
+				ExerciseStyle:     result.ExerciseStyle,
 			})
 		}
 
@@ -510,6 +532,115 @@ func (massiveDataProv *massiveDataProvider) GetRelevantExpiries(
 	return expiries, nil
 }
 
+// GetDividends retrieves the cash dividends of an underlying going ex within
+// a date range, in ex-date order.
+//
+// Special cash dividends (dividend_type "SC") are left out: listed options
+// are adjusted for them rather than priced with them.
+//
+// Parameters:
+//   - underlying: underlying ticker symbol
+//   - fromDate: ex-dividend range start
+//   - toDate: ex-dividend range end
+//
+// Returns:
+//   - []Dividend: matching dividends
+//   - error: if request or decoding fails
+func (massiveDataProv *massiveDataProvider) GetDividends(
+	underlying string,
+	fromDate, toDate time.Time,
+) ([]Dividend, error) {
+
+	logger.Tracef(
+		"fetching dividends: %s [%s → %s]",
+		underlying,
+		fromDate.Format("2006-01-02"),
+		toDate.Format("2006-01-02"),
+	)
+
+	out := []Dividend{}
+
+	url, err := url.Parse(massiveDataProv.BaseURL + "/v3/reference/dividends")
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Query()
+	query.Set("ticker", underlying)
+	query.Set("ex_dividend_date.gte", fromDate.Format("2006-01-02"))
+	query.Set("ex_dividend_date.lte", toDate.Format("2006-01-02"))
+	query.Set("order", "asc")
+	query.Set("sort", "ex_dividend_date")
+	query.Set("limit", "1000")
+	query.Set("apiKey", massiveDataProv.APIKey)
+
+	url.RawQuery = query.Encode()
+	reqURL := url.String()
+
+	// Handle pagination
+	for reqURL != "" {
+		logger.Debugf("dividends request URL: %s", reqURL)
+
+		req, err := http.NewRequest("GET", reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+massiveDataProv.APIKey)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", "massive-client/1.0")
+
+		resp, err := massiveDataProv.processGetRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			var dbg struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(body, &dbg)
+			return nil, fmt.Errorf(
+				"massive returned status %d: %s",
+				resp.StatusCode,
+				dbg.Message,
+			)
+		}
+
+		var massiveResp massiveDividendsResp
+		if err := json.Unmarshal(body, &massiveResp); err != nil {
+			return nil, fmt.Errorf("decode: %w", err)
+		}
+
+		for _, result := range massiveResp.Results {
+			if strings.EqualFold(result.DividendType, "SC") || result.CashAmount <= 0 {
+				continue
+			}
+			ex, err := time.Parse("2006-01-02", result.ExDividendDate)
+			if err != nil {
+				continue // skip malformed ex-dividend dates
+			}
+			d := Dividend{ExDate: ex, Amount: result.CashAmount}
+			if pay, err := time.Parse("2006-01-02", result.PayDate); err == nil {
+				d.PayDate = pay
+			}
+			out = append(out, d)
+		}
+
+		reqURL = massiveResp.NextURL
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ExDate.Before(out[j].ExDate) })
+	logger.Tracef("received %d dividends", len(out))
+	return out, nil
+}
+
 // GetOptionPrice retrieves the price of an option at a specific trade date and time.
 // It attempts to find the option price by first looking for bars from 5 minutes before
 // the trade time and using the closing price if available. If no bars are found in that
@@ -585,6 +716,112 @@ func (massiveDataProv *massiveDataProvider) GetOptionPrice(
 	return price, nil
 }
 
+// GetOptionQuote retrieves the top-of-book quote of an option as of a trade date and time.
+// The bid and ask come from the most recent NBBO quote at or before tradeDateTime; the last
+// price and volume come from the option's daily bar of the previous session, the latest one
+// complete at tradeDateTime.
+//
+// NOTE:
+//   - Massive does not expose historical open interest, so OpenInterest is left at zero
+//     (unknown). The engine's open-interest guard then rejects the fill unless
+//     fills.allow_unknown_liquidity is set.
+//
+// Parameters:
+//   - underlying: the underlying asset symbol
+//   - strike: the strike price of the option
+//   - expiryDate: the expiration date of the option
+//   - optType: the option type (e.g., "call" or "put")
+//   - tradeDateTime: the date and time as of which to retrieve the quote
+//
+// Returns:
+//   - OptionQuote: bid, ask, last and volume for the contract
+//   - error: if no usable quote is found
+func (massiveDataProv *massiveDataProvider) GetOptionQuote(
+	underlying string,
+	strike float64,
+	expiryDate time.Time,
+	optType string,
+	tradeDateTime time.Time,
+) (OptionQuote, error) {
+
+	symbol := OptionSymbolFromParts(underlying, expiryDate, optType, strike)
+
+	logger.Debugf(
+		"option quote lookup: %s at %s",
+		symbol,
+		tradeDateTime.Format(time.RFC3339),
+	)
+
+	url, err := url.Parse(massiveDataProv.BaseURL + "/v3/quotes/" + symbol)
+	if err != nil {
+		return OptionQuote{}, err
+	}
+
+	query := url.Query()
+	query.Set("timestamp.lte", fmt.Sprintf("%d", tradeDateTime.UnixNano()))
+	query.Set("order", "desc")
+	query.Set("sort", "timestamp")
+	query.Set("limit", "1")
+	query.Set("apiKey", massiveDataProv.APIKey)
+	url.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", url.String(), nil)
+	if err != nil {
+		return OptionQuote{}, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := massiveDataProv.processGetRequest(req)
+	if err != nil {
+		logger.Errorf("quote request failed for %s", symbol)
+		return OptionQuote{}, fmt.Errorf("massive api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Results []struct {
+			AskPrice float64 `json:"ask_price"`
+			BidPrice float64 `json:"bid_price"`
+		} `json:"results"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return OptionQuote{}, fmt.Errorf("parsing massive response: %w", err)
+	}
+	if len(body.Results) == 0 {
+		return OptionQuote{}, fmt.Errorf(
+			"no option quotes found for %s on %s",
+			symbol,
+			tradeDateTime.Format("2006-01-02 15:04"),
+		)
+	}
+
+	q := OptionQuote{
+		Bid: body.Results[0].BidPrice,
+		Ask: body.Results[0].AskPrice,
+	}
+
+	// The previous session's daily bar supplies last price and volume: the bar of
+	// tradeDateTime's own session closes after it. Missing bars are not fatal.
+	bars, err := massiveDataProv.GetBars(symbol, tradeDateTime.AddDate(0, 0, -7), tradeDateTime.AddDate(0, 0, -1), 1, "day")
+	if err == nil && len(bars) > 0 {
+		q.Last = bars[len(bars)-1].Close
+		q.Volume = bars[len(bars)-1].Vol
+	} else {
+		logger.Tracef("no previous daily bar for %s, last and volume unknown", symbol)
+	}
+
+	logger.Tracef(
+		"quote resolved %s bid=%.2f ask=%.2f last=%.2f vol=%.0f",
+		symbol, q.Bid, q.Ask, q.Last, q.Volume,
+	)
+
+	if q.Mid() <= 0 {
+		return OptionQuote{}, fmt.Errorf("no usable option quote for %s", symbol)
+	}
+	return q, nil
+}
+
 // RoundToNearestStrike finds the nearest available option strike price to the given price.
 // It retrieves all option contracts for the specified underlying asset and expiry date,
 // extracts their strike prices, and returns the strike closest to asOfPrice.
@@ -624,12 +861,11 @@ func (massiveDataProv *massiveDataProvider) RoundToNearestStrike(
 		return Closest(strikeList, asOfPrice)
 	}
 
-	return massiveDataProv.RoundToNearestStrike(
-		underlying,
-		expiryDate,
-		openDate,
-		asOfPrice,
-	)
+	// no listed strikes: round on the registered strike interval
+	if intervals := Products.StrikeInterval(underlying, asOfPrice); intervals > 0 {
+		return math.Round(asOfPrice/intervals) * intervals
+	}
+	return asOfPrice
 }
 
 // processGetRequest executes an HTTP GET request with rate-limit handling.
@@ -676,9 +912,10 @@ func (massiveDataProv *massiveDataProvider) processGetRequest(
 	}
 }
 
-// getIntervals is a placeholder for future interval logic.
+// getIntervals returns the registered strike interval of the underlying
+// for prices in its lowest band, or 0 if it has none.
 func (massiveDataProv *massiveDataProvider) getIntervals(
 	underlying string,
 ) float64 {
-	return 0.0
+	return Products.StrikeInterval(underlying, 0)
 }
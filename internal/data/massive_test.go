@@ -1,9 +1,11 @@
 package data
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -87,6 +89,100 @@ func TestMassiveProvider_Pagination(t *testing.T) {
 	}
 }
 
+func TestMassiveProvider_GetDividends(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page2" {
+			w.Write([]byte(`{"results": [
+				{"ticker":"AAPL","cash_amount":0.25,"dividend_type":"CD","ex_dividend_date":"2024-08-12","pay_date":"2024-08-15"}
+			]}`))
+			return
+		}
+		if r.URL.Path != "/v3/reference/dividends" || r.URL.Query().Get("ticker") != "AAPL" ||
+			r.URL.Query().Get("ex_dividend_date.gte") != "2024-01-01" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"results": [
+				{"ticker":"AAPL","cash_amount":0.24,"dividend_type":"CD","ex_dividend_date":"2024-02-09","pay_date":"2024-02-15"},
+				{"ticker":"AAPL","cash_amount":3.00,"dividend_type":"SC","ex_dividend_date":"2024-03-01"}
+			],
+			"next_url": "` + srv.URL + `/page2"
+		}`))
+	}))
+	defer srv.Close()
+
+	prov := &massiveDataProvider{
+		APIKey:  "test",
+		Client:  srv.Client(),
+		BaseURL: srv.URL,
+	}
+
+	divs, err := prov.GetDividends("AAPL", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(divs) != 2 || divs[0].Amount != 0.24 || divs[1].Amount != 0.25 ||
+		!divs[1].PayDate.Equal(time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the two regular dividends across both pages, got %+v", divs)
+	}
+}
+
+func TestMassiveProvider_GetOptionQuote(t *testing.T) {
+	asOf := time.Date(2025, 1, 8, 14, 30, 0, 0, time.UTC)
+	symbol := OptionSymbolFromParts("SPY", time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC), "call", 590)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/quotes/" + symbol:
+			if r.URL.Query().Get("timestamp.lte") != fmt.Sprintf("%d", asOf.UnixNano()) {
+				t.Errorf("expected quotes up to %s, got %s", asOf, r.URL)
+			}
+			w.Write([]byte(`{"status":"OK","results":[{"bid_price":4.10,"ask_price":4.30}]}`))
+		case "/v2/aggs/ticker/" + symbol + "/range/1/day/2025-01-01/2025-01-07":
+			// the previous session: the 2025-01-08 bar is not complete at 14:30
+			w.Write([]byte(`{"results":[{"t":1736208000000,"o":4.0,"h":4.6,"l":3.9,"c":4.45,"v":1250}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	prov := &massiveDataProvider{APIKey: "test", Client: srv.Client(), BaseURL: srv.URL}
+	q, err := prov.GetOptionQuote("SPY", 590, time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC), "call", asOf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := OptionQuote{Bid: 4.10, Ask: 4.30, Last: 4.45, Volume: 1250}
+	if q != want {
+		t.Fatalf("expected %+v with no open interest, got %+v", want, q)
+	}
+}
+
+func TestMassiveProvider_GetOptionQuoteErrors(t *testing.T) {
+	asOf := time.Date(2025, 1, 8, 14, 30, 0, 0, time.UTC)
+	for name, quotes := range map[string]func(w http.ResponseWriter){
+		"no quotes": func(w http.ResponseWriter) { w.Write([]byte(`{"status":"OK","results":[]}`)) },
+		"empty book": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"status":"OK","results":[{"bid_price":0,"ask_price":0}]}`))
+		},
+		"http error":  func(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) },
+		"bad payload": func(w http.ResponseWriter) { w.Write([]byte(`{"results":`)) },
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/v3/quotes/") {
+				quotes(w)
+				return
+			}
+			w.Write([]byte(`{"results":[]}`))
+		}))
+		prov := &massiveDataProvider{APIKey: "test", Client: srv.Client(), BaseURL: srv.URL}
+		if q, err := prov.GetOptionQuote("SPY", 590, time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC), "call", asOf); err == nil {
+			t.Errorf("%s: expected an error, got %+v", name, q)
+		}
+		srv.Close()
+	}
+}
+
 func TestMassiveRoundToNearestStrike(t *testing.T) {
 	actual := prov.RoundToNearestStrike(underlying, expiryDate, tradeDateTime, asOfPrice)
 	expected := 581.0
@@ -166,6 +166,64 @@ func (polygonDataProv *polygonDataProvider) GetOptionPrice(underlying string, st
 	return 0, fmt.Errorf("no usable option price for %s", symbol)
 }
 
+// GetOptionQuote returns the latest quote from the v3 options snapshot. The
+// snapshot has no history, so quotes for any asOfDate other than today come
+// from the secondary provider: serving today's book for a past bar would fill
+// and mark a backtest with look-ahead data. Without a secondary such dates
+// are an error and the caller falls back to prices instead.
+func (polygonDataProv *polygonDataProvider) GetOptionQuote(underlying string, strike float64, expiryDate time.Time, optType string, asOfDate time.Time) (OptionQuote, error) {
+	symbol := OptionSymbolFromParts(underlying, expiryDate, optType, strike)
+	if day := asOfDate.Format("2006-01-02"); day != time.Now().In(asOfDate.Location()).Format("2006-01-02") {
+		if polygonDataProv.secondary != nil {
+			return polygonDataProv.secondary.GetOptionQuote(underlying, strike, expiryDate, optType, asOfDate)
+		}
+		return OptionQuote{}, fmt.Errorf("polygon options snapshot has no historical quote for %s on %s", symbol, day)
+	}
+	url := fmt.Sprintf("https://api.polygon.io/v3/snapshot/options/%s/%s?apiKey=%s", underlying, symbol, polygonDataProv.apiKey)
+	req, _ := http.NewRequest("GET", url, nil)
+	resp, err := polygonDataProv.client.Do(req)
+	if err != nil {
+		return OptionQuote{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return OptionQuote{}, fmt.Errorf("polygon options snapshot status %d", resp.StatusCode)
+	}
+	var res struct {
+		Results struct {
+			Day struct {
+				Close  float64 `json:"close"`
+				Volume float64 `json:"volume"`
+			} `json:"day"`
+			LastQuote struct {
+				Ask float64 `json:"ask"`
+				Bid float64 `json:"bid"`
+			} `json:"last_quote"`
+			LastTrade struct {
+				Price float64 `json:"price"`
+			} `json:"last_trade"`
+			OpenInterest float64 `json:"open_interest"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return OptionQuote{}, err
+	}
+	q := OptionQuote{
+		Bid:          res.Results.LastQuote.Bid,
+		Ask:          res.Results.LastQuote.Ask,
+		Last:         res.Results.LastTrade.Price,
+		Volume:       res.Results.Day.Volume,
+		OpenInterest: res.Results.OpenInterest,
+	}
+	if q.Last <= 0 {
+		q.Last = res.Results.Day.Close
+	}
+	if q.Mid() <= 0 {
+		return OptionQuote{}, fmt.Errorf("no usable option quote for %s", symbol)
+	}
+	return q, nil
+}
+
 func (polygonDataProv *polygonDataProvider) GetRelevantExpiries(ticker string, fromDate, toDate time.Time) ([]time.Time, error) {
 	if polygonDataProv.secondary != nil {
 		return polygonDataProv.secondary.GetRelevantExpiries(ticker, fromDate, toDate)
@@ -173,8 +231,18 @@ func (polygonDataProv *polygonDataProvider) GetRelevantExpiries(ticker string, f
 	return nil, fmt.Errorf("GetRelevantExpiries not implemented for PolygonProvider")
 }
 
+func (polygonDataProv *polygonDataProvider) GetDividends(underlying string, fromDate, toDate time.Time) ([]Dividend, error) {
+	if polygonDataProv.secondary != nil {
+		return polygonDataProv.secondary.GetDividends(underlying, fromDate, toDate)
+	}
+	return nil, fmt.Errorf("GetDividends not implemented for PolygonProvider")
+}
+
 func (polygonDataProv *polygonDataProvider) RoundToNearestStrike(underlying string, expiryDate, openDate time.Time, asOfPrice float64) float64 {
-	intervals := polygonDataProv.getIntervals(underlying)
+	intervals := Products.StrikeInterval(underlying, asOfPrice)
+	if intervals == 0 {
+		intervals = polygonDataProv.getIntervals(underlying)
+	}
 	return math.Round(asOfPrice/intervals) * intervals
 }
 
@@ -0,0 +1,341 @@
+package data
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/logger"
+)
+
+const (
+	ExerciseAmerican = "american" // exercisable any day up to expiry
+	ExerciseEuropean = "european" // exercisable at expiry only
+
+	SettlePhysical = "physical" // in-the-money options deliver the underlying
+	SettleCash     = "cash"     // in-the-money options pay intrinsic value in cash
+
+	SettlePM = "pm" // settles at the expiration day's close
+	SettleAM = "am" // settles at the expiration day's opening print
+)
+
+// StrikeBand is the strike interval listed below an underlying price.
+type StrikeBand struct {
+	Below    float64 `json:"below,omitempty"` // band applies to prices below this, 0 = no upper bound
+	Interval float64 `json:"interval"`        // strike spacing in the band, e.g. 2.5
+}
+
+// Product is the contract metadata of an underlying's options.
+type Product struct {
+	Symbol          string       `json:"symbol"`                     // underlying symbol, e.g. "SPX"
+	Multiplier      float64      `json:"multiplier,omitempty"`       // underlying units per contract, default: 100
+	StrikeBands     []StrikeBand `json:"strike_bands,omitempty"`     // strike intervals by price band, ascending
+	ExerciseStyle   string       `json:"exercise_style,omitempty"`   // "american" or "european", default: "american"
+	Settlement      string       `json:"settlement,omitempty"`       // "physical" or "cash", default: "physical"
+	SettlementPrice string       `json:"settlement_price,omitempty"` // "pm" or "am", default: "pm"
+	TickSize        float64      `json:"tick_size,omitempty"`        // minimum option price increment, default: 0.01
+	MarketOpen      string       `json:"market_open,omitempty"`      // session open in exchange time, default: "09:30"
+	MarketClose     string       `json:"market_close,omitempty"`     // session close in exchange time, default: "16:00"
+	DividendYield   float64      `json:"dividend_yield,omitempty"`   // continuous dividend yield for index options, e.g. 0.013; cash dividends come from the provider
+}
+
+// StrikeInterval returns the strike spacing listed at an underlying price,
+// or 0 if the product has no strike bands.
+func (p Product) StrikeInterval(price float64) float64 {
+	for _, b := range p.StrikeBands {
+		if b.Below <= 0 || price < b.Below {
+			return b.Interval
+		}
+	}
+	return 0
+}
+
+// withDefaults returns p with unset fields given their defaults.
+func (p Product) withDefaults() Product {
+	p.Symbol = strings.ToUpper(strings.TrimSpace(p.Symbol))
+	p.ExerciseStyle = strings.ToLower(p.ExerciseStyle)
+	p.Settlement = strings.ToLower(p.Settlement)
+	p.SettlementPrice = strings.ToLower(p.SettlementPrice)
+	if p.Multiplier <= 0 {
+		p.Multiplier = 100
+	}
+	if p.ExerciseStyle == "" {
+		p.ExerciseStyle = ExerciseAmerican
+	}
+	if p.Settlement == "" {
+		p.Settlement = SettlePhysical
+	}
+	if p.SettlementPrice == "" {
+		p.SettlementPrice = SettlePM
+	}
+	if p.TickSize <= 0 {
+		p.TickSize = 0.01
+	}
+	if p.MarketOpen == "" {
+		p.MarketOpen = "09:30"
+	}
+	if p.MarketClose == "" {
+		p.MarketClose = "16:00"
+	}
+	sort.SliceStable(p.StrikeBands, func(i, j int) bool {
+		bi, bj := p.StrikeBands[i].Below, p.StrikeBands[j].Below
+		return bi > 0 && (bj <= 0 || bi < bj)
+	})
+	return p
+}
+
+// ProductRegistry holds product metadata by underlying symbol. It is safe
+// for concurrent use.
+type ProductRegistry struct {
+	mu       sync.RWMutex
+	products map[string]Product
+}
+
+// NewProductRegistry returns a registry holding the given products.
+func NewProductRegistry(products ...Product) *ProductRegistry {
+	r := &ProductRegistry{products: make(map[string]Product)}
+	for _, p := range products {
+		r.Register(p)
+	}
+	return r
+}
+
+// Products holds the well-known index and ETF products below. Providers
+// consult it directly; each engine run works on a Clone of it, extended with
+// the run's products file and populated product, so that one config's
+// products never leak into another run.
+var Products = NewProductRegistry(
+	Product{Symbol: "SPX", StrikeBands: []StrikeBand{{Interval: 5}}, ExerciseStyle: ExerciseEuropean, Settlement: SettleCash, SettlementPrice: SettleAM, TickSize: 0.05, MarketClose: "16:15"},
+	Product{Symbol: "NDX", StrikeBands: []StrikeBand{{Interval: 10}}, ExerciseStyle: ExerciseEuropean, Settlement: SettleCash, SettlementPrice: SettleAM, TickSize: 0.05, MarketClose: "16:15"},
+	Product{Symbol: "RUT", StrikeBands: []StrikeBand{{Interval: 5}}, ExerciseStyle: ExerciseEuropean, Settlement: SettleCash, SettlementPrice: SettleAM, TickSize: 0.05, MarketClose: "16:15"},
+	Product{Symbol: "VIX", StrikeBands: []StrikeBand{{Below: 30, Interval: 0.5}, {Interval: 1}}, ExerciseStyle: ExerciseEuropean, Settlement: SettleCash, SettlementPrice: SettleAM, TickSize: 0.05, MarketClose: "16:15"},
+	Product{Symbol: "SPY", StrikeBands: []StrikeBand{{Interval: 1}}, MarketClose: "16:15"},
+	Product{Symbol: "QQQ", StrikeBands: []StrikeBand{{Interval: 1}}, MarketClose: "16:15"},
+	Product{Symbol: "IWM", StrikeBands: []StrikeBand{{Interval: 1}}, MarketClose: "16:15"},
+)
+
+// Clone returns a registry holding the products of r, to be extended
+// without changing r.
+func (r *ProductRegistry) Clone() *ProductRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &ProductRegistry{products: make(map[string]Product, len(r.products))}
+	for sym, p := range r.products {
+		c.products[sym] = p
+	}
+	return c
+}
+
+// Register adds or replaces a product.
+func (r *ProductRegistry) Register(p Product) {
+	p = p.withDefaults()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.products[p.Symbol] = p
+}
+
+// Lookup returns the registered product of a symbol.
+func (r *ProductRegistry) Lookup(symbol string) (Product, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.products[strings.ToUpper(strings.TrimSpace(symbol))]
+	return p, ok
+}
+
+// Get returns the product of a symbol, or a default equity product
+// (100 shares, American, physically delivered, PM-settled) if none is
+// registered.
+func (r *ProductRegistry) Get(symbol string) Product {
+	if p, ok := r.Lookup(symbol); ok {
+		return p
+	}
+	return Product{Symbol: symbol}.withDefaults()
+}
+
+// StrikeInterval returns the strike spacing of a symbol at a price, or 0 if
+// unknown.
+func (r *ProductRegistry) StrikeInterval(symbol string, price float64) float64 {
+	p, ok := r.Lookup(symbol)
+	if !ok {
+		return 0
+	}
+	return p.StrikeInterval(price)
+}
+
+// LoadFile registers the products of a .json file (an array of Product) or
+// a .csv file with the header
+//
+//	symbol,multiplier,strike_bands,exercise_style,settlement,settlement_price,tick_size,market_open,market_close,dividend_yield
+//
+// where strike_bands lists below:interval pairs separated by ";", e.g.
+// "25:0.5;200:1;0:5". Columns may appear in any order and all but symbol
+// may be left out.
+func (r *ProductRegistry) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open products file: %w", err)
+	}
+	defer f.Close()
+
+	var products []Product
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&products); err != nil {
+			return fmt.Errorf("decode products %s: %w", path, err)
+		}
+	case ".csv":
+		products, err = readProductsCSV(f)
+		if err != nil {
+			return fmt.Errorf("read products %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported products file %s (want .json or .csv)", path)
+	}
+	for _, p := range products {
+		if strings.TrimSpace(p.Symbol) == "" {
+			return fmt.Errorf("product without symbol in %s", path)
+		}
+		r.Register(p)
+	}
+	logger.Infof("loaded %d products from %s", len(products), path)
+	return nil
+}
+
+func readProductsCSV(rd io.Reader) ([]Product, error) {
+	records, err := csv.NewReader(rd).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	col := make(map[string]int)
+	for i, h := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["symbol"]; !ok {
+		return nil, fmt.Errorf("missing symbol column")
+	}
+
+	var out []Product
+	for n, row := range records[1:] {
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		num := func(name string) (float64, error) {
+			s := get(name)
+			if s == "" {
+				return 0, nil
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return 0, fmt.Errorf("row %d: %s: %w", n+2, name, err)
+			}
+			return v, nil
+		}
+
+		p := Product{
+			Symbol:          get("symbol"),
+			ExerciseStyle:   get("exercise_style"),
+			Settlement:      get("settlement"),
+			SettlementPrice: get("settlement_price"),
+			MarketOpen:      get("market_open"),
+			MarketClose:     get("market_close"),
+		}
+		if p.Multiplier, err = num("multiplier"); err != nil {
+			return nil, err
+		}
+		if p.TickSize, err = num("tick_size"); err != nil {
+			return nil, err
+		}
+		if p.DividendYield, err = num("dividend_yield"); err != nil {
+			return nil, err
+		}
+		for _, band := range strings.Split(get("strike_bands"), ";") {
+			if strings.TrimSpace(band) == "" {
+				continue
+			}
+			below, interval, ok := strings.Cut(band, ":")
+			if !ok {
+				return nil, fmt.Errorf("row %d: strike band %q: want below:interval", n+2, band)
+			}
+			b, err1 := strconv.ParseFloat(strings.TrimSpace(below), 64)
+			iv, err2 := strconv.ParseFloat(strings.TrimSpace(interval), 64)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("row %d: strike band %q: invalid number", n+2, band)
+			}
+			p.StrikeBands = append(p.StrikeBands, StrikeBand{Below: b, Interval: iv})
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Populate registers the product of a symbol from the provider's contract
+// reference data as of a date, e.g. Massive's shares per contract and
+// exercise style. The strike interval is the most common spacing of the
+// listed strikes. Fields the contracts do not carry keep their registered
+// values.
+func (r *ProductRegistry) Populate(prov Provider, symbol string, asOf time.Time) error {
+	contracts, err := prov.GetContracts(symbol, 0, time.Time{}, asOf, asOf.AddDate(0, 0, 45))
+	if err != nil {
+		return fmt.Errorf("populate product %s: %w", symbol, err)
+	}
+	if len(contracts) == 0 {
+		return fmt.Errorf("populate product %s: no contracts listed", symbol)
+	}
+
+	p, ok := r.Lookup(symbol)
+	if !ok {
+		p = Product{Symbol: symbol}
+	}
+	if c := contracts[0]; c.SharesPerContract > 0 {
+		p.Multiplier = float64(c.SharesPerContract)
+	}
+	if c := contracts[0]; c.ExerciseStyle != "" {
+		p.ExerciseStyle = c.ExerciseStyle
+	}
+	if iv := commonSpacing(contracts); iv > 0 {
+		p.StrikeBands = []StrikeBand{{Interval: iv}}
+	}
+	r.Register(p)
+	return nil
+}
+
+// commonSpacing returns the most common gap between adjacent strikes of the
+// same expiry and type.
+func commonSpacing(contracts []OptionContract) float64 {
+	byChain := make(map[string][]float64)
+	for _, c := range contracts {
+		k := c.ExpiryDate.Format("2006-01-02") + c.Type
+		byChain[k] = append(byChain[k], c.Strike)
+	}
+	counts := make(map[float64]int)
+	for _, strikes := range byChain {
+		sort.Float64s(strikes)
+		for i := 1; i < len(strikes); i++ {
+			if gap := math.Round((strikes[i]-strikes[i-1])*1000) / 1000; gap > 0 {
+				counts[gap]++
+			}
+		}
+	}
+	best, n := 0.0, 0
+	for gap, c := range counts {
+		if c > n || (c == n && gap < best) {
+			best, n = gap, c
+		}
+	}
+	return best
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProductRegistry(t *testing.T) {
+	r := NewProductRegistry()
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "products.csv")
+	csvData := "symbol,multiplier,strike_bands,exercise_style,tick_size,dividend_yield\n" +
+		"xyz,10,25:0.5;200:1;0:5,,0.05,\n" +
+		"IDX,,0:25,european,,0.014\n"
+	if err := os.WriteFile(csvPath, []byte(csvData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadFile(csvPath); err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+
+	jsonPath := filepath.Join(dir, "products.json")
+	jsonData := `[{"symbol": "ABC", "settlement": "cash", "settlement_price": "AM", "market_close": "16:15"}]`
+	if err := os.WriteFile(jsonPath, []byte(jsonData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadFile(jsonPath); err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+
+	xyz := r.Get("XYZ")
+	if xyz.Multiplier != 10 || xyz.TickSize != 0.05 || xyz.ExerciseStyle != ExerciseAmerican {
+		t.Fatalf("unexpected XYZ product %+v", xyz)
+	}
+	for price, want := range map[float64]float64{10: 0.5, 120: 1, 350: 5} {
+		if got := xyz.StrikeInterval(price); got != want {
+			t.Errorf("XYZ interval at %.0f: expected %.1f, got %.1f", price, want, got)
+		}
+	}
+	if idx := r.Get("idx"); idx.ExerciseStyle != ExerciseEuropean || idx.Multiplier != 100 || idx.DividendYield != 0.014 || r.StrikeInterval("IDX", 4000) != 25 {
+		t.Fatalf("unexpected IDX product %+v", idx)
+	}
+	if abc := r.Get("ABC"); abc.Settlement != SettleCash || abc.SettlementPrice != SettleAM || abc.MarketOpen != "09:30" || abc.MarketClose != "16:15" {
+		t.Fatalf("unexpected ABC product %+v", abc)
+	}
+	if def := r.Get("NONE"); def.Multiplier != 100 || def.Settlement != SettlePhysical || def.StrikeInterval(100) != 0 {
+		t.Fatalf("unexpected default product %+v", def)
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	_ = os.WriteFile(bad, []byte("symbol,strike_bands\nXYZ,5\n"), 0644)
+	if err := r.LoadFile(bad); err == nil {
+		t.Fatalf("expected error for malformed strike band")
+	}
+}
+
+func TestProductRegistryClone(t *testing.T) {
+	base := NewProductRegistry(Product{Symbol: "SPY", StrikeBands: []StrikeBand{{Interval: 1}}})
+	c := base.Clone()
+	c.Register(Product{Symbol: "SPY", StrikeBands: []StrikeBand{{Interval: 5}}})
+	c.Register(Product{Symbol: "XYZ", Multiplier: 10})
+	if base.StrikeInterval("SPY", 500) != 1 || c.StrikeInterval("SPY", 500) != 5 {
+		t.Fatalf("expected the clone's SPY override to leave the base alone")
+	}
+	if _, ok := base.Lookup("XYZ"); ok {
+		t.Fatalf("expected a product registered on the clone to stay off the base")
+	}
+}
+
+// contractsProvider serves fixed contract reference data.
+type contractsProvider struct {
+	Provider
+	contracts []OptionContract
+}
+
+func (p contractsProvider) GetContracts(string, float64, time.Time, time.Time, time.Time) ([]OptionContract, error) {
+	return p.contracts, nil
+}
+
+func TestProductPopulate(t *testing.T) {
+	exp := time.Date(2025, 3, 21, 0, 0, 0, 0, time.UTC)
+	var contracts []OptionContract
+	for _, k := range []float64{90, 92.5, 95, 97.5, 100, 110} {
+		contracts = append(contracts, OptionContract{ExpiryDate: exp, Strike: k, Type: "call", SharesPerContract: 10, ExerciseStyle: "american"})
+	}
+	r := NewProductRegistry(Product{Symbol: "MINI", TickSize: 0.05})
+	if err := r.Populate(contractsProvider{contracts: contracts}, "MINI", exp.AddDate(0, 0, -30)); err != nil {
+		t.Fatalf("populate: %v", err)
+	}
+	p := r.Get("MINI")
+	if p.Multiplier != 10 || p.StrikeInterval(100) != 2.5 || p.TickSize != 0.05 {
+		t.Fatalf("unexpected populated product %+v", p)
+	}
+}
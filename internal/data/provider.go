@@ -18,7 +18,9 @@ type Provider interface {
 	GetContracts(underlying string, strike float64, expiryDate, fromDate, toDate time.Time) ([]OptionContract, error)
 	GetBars(underlying string, fromDate, toDate time.Time, timespan int, multiplier string) ([]Bar, error)
 	GetOptionPrice(underlying string, strike float64, expiryDate time.Time, optType string, openDate time.Time) (float64, error)
+	GetOptionQuote(underlying string, strike float64, expiryDate time.Time, optType string, asOfDate time.Time) (OptionQuote, error)
 	GetRelevantExpiries(underlying string, fromDate, toDate time.Time) ([]time.Time, error)
+	GetDividends(underlying string, fromDate, toDate time.Time) ([]Dividend, error)
 	RoundToNearestStrike(underlying string, expiryDate, openDate time.Time, asOfPrice float64) float64
 	getIntervals(underlying string) float64
 }
@@ -41,10 +43,37 @@ type Bar struct {
 	Count int64
 }
 
+// OptionQuote is a top-of-book snapshot for one option contract.
+type OptionQuote struct {
+	Bid          float64 // best bid per share
+	Ask          float64 // best ask per share
+	Last         float64 // last traded price per share, 0 if unknown
+	Volume       float64 // contracts traded in the current or latest complete session, 0 if unknown
+	OpenInterest float64 // open contracts, 0 if unknown
+}
+
+// Mid returns the midpoint of bid and ask, or Last if the book is one-sided.
+func (q OptionQuote) Mid() float64 {
+	if q.Bid > 0 && q.Ask > 0 {
+		return (q.Bid + q.Ask) / 2.0
+	}
+	return q.Last
+}
+
+// Spread returns ask minus bid, or 0 if the book is one-sided.
+func (q OptionQuote) Spread() float64 {
+	if q.Bid > 0 && q.Ask > 0 {
+		return q.Ask - q.Bid
+	}
+	return 0
+}
+
 type OptionContract struct {
-	ExpiryDate time.Time
-	Strike     float64
-	Type       string // "call" or "put"
+	ExpiryDate        time.Time
+	Strike            float64
+	Type              string // "call" or "put"
+	SharesPerContract int    // contract multiplier, 0 if unknown
+	ExerciseStyle     string // "american" or "european", empty if unknown
 }
 
 func GetLocalFileDataProvider() Provider {
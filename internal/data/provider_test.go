@@ -1,6 +1,7 @@
 package data
 
 import (
+	"net/http"
 	"os"
 	"testing"
 	"time"
@@ -148,3 +149,20 @@ func TestClosest(t *testing.T) {
 		t.Fatalf("expected %f, got %f", expected, closest)
 	}
 }
+
+func TestPolygonQuoteRejectsPastDates(t *testing.T) {
+	p := NewPolygonDataProvider("test")
+	asOf := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := p.GetOptionQuote("SPY", 500, asOf.AddDate(0, 0, 14), "call", asOf); err == nil {
+		t.Fatalf("expected the live snapshot to refuse a historical quote")
+	}
+
+	// historical quotes come from the secondary, like every other method
+	synth := NewSyntheticProvider()
+	p = &polygonDataProvider{apiKey: "test", client: http.DefaultClient, secondary: synth}
+	got, err := p.GetOptionQuote("SPY", 100, asOf.AddDate(0, 0, 14), "call", asOf)
+	want, _ := synth.GetOptionQuote("SPY", 100, asOf.AddDate(0, 0, 14), "call", asOf)
+	if err != nil || got != want {
+		t.Fatalf("expected the secondary's quote %+v, got %+v (%v)", want, got, err)
+	}
+}
@@ -1,18 +1,248 @@
 package data
 
 import (
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+const (
+	ModelGBM    = "gbm"    // geometric Brownian motion
+	ModelHeston = "heston" // Heston stochastic volatility
+	ModelMerton = "merton" // GBM with Merton log-normal jumps
+)
+
+const (
+	synthTradingDays = 252                // trading days per year of the path
+	synthSessionMins = 390                // minutes of the 09:30-16:00 session
+	synthChainWidth  = 20                 // strikes listed each side of spot
+	synthListingDays = 365                // days past toDate expiries are listed for
+	synthTZ          = "America/New_York" // session timezone of intraday bars
 )
 
+// SyntheticSpec configures the synthetic scenario generator.
+//
+// Each symbol gets its own daily path from Origin, drawn from Seed and the
+// symbol, so the same spec always produces the same bars. A day opens with
+// a gap made of jumps and shocks and diffuses to the close under Model;
+// intraday bars are a Brownian bridge between the two that also sets the
+// daily high and low.
+//
+// Options are priced with Black-Scholes on a surface implied by the model:
+// the expected variance to expiry (mean-reverting for Heston, the current
+// volatility otherwise) plus the jump variance, tilted by Skew. Example, a
+// crash in a high-vol regime:
+//
+//	{"model": "heston", "seed": 7, "vol": 0.18,
+//	 "regimes": [{"name": "calm", "vol": 0.12, "mean_days": 120},
+//	             {"name": "stress", "drift": -0.2, "vol": 0.45, "mean_days": 15}],
+//	 "shocks": [{"date": "2022-03-07T00:00:00Z", "return_pct": -12, "vol_multiplier": 2.5}]}
+type SyntheticSpec struct {
+	Model         string    `json:"model,omitempty"`          // "gbm", "heston" or "merton", default: "gbm"
+	Seed          int64     `json:"seed,omitempty"`           // path seed, default: 1
+	Origin        time.Time `json:"origin,omitempty"`         // first day of every path, default: 2000-01-03
+	StartPrice    float64   `json:"start_price,omitempty"`    // price at Origin, default: 100
+	Drift         float64   `json:"drift,omitempty"`          // annual drift
+	Vol           float64   `json:"vol,omitempty"`            // annual volatility, Heston's initial volatility, default: 0.2
+	Kappa         float64   `json:"kappa,omitempty"`          // Heston mean reversion speed, default: 2
+	Theta         float64   `json:"theta,omitempty"`          // Heston long-run variance, default: Vol²
+	VolOfVol      float64   `json:"vol_of_vol,omitempty"`     // Heston volatility of variance, default: 0.5
+	Rho           float64   `json:"rho,omitempty"`            // Heston spot/variance correlation, default: -0.7
+	JumpIntensity float64   `json:"jump_intensity,omitempty"` // expected jumps per year, any model, required for "merton"
+	JumpMean      float64   `json:"jump_mean,omitempty"`      // mean log jump size, e.g. -0.05
+	JumpStd       float64   `json:"jump_std,omitempty"`       // standard deviation of the log jump size
+	Regimes       []Regime  `json:"regimes,omitempty"`        // market regimes, the path starts in the first
+	Shocks        []Shock   `json:"shocks,omitempty"`         // scheduled gaps and vol spikes
+	RiskFree      float64   `json:"risk_free,omitempty"`      // option pricing rate, default: 0.02
+	Skew          float64   `json:"skew,omitempty"`           // implied vol change per unit of ln(K/S), e.g. -0.1
+	SpreadPct     float64   `json:"spread_pct,omitempty"`     // quoted bid/ask spread in percent of the price, default: 2
+}
+
+// Regime replaces the spec's drift, volatility and jumps while the path is
+// in it. Each day the path leaves a regime with probability 1/MeanDays for
+// one of the others, chosen at random. Under Heston the regime's Vol sets
+// the long-run variance the path reverts to.
+type Regime struct {
+	Name          string  `json:"name,omitempty"`
+	Drift         float64 `json:"drift"`                    // annual drift
+	Vol           float64 `json:"vol,omitempty"`            // annual volatility, default: the spec's Vol
+	JumpIntensity float64 `json:"jump_intensity,omitempty"` // expected jumps per year
+	JumpMean      float64 `json:"jump_mean,omitempty"`      // mean log jump size
+	JumpStd       float64 `json:"jump_std,omitempty"`       // standard deviation of the log jump size
+	MeanDays      float64 `json:"mean_days,omitempty"`      // expected trading days in the regime, default: 63
+}
+
+// Shock is a scheduled event: the open of Date, or of the next weekday if
+// Date falls on a weekend, gaps by ReturnPct and volatility is multiplied by
+// VolMultiplier, decaying back with a half-life of HalfLifeDays. Under
+// Heston the variance is scaled instead and reverts at the model's own
+// speed.
+type Shock struct {
+	Date          time.Time `json:"date"`                     // trading day of the shock
+	ReturnPct     float64   `json:"return_pct,omitempty"`     // opening gap in percent, e.g. -20
+	VolMultiplier float64   `json:"vol_multiplier,omitempty"` // volatility multiplier on the day, default: 1
+	HalfLifeDays  float64   `json:"half_life_days,omitempty"` // trading days for half the vol spike to decay, default: 10
+}
+
+// LoadSyntheticSpec reads a scenario spec from a JSON file.
+func LoadSyntheticSpec(path string) (*SyntheticSpec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario: %w", err)
+	}
+	var s SyntheticSpec
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("decode scenario %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// withDefaults returns s with unset fields given their defaults.
+func (s SyntheticSpec) withDefaults() SyntheticSpec {
+	s.Model = strings.ToLower(s.Model)
+	if s.Model == "" {
+		s.Model = ModelGBM
+	}
+	if s.Seed == 0 {
+		s.Seed = 1
+	}
+	if s.Origin.IsZero() {
+		s.Origin = time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+	}
+	s.Origin = tradingDay(s.Origin)
+	if s.StartPrice <= 0 {
+		s.StartPrice = 100
+	}
+	if s.Vol <= 0 {
+		s.Vol = 0.2
+	}
+	if s.Kappa <= 0 {
+		s.Kappa = 2
+	}
+	if s.Theta <= 0 {
+		s.Theta = s.Vol * s.Vol
+	}
+	if s.VolOfVol <= 0 {
+		s.VolOfVol = 0.5
+	}
+	if s.Rho == 0 {
+		s.Rho = -0.7
+	}
+	if s.RiskFree == 0 {
+		s.RiskFree = 0.02
+	}
+	if s.SpreadPct <= 0 {
+		s.SpreadPct = 2
+	}
+	s.Regimes = append([]Regime{}, s.Regimes...)
+	for i := range s.Regimes {
+		if s.Regimes[i].Vol <= 0 {
+			s.Regimes[i].Vol = s.Vol
+		}
+		if s.Regimes[i].MeanDays <= 0 {
+			s.Regimes[i].MeanDays = 63
+		}
+	}
+	s.Shocks = append([]Shock{}, s.Shocks...)
+	for i := range s.Shocks {
+		s.Shocks[i].Date = tradingDay(s.Shocks[i].Date)
+		if s.Shocks[i].VolMultiplier <= 0 {
+			s.Shocks[i].VolMultiplier = 1
+		}
+		if s.Shocks[i].HalfLifeDays <= 0 {
+			s.Shocks[i].HalfLifeDays = 10
+		}
+	}
+	return s
+}
+
+func (s SyntheticSpec) validate() error {
+	switch s.Model {
+	case ModelGBM, ModelHeston:
+	case ModelMerton:
+		if s.JumpIntensity <= 0 && len(s.Regimes) == 0 {
+			return fmt.Errorf("merton model needs jump_intensity")
+		}
+	default:
+		return fmt.Errorf("unknown model %q", s.Model)
+	}
+	if s.Rho < -1 || s.Rho > 1 {
+		return fmt.Errorf("rho must be within -1..1")
+	}
+	if s.JumpIntensity < 0 || s.JumpStd < 0 {
+		return fmt.Errorf("jump_intensity and jump_std must not be negative")
+	}
+	for _, r := range s.Regimes {
+		if r.JumpIntensity < 0 || r.JumpStd < 0 {
+			return fmt.Errorf("regime %s: jump_intensity and jump_std must not be negative", r.Name)
+		}
+	}
+	for _, sh := range s.Shocks {
+		if sh.ReturnPct <= -100 {
+			return fmt.Errorf("shock on %s: return_pct must be above -100", sh.Date.Format("2006-01-02"))
+		}
+	}
+	return nil
+}
+
+// synthDay is one trading day of a synthetic path.
+type synthDay struct {
+	date                   time.Time // UTC midnight
+	open, high, low, close float64
+	vol                    float64 // diffusion volatility over the session
+	variance               float64 // instantaneous variance at the close, Heston's v
+	jumpVar                float64 // annual jump variance of the day's regime
+	volume                 float64
+	seed                   int64 // seed of the intraday bridge
+}
+
+// synthPath is the lazily extended daily path of one symbol.
+type synthPath struct {
+	rng    *rand.Rand
+	days   []synthDay
+	v      float64 // Heston variance
+	regime int
+}
+
 // synthDataProvider implements Data Provider generating synthetic data.
 type synthDataProvider struct {
 	secondary Provider
+	spec      SyntheticSpec
+	loc       *time.Location
+
+	mu    sync.Mutex
+	paths map[string]*synthPath
+}
+
+// NewSyntheticProvider returns a synthetic provider with the default
+// scenario: a GBM path from 100 at 20% volatility, seed 1.
+func NewSyntheticProvider() Provider {
+	p, _ := NewScenarioProvider(SyntheticSpec{})
+	return p
 }
 
-func NewSyntheticProvider() Provider { return &synthDataProvider{} }
+// NewScenarioProvider returns a synthetic provider generating the scenario
+// of spec.
+func NewScenarioProvider(spec SyntheticSpec) (Provider, error) {
+	spec = spec.withDefaults()
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	loc, err := time.LoadLocation(synthTZ)
+	if err != nil {
+		loc = time.UTC
+	}
+	return &synthDataProvider{spec: spec, loc: loc, paths: make(map[string]*synthPath)}, nil
+}
 
 func (synthDataProv *synthDataProvider) Secondary() Provider {
 	return synthDataProv.secondary
@@ -22,55 +252,169 @@ func (synthDataProv *synthDataProvider) GetATMOptionPrices(underlying string, ex
 	if synthDataProv.secondary != nil {
 		return synthDataProv.secondary.GetATMOptionPrices(underlying, expiryDate, openDate, asOfPrice)
 	}
-	strike = math.Round(asOfPrice*100) / 100
-	callPrice = 1.0 + math.Abs(rand.NormFloat64()*0.5)
-	putPrice = 1.0 + math.Abs(rand.NormFloat64()*0.5)
+	strike = synthDataProv.RoundToNearestStrike(underlying, expiryDate, openDate, asOfPrice)
+	if callPrice, err = synthDataProv.GetOptionPrice(underlying, strike, expiryDate, "call", openDate); err != nil {
+		return 0, 0, 0, err
+	}
+	if putPrice, err = synthDataProv.GetOptionPrice(underlying, strike, expiryDate, "put", openDate); err != nil {
+		return 0, 0, 0, err
+	}
 	return strike, callPrice, putPrice, nil
 }
 
+// GetContracts lists calls and puts expiring on the scenario's Fridays in
+// fromDate..toDate, or on expiryDate if set, at synthChainWidth strikes each
+// side of the spot at fromDate, or at strike if set.
 func (synthDataProv *synthDataProvider) GetContracts(underlying string, strike float64, expiryDate, fromDate, toDate time.Time) ([]OptionContract, error) {
 	if synthDataProv.secondary != nil {
 		return synthDataProv.secondary.GetContracts(underlying, strike, expiryDate, fromDate, toDate)
 	}
-	return nil, fmt.Errorf("GetContracts not implemented for SyntheticProvider")
+	expiries := []time.Time{synthDate(expiryDate)}
+	if expiryDate.IsZero() {
+		expiries = fridays(fromDate, toDate)
+	}
+	strikes := []float64{strike}
+	if strike <= 0 {
+		day, err := synthDataProv.dayAt(underlying, fromDate)
+		if err != nil {
+			return nil, err
+		}
+		strikes = synthDataProv.chain(underlying, day.close)
+	}
+
+	p := Products.Get(underlying)
+	var out []OptionContract
+	for _, exp := range expiries {
+		for _, k := range strikes {
+			for _, typ := range []string{"call", "put"} {
+				out = append(out, OptionContract{
+					ExpiryDate:        exp,
+					Strike:            k,
+					Type:              typ,
+					SharesPerContract: int(p.Multiplier),
+					ExerciseStyle:     p.ExerciseStyle,
+				})
+			}
+		}
+	}
+	return out, nil
 }
 
+// GetBars returns the scenario's bars of underlying in fromDate..toDate,
+// aggregated by timespan units of "minute", "hour" or "day". Intraday bars
+// cover the 09:30-16:00 New York session.
 func (synthDataProv *synthDataProvider) GetBars(underlying string, fromDate, toDate time.Time, timespan int, multiplier string) ([]Bar, error) {
-	//TODO: support timespan and multiplier
-	cur := fromDate
-	price := 100.0 + float64(rand.Intn(200))
+	if timespan <= 0 {
+		timespan = 1
+	}
+	days, err := synthDataProv.days(underlying, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(multiplier) {
+	case "day":
+		var out []Bar
+		for i := 0; i < len(days); i += timespan {
+			group := days[i:min(i+timespan, len(days))]
+			b := Bar{Date: group[0].date, Open: group[0].open, High: group[0].high, Low: group[0].low}
+			for _, d := range group {
+				b.High = math.Max(b.High, d.high)
+				b.Low = math.Min(b.Low, d.low)
+				b.Close = d.close
+				b.Vol += d.volume
+			}
+			out = append(out, b)
+		}
+		return out, nil
+	case "hour":
+		timespan *= 60
+	case "minute":
+	default:
+		return nil, fmt.Errorf("unsupported bar unit %q for SyntheticProvider", multiplier)
+	}
+
 	var out []Bar
-	for !cur.After(toDate) {
-		if cur.Weekday() != time.Saturday && cur.Weekday() != time.Sunday {
-			delta := rand.NormFloat64() * 0.01 * price
-			open := price
-			close := price + delta
-			high := math.Max(open, close) + math.Abs(rand.NormFloat64()*0.3)
-			low := math.Min(open, close) - math.Abs(rand.NormFloat64()*0.3)
-			out = append(out, Bar{Date: cur, Open: open, High: high, Low: low, Close: close, Vol: float64(1000 + rand.Intn(5000))})
-			price = close
-		}
-		cur = cur.AddDate(0, 0, 1)
+	for _, d := range days {
+		mins := synthDataProv.session(d)
+		open := time.Date(d.date.Year(), d.date.Month(), d.date.Day(), 9, 30, 0, 0, synthDataProv.loc)
+		for j := 0; j < synthSessionMins; j += timespan {
+			end := min(j+timespan, synthSessionMins)
+			b := Bar{Date: open.Add(time.Duration(j) * time.Minute).UTC(), Open: mins[j], High: mins[j], Low: mins[j], Close: mins[end]}
+			for _, px := range mins[j : end+1] {
+				b.High = math.Max(b.High, px)
+				b.Low = math.Min(b.Low, px)
+			}
+			b.Vol = d.volume * float64(end-j) / synthSessionMins
+			out = append(out, b)
+		}
 	}
 	return out, nil
 }
 
+// GetOptionPrice prices an option on the scenario's surface at openDate. A
+// date without a time of day is priced at that day's close.
 func (synthDataProv *synthDataProvider) GetOptionPrice(underlying string, strike float64, expiryDate time.Time, optionType string, openDate time.Time) (float64, error) {
 	if synthDataProv.secondary != nil {
 		return synthDataProv.secondary.GetOptionPrice(underlying, strike, expiryDate, optionType, openDate)
 	}
-	return 0, fmt.Errorf("no option market data in synthetic provider")
+	day, spot, at, err := synthDataProv.asOf(underlying, openDate)
+	if err != nil {
+		return 0, err
+	}
+	call := strings.EqualFold(optionType, "call")
+	t := synthDataProv.sessionTime(expiryDate, synthSessionMins).Sub(at).Hours() / (24 * 365)
+	if t <= 0 {
+		if call {
+			return math.Max(0, spot-strike), nil
+		}
+		return math.Max(0, strike-spot), nil
+	}
+	iv := synthDataProv.impliedVol(day, spot, strike, t)
+	return pricing.BlackScholesPrice(spot, strike, t, synthDataProv.spec.RiskFree, iv, call), nil
+}
+
+// GetOptionQuote quotes the surface price with a spread of SpreadPct around
+// it, at least one tick wide.
+func (synthDataProv *synthDataProvider) GetOptionQuote(underlying string, strike float64, expiryDate time.Time, optionType string, asOfDate time.Time) (OptionQuote, error) {
+	if synthDataProv.secondary != nil {
+		return synthDataProv.secondary.GetOptionQuote(underlying, strike, expiryDate, optionType, asOfDate)
+	}
+	mid, err := synthDataProv.GetOptionPrice(underlying, strike, expiryDate, optionType, asOfDate)
+	if err != nil {
+		return OptionQuote{}, err
+	}
+	half := math.Max(mid*synthDataProv.spec.SpreadPct/200.0, Products.Get(underlying).TickSize/2)
+	return OptionQuote{Bid: math.Max(0, mid-half), Ask: mid + half, Last: mid}, nil
 }
 
+// GetRelevantExpiries returns the Fridays from fromDate to synthListingDays
+// past toDate, so that positions opened late in the range find the
+// expiries a listed chain would have.
 func (synthDataProv *synthDataProvider) GetRelevantExpiries(ticker string, fromDate, toDate time.Time) ([]time.Time, error) {
 	if synthDataProv.secondary != nil {
 		return synthDataProv.secondary.GetRelevantExpiries(ticker, fromDate, toDate)
 	}
-	return nil, fmt.Errorf("GetRelevantExpiries not implemented for SyntheticProvider")
+	return fridays(fromDate, toDate.AddDate(0, 0, synthListingDays)), nil
+}
+
+// GetDividends returns no dividends: synthetic paths model total returns and
+// their option surface is priced without a dividend term.
+func (synthDataProv *synthDataProvider) GetDividends(underlying string, fromDate, toDate time.Time) ([]Dividend, error) {
+	if synthDataProv.secondary != nil {
+		return synthDataProv.secondary.GetDividends(underlying, fromDate, toDate)
+	}
+	return nil, nil
 }
 
 func (synthDataProv *synthDataProvider) RoundToNearestStrike(underlying string, expiryDate, openDate time.Time, asOfPrice float64) float64 {
-	intervals := synthDataProv.getIntervals(underlying)
+	intervals := Products.StrikeInterval(underlying, asOfPrice)
+	if intervals == 0 {
+		intervals = synthDataProv.getIntervals(underlying)
+	}
+	if intervals == 0 {
+		intervals = synthInterval(asOfPrice)
+	}
 	return math.Round(asOfPrice/intervals) * intervals
 }
 
@@ -80,3 +424,292 @@ func (synthDataProv *synthDataProvider) getIntervals(underlying string) float64
 	}
 	return 0 // default
 }
+
+// synthInterval is the strike spacing of an underlying price without a
+// registered product.
+func synthInterval(price float64) float64 {
+	switch {
+	case price < 25:
+		return 0.5
+	case price < 200:
+		return 1
+	default:
+		return 5
+	}
+}
+
+// chain returns the strikes listed around spot.
+func (synthDataProv *synthDataProvider) chain(underlying string, spot float64) []float64 {
+	interval := Products.StrikeInterval(underlying, spot)
+	if interval == 0 {
+		interval = synthInterval(spot)
+	}
+	atm := math.Round(spot/interval) * interval
+	var out []float64
+	for i := -synthChainWidth; i <= synthChainWidth; i++ {
+		if k := math.Round((atm+float64(i)*interval)*1e6) / 1e6; k > 0 {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// impliedVol returns the surface volatility of strike at t years from day
+// with the underlying at spot.
+func (synthDataProv *synthDataProvider) impliedVol(day synthDay, spot, strike, t float64) float64 {
+	s := synthDataProv.spec
+	variance := day.variance
+	if s.Model == ModelHeston {
+		theta := s.Theta
+		if len(s.Regimes) > 0 {
+			theta = day.vol * day.vol
+		}
+		kt := s.Kappa * t
+		variance = theta + (day.variance-theta)*(1-math.Exp(-kt))/kt
+	}
+	iv := math.Sqrt(math.Max(variance, 0)+day.jumpVar) + s.Skew*math.Log(strike/spot)
+	return math.Min(math.Max(iv, 0.01), 5)
+}
+
+// asOf returns the day, spot and pricing instant of t. A time at UTC
+// midnight stands for that day's close; other times use the intraday path,
+// the previous close before the session and the close after it.
+func (synthDataProv *synthDataProvider) asOf(underlying string, t time.Time) (synthDay, float64, time.Time, error) {
+	local := t.In(synthDataProv.loc)
+	if t.Equal(synthDate(t)) {
+		local = time.Date(t.Year(), t.Month(), t.Day(), 16, 0, 0, 0, synthDataProv.loc)
+	}
+	day, err := synthDataProv.dayAt(underlying, time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return synthDay{}, 0, time.Time{}, err
+	}
+	if !day.date.Equal(synthDate(local)) {
+		return day, day.close, local, nil
+	}
+	m := int(local.Sub(synthDataProv.sessionTime(day.date, 0)).Minutes())
+	switch {
+	case m < 0:
+		prev, err := synthDataProv.dayAt(underlying, day.date.AddDate(0, 0, -1))
+		if err != nil {
+			return day, day.open, local, nil
+		}
+		return prev, prev.close, local, nil
+	case m >= synthSessionMins:
+		return day, day.close, local, nil
+	}
+	return day, synthDataProv.session(day)[m], local, nil
+}
+
+// sessionTime returns the instant m minutes into the session of date.
+func (synthDataProv *synthDataProvider) sessionTime(date time.Time, m int) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 9, 30+m, 0, 0, synthDataProv.loc)
+}
+
+// dayAt returns the last trading day of the path on or before date.
+func (synthDataProv *synthDataProvider) dayAt(underlying string, date time.Time) (synthDay, error) {
+	days, err := synthDataProv.days(underlying, date.AddDate(0, 0, -7), date)
+	if err != nil {
+		return synthDay{}, err
+	}
+	if len(days) == 0 {
+		return synthDay{}, fmt.Errorf("no synthetic %s data on or before %s", underlying, date.Format("2006-01-02"))
+	}
+	return days[len(days)-1], nil
+}
+
+// days returns the path of underlying in fromDate..toDate, extending it as
+// needed.
+func (synthDataProv *synthDataProvider) days(underlying string, fromDate, toDate time.Time) ([]synthDay, error) {
+	s := synthDataProv.spec
+	from, to := synthDate(fromDate), synthDate(toDate)
+	if to.Before(s.Origin) {
+		return nil, fmt.Errorf("%s is before the scenario origin %s", to.Format("2006-01-02"), s.Origin.Format("2006-01-02"))
+	}
+	if from.Before(s.Origin) {
+		from = s.Origin
+	}
+
+	synthDataProv.mu.Lock()
+	defer synthDataProv.mu.Unlock()
+	key := strings.ToUpper(underlying)
+	p, ok := synthDataProv.paths[key]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		p = &synthPath{rng: rand.New(rand.NewSource(s.Seed ^ int64(h.Sum64()))), v: s.Vol * s.Vol}
+		synthDataProv.paths[key] = p
+	}
+	for len(p.days) == 0 || p.days[len(p.days)-1].date.Before(to) {
+		synthDataProv.extend(p)
+	}
+
+	lo := sort.Search(len(p.days), func(i int) bool { return !p.days[i].date.Before(from) })
+	hi := sort.Search(len(p.days), func(i int) bool { return p.days[i].date.After(to) })
+	if lo >= hi {
+		return nil, nil
+	}
+	return append([]synthDay{}, p.days[lo:hi]...), nil
+}
+
+// extend appends the next trading day to a path.
+func (synthDataProv *synthDataProvider) extend(p *synthPath) {
+	s := synthDataProv.spec
+	rng := p.rng
+	dt := 1.0 / synthTradingDays
+
+	date, prev := s.Origin, s.StartPrice
+	if n := len(p.days); n > 0 {
+		date, prev = nextWeekday(p.days[n-1].date), p.days[n-1].close
+		if len(s.Regimes) > 1 && rng.Float64() < 1/s.Regimes[p.regime].MeanDays {
+			p.regime = (p.regime + 1 + rng.Intn(len(s.Regimes)-1)) % len(s.Regimes)
+		}
+	}
+
+	drift, vol := s.Drift, s.Vol
+	lambda, jumpMean, jumpStd := s.JumpIntensity, s.JumpMean, s.JumpStd
+	theta := s.Theta
+	if len(s.Regimes) > 0 {
+		r := s.Regimes[p.regime]
+		drift, vol = r.Drift, r.Vol
+		lambda, jumpMean, jumpStd = r.JumpIntensity, r.JumpMean, r.JumpStd
+		theta = vol * vol
+	}
+
+	// the open gaps by the day's jumps and shocks
+	gap := 0.0
+	for n := poisson(rng, lambda*dt); n > 0; n-- {
+		gap += jumpMean + jumpStd*rng.NormFloat64()
+	}
+	mult := 1.0
+	for _, sh := range s.Shocks {
+		if sh.Date.Equal(date) {
+			gap += math.Log1p(sh.ReturnPct / 100.0)
+			if s.Model == ModelHeston {
+				p.v *= sh.VolMultiplier * sh.VolMultiplier
+			}
+		}
+		if s.Model != ModelHeston && !date.Before(sh.Date) {
+			elapsed := float64(weekdaysBetween(sh.Date, date))
+			mult *= 1 + (sh.VolMultiplier-1)*math.Pow(0.5, elapsed/sh.HalfLifeDays)
+		}
+	}
+	open := prev * math.Exp(gap)
+
+	// the session diffuses from the open to the close
+	compensator := lambda * (math.Exp(jumpMean+jumpStd*jumpStd/2) - 1)
+	z := rng.NormFloat64()
+	var ret, sigma, variance float64
+	if s.Model == ModelHeston {
+		v := math.Max(p.v, 0)
+		sigma = math.Sqrt(v)
+		ret = (drift-compensator-v/2)*dt + sigma*math.Sqrt(dt)*z
+		zv := s.Rho*z + math.Sqrt(1-s.Rho*s.Rho)*rng.NormFloat64()
+		p.v += s.Kappa*(theta-v)*dt + s.VolOfVol*math.Sqrt(v*dt)*zv
+		variance = math.Max(p.v, 0)
+	} else {
+		sigma = vol * mult
+		ret = (drift-compensator-sigma*sigma/2)*dt + sigma*math.Sqrt(dt)*z
+		variance = sigma * sigma
+	}
+
+	d := synthDay{
+		date:     date,
+		open:     open,
+		close:    open * math.Exp(ret),
+		vol:      sigma,
+		variance: variance,
+		jumpVar:  lambda * (jumpMean*jumpMean + jumpStd*jumpStd),
+		seed:     rng.Int63(),
+	}
+	if s.Model == ModelHeston && len(s.Regimes) > 0 {
+		d.vol = vol // the regime's long-run volatility, for the surface
+	}
+	move := math.Abs(gap+ret) / math.Max(sigma*math.Sqrt(dt), 1e-9)
+	d.volume = math.Round(1e6 * math.Exp(0.25*rng.NormFloat64()) * (1 + move))
+	d.high, d.low = d.open, d.open
+	for _, px := range synthDataProv.session(d) {
+		d.high = math.Max(d.high, px)
+		d.low = math.Min(d.low, px)
+	}
+	p.days = append(p.days, d)
+}
+
+// session returns the synthSessionMins+1 minute prices of a day, a Brownian
+// bridge from its open to its close drawn from the day's seed.
+func (synthDataProv *synthDataProvider) session(d synthDay) []float64 {
+	rng := rand.New(rand.NewSource(d.seed))
+	step := math.Max(d.vol, 0.01) * math.Sqrt(1.0/synthTradingDays/synthSessionMins)
+	w := make([]float64, synthSessionMins+1)
+	for j := 1; j <= synthSessionMins; j++ {
+		w[j] = w[j-1] + step*rng.NormFloat64()
+	}
+	lo, lc := math.Log(d.open), math.Log(d.close)
+	out := make([]float64, synthSessionMins+1)
+	for j := range w {
+		f := float64(j) / synthSessionMins
+		out[j] = math.Exp(lo + w[j] - f*(w[synthSessionMins]-(lc-lo)))
+	}
+	out[0], out[synthSessionMins] = d.open, d.close
+	return out
+}
+
+// poisson draws from a Poisson distribution with mean l.
+func poisson(rng *rand.Rand, l float64) int {
+	if l <= 0 {
+		return 0
+	}
+	limit, prod, n := math.Exp(-l), rng.Float64(), 0
+	for prod > limit {
+		prod *= rng.Float64()
+		n++
+	}
+	return n
+}
+
+// fridays returns the Fridays in from..to.
+func fridays(from, to time.Time) []time.Time {
+	d := synthDate(from)
+	d = d.AddDate(0, 0, (int(time.Friday)-int(d.Weekday())+7)%7)
+	var out []time.Time
+	for end := synthDate(to); !d.After(end); d = d.AddDate(0, 0, 7) {
+		out = append(out, d)
+	}
+	return out
+}
+
+// nextWeekday returns the weekday after d.
+func nextWeekday(d time.Time) time.Time {
+	d = d.AddDate(0, 0, 1)
+	for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// tradingDay returns the date of t, moved to the next weekday if it falls
+// on a weekend.
+func tradingDay(t time.Time) time.Time {
+	d := synthDate(t)
+	if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		d = nextWeekday(d)
+	}
+	return d
+}
+
+// weekdaysBetween counts the weekdays after from up to and including to.
+func weekdaysBetween(from, to time.Time) int {
+	days := int(math.Round(to.Sub(from).Hours() / 24))
+	n := days / 7 * 5
+	for d, i := from.AddDate(0, 0, days/7*7), 0; i < days%7; i++ {
+		d = d.AddDate(0, 0, 1)
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			n++
+		}
+	}
+	return n
+}
+
+// synthDate returns the calendar date of t as UTC midnight.
+func synthDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
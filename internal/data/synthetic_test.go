@@ -0,0 +1,150 @@
+package data
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/contactkeval/option-replay/internal/pricing"
+)
+
+func TestSyntheticReproducible(t *testing.T) {
+	spec := SyntheticSpec{Model: ModelHeston, Seed: 42, JumpIntensity: 3, JumpMean: -0.04, JumpStd: 0.03}
+	from := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 6, 0)
+
+	a, _ := NewScenarioProvider(spec)
+	b, _ := NewScenarioProvider(spec)
+	// extending b's path in another order must not change it
+	if _, err := b.GetBars("SPY", to, to, 1, "day"); err != nil {
+		t.Fatalf("GetBars: %v", err)
+	}
+	x, _ := a.GetBars("SPY", from, to, 1, "day")
+	y, _ := b.GetBars("SPY", from, to, 1, "day")
+	if len(x) == 0 || len(x) != len(y) {
+		t.Fatalf("expected equal non-empty paths, got %d and %d bars", len(x), len(y))
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			t.Fatalf("bar %d differs: %+v vs %+v", i, x[i], y[i])
+		}
+		if x[i].Low > math.Min(x[i].Open, x[i].Close) || x[i].High < math.Max(x[i].Open, x[i].Close) {
+			t.Fatalf("bar %d high/low do not contain open/close: %+v", i, x[i])
+		}
+	}
+
+	spec.Seed = 43
+	c, _ := NewScenarioProvider(spec)
+	z, _ := c.GetBars("SPY", from, to, 1, "day")
+	if z[len(z)-1].Close == x[len(x)-1].Close {
+		t.Fatalf("expected another seed to give another path")
+	}
+	q, _ := a.GetBars("QQQ", from, to, 1, "day")
+	if q[len(q)-1].Close == x[len(x)-1].Close {
+		t.Fatalf("expected another symbol to give another path")
+	}
+}
+
+func TestSyntheticIntradayMatchesDaily(t *testing.T) {
+	prov := NewSyntheticProvider()
+	day := time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)
+	daily, _ := prov.GetBars("SPY", day, day, 1, "day")
+	mins, err := prov.GetBars("SPY", day, day, 30, "minute")
+	if err != nil || len(daily) != 1 || len(mins) != 13 {
+		t.Fatalf("expected 1 daily and 13 half-hour bars, got %d and %d (%v)", len(daily), len(mins), err)
+	}
+	d := daily[0]
+	hi, lo := 0.0, math.Inf(1)
+	for _, b := range mins {
+		hi, lo = math.Max(hi, b.High), math.Min(lo, b.Low)
+	}
+	if mins[0].Open != d.Open || mins[len(mins)-1].Close != d.Close || hi != d.High || lo != d.Low {
+		t.Fatalf("intraday bars disagree with the daily bar %+v: open %.4f close %.4f high %.4f low %.4f",
+			d, mins[0].Open, mins[len(mins)-1].Close, hi, lo)
+	}
+	if want := time.Date(2024, 5, 15, 13, 30, 0, 0, time.UTC); !mins[0].Date.Equal(want) {
+		t.Fatalf("expected the session to open at %s, got %s", want, mins[0].Date)
+	}
+}
+
+func TestSyntheticShock(t *testing.T) {
+	shock := time.Date(2020, 2, 24, 0, 0, 0, 0, time.UTC)
+	prov, err := NewScenarioProvider(SyntheticSpec{
+		Shocks: []Shock{{Date: shock, ReturnPct: -20, VolMultiplier: 3, HalfLifeDays: 5}},
+	})
+	if err != nil {
+		t.Fatalf("NewScenarioProvider: %v", err)
+	}
+	bars, _ := prov.GetBars("SPY", shock.AddDate(0, 0, -3), shock, 1, "day")
+	prev, b := bars[len(bars)-2], bars[len(bars)-1]
+	if gap := b.Open/prev.Close - 1; math.Abs(gap+0.20) > 1e-9 {
+		t.Fatalf("expected a -20%% opening gap, got %.4f", gap)
+	}
+
+	expiry := shock.AddDate(0, 1, 0)
+	_, before, _, _ := prov.GetATMOptionPrices("SPY", expiry, prev.Date, prev.Close)
+	_, after, _, _ := prov.GetATMOptionPrices("SPY", expiry, b.Date, b.Close)
+	if after/b.Close < 2*before/prev.Close {
+		t.Fatalf("expected the vol spike to lift ATM call prices, got %.4f before and %.4f after", before, after)
+	}
+}
+
+func TestSyntheticOptionSurface(t *testing.T) {
+	prov, _ := NewScenarioProvider(SyntheticSpec{Vol: 0.25, RiskFree: 0.03})
+	day := time.Date(2023, 6, 14, 0, 0, 0, 0, time.UTC)
+	expiry := time.Date(2023, 7, 21, 0, 0, 0, 0, time.UTC)
+	bars, _ := prov.GetBars("SPY", day, day, 1, "day")
+	spot := bars[0].Close
+
+	strike, call, put, err := prov.GetATMOptionPrices("SPY", expiry, day, spot)
+	if err != nil {
+		t.Fatalf("GetATMOptionPrices: %v", err)
+	}
+	tte := expiry.Sub(day).Hours() / (24 * 365) // both priced at the 16:00 close
+	iv, err := pricing.ImpliedVol(call, spot, strike, tte, 0.03, true)
+	if err != nil || math.Abs(iv-0.25) > 0.005 {
+		t.Fatalf("expected the GBM surface to imply the path vol 0.25, got %.4f", iv)
+	}
+	if parity := call - put - (spot - strike*math.Exp(-0.03*tte)); math.Abs(parity) > 1e-6 {
+		t.Fatalf("put-call parity off by %.6f", parity)
+	}
+
+	q, _ := prov.GetOptionQuote("SPY", strike, expiry, "call", day)
+	if math.Abs(q.Mid()-call) > 1e-9 || q.Spread() <= 0 {
+		t.Fatalf("expected a quote around %.4f, got %+v", call, q)
+	}
+	if v, _ := prov.GetOptionPrice("SPY", strike-10, expiry, "put", expiry); v != math.Max(0, strike-10-closeOn(t, prov, expiry)) {
+		t.Fatalf("expected intrinsic value at expiry, got %.4f", v)
+	}
+
+	exps, _ := prov.GetRelevantExpiries("SPY", day, day.AddDate(0, 0, 30))
+	if len(exps) < 50 || exps[0].Weekday() != time.Friday {
+		t.Fatalf("expected Fridays listed a year past the range, got %d starting %s", len(exps), exps[0])
+	}
+	cs, _ := prov.GetContracts("SPY", 0, expiry, day, day)
+	if len(cs) != 2*(2*synthChainWidth+1) {
+		t.Fatalf("expected %d contracts, got %d", 2*(2*synthChainWidth+1), len(cs))
+	}
+}
+
+func closeOn(t *testing.T, prov Provider, day time.Time) float64 {
+	t.Helper()
+	bars, err := prov.GetBars("SPY", day, day, 1, "day")
+	if err != nil || len(bars) != 1 {
+		t.Fatalf("no bar on %s: %v", day.Format("2006-01-02"), err)
+	}
+	return bars[0].Close
+}
+
+func TestSyntheticSpecValidate(t *testing.T) {
+	for _, spec := range []SyntheticSpec{
+		{Model: "bachelier"},
+		{Model: ModelMerton},
+		{Model: ModelHeston, Rho: 1.5},
+		{Shocks: []Shock{{Date: time.Now(), ReturnPct: -100}}},
+	} {
+		if _, err := NewScenarioProvider(spec); err == nil {
+			t.Fatalf("expected %+v to be rejected", spec)
+		}
+	}
+}
@@ -128,6 +128,19 @@ func ImpliedVolATM(
 	return 0, fmt.Errorf("implied vol did not converge")
 }
 
+// ImpliedVol calculates the implied volatility of a single European option from its price.
+// It runs Newton-Raphson from a 30% guess and falls back to bisection on [0.1%, 500%]
+// when vega vanishes or Newton leaves the bracket.
+// Returns the implied volatility or an error if the price is outside the no-arbitrage
+// bounds or the search does not converge.
+func ImpliedVol(
+	price float64, // option price
+	S, K, T, r float64,
+	isCall bool,
+) (float64, error) {
+	return ImpliedVolMerton(price, S, K, T, r, 0, isCall)
+}
+
 func StrikeFromDelta(
 	spot float64, // Spot price (S)
 	delta float64, // Target delta
@@ -0,0 +1,140 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+)
+
+// CashDividend is a discrete cash dividend per share going ex T years after
+// the valuation date.
+type CashDividend struct {
+	T      float64 // time to the ex-date in years
+	Amount float64 // cash amount per share
+}
+
+// PVDividends returns the present value at rate r of the cash dividends going
+// ex after the valuation date and no later than expiry T. Dividends going ex
+// after expiry are not received by the holder of the underlying over the
+// option's life and do not move its forward.
+func PVDividends(r, T float64, divs []CashDividend) float64 {
+	pv := 0.0
+	for _, d := range divs {
+		if d.T > 0 && d.T <= T {
+			pv += d.Amount * math.Exp(-r*d.T)
+		}
+	}
+	return pv
+}
+
+// EscrowedSpot returns the spot less the present value of the cash dividends
+// going ex before expiry T, the risky part of the underlying that the
+// escrowed-dividend model diffuses. It never falls below zero.
+func EscrowedSpot(S, r, T float64, divs []CashDividend) float64 {
+	return math.Max(0, S-PVDividends(r, T, divs))
+}
+
+// ForwardPrice returns the forward of the underlying for expiry T, with a
+// continuous dividend yield q and discrete cash dividends:
+//
+//	F = (S - PV(divs)) * exp((r-q)*T)
+func ForwardPrice(S, r, q, T float64, divs []CashDividend) float64 {
+	return EscrowedSpot(S, r, T, divs) * math.Exp((r-q)*T)
+}
+
+// BlackScholesEscrowedPrice calculates the value of a European option on an
+// underlying paying discrete cash dividends with the escrowed-dividend model:
+// Black-Scholes-Merton on the spot less the present value of the dividends
+// going ex before expiry, with any continuous yield q on top.
+//
+// Parameters:
+//   - S: spot price of the underlying asset
+//   - K: strike price of the option
+//   - T: time to expiry in years
+//   - r: risk-free interest rate (annual)
+//   - q: continuous dividend yield (annual, as a decimal), usually 0
+//   - sigma: volatility of the escrowed underlying (annual, as a decimal)
+//   - divs: cash dividends, in any order
+//   - isCall: true for call option, false for put option
+//
+// Returns:
+//
+//	The theoretical price of the option. If T or sigma is non-positive the
+//	option is valued at its intrinsic payoff on the unadjusted spot.
+func BlackScholesEscrowedPrice(
+	S float64, // spot
+	K float64, // strike
+	T float64, // time to expiry in years
+	r float64, // risk-free rate
+	q float64, // dividend yield
+	sigma float64, // volatility
+	divs []CashDividend, // cash dividends
+	isCall bool, // is call option
+) float64 {
+
+	if T <= 0 || sigma <= 0 {
+		return BlackScholesMertonPrice(S, K, T, r, q, sigma, isCall)
+	}
+	return BlackScholesMertonPrice(EscrowedSpot(S, r, T, divs), K, T, r, q, sigma, isCall)
+}
+
+// ImpliedVolMerton calculates the implied volatility of a single European
+// option from its price under Black-Scholes-Merton with a continuous dividend
+// yield q. Pass an escrowed spot to imply the volatility of an underlying
+// paying cash dividends.
+// It runs Newton-Raphson from a 30% guess and falls back to bisection on
+// [0.1%, 500%] when vega vanishes or Newton leaves the bracket.
+// Returns the implied volatility or an error if the price is outside the
+// no-arbitrage bounds or the search does not converge.
+func ImpliedVolMerton(
+	price float64, // option price
+	S, K, T, r, q float64,
+	isCall bool,
+) (float64, error) {
+
+	if T <= 0 || S <= 0 || K <= 0 {
+		return 0, fmt.Errorf("invalid inputs")
+	}
+
+	const (
+		lo      = 1e-3
+		hi      = 5.0
+		maxIter = 100
+		tol     = 1e-6
+	)
+	value := func(sigma float64) float64 { return BlackScholesMertonPrice(S, K, T, r, q, sigma, isCall) }
+	if price < value(lo)-tol || price > value(hi) {
+		return 0, fmt.Errorf("price %.4f outside model bounds", price)
+	}
+
+	sigma := 0.30
+	for i := 0; i < maxIter; i++ {
+		g := BlackScholesGreeks(S, K, T, r, q, sigma, isCall)
+		diff := g.Price - price
+		if math.Abs(diff) < tol {
+			return sigma, nil
+		}
+		if g.Vega < 1e-8 {
+			break
+		}
+		sigma -= diff / g.Vega
+		if sigma <= lo || sigma >= hi {
+			break
+		}
+	}
+
+	// bisection: the price is increasing in sigma
+	a, b := lo, hi
+	for i := 0; i < maxIter; i++ {
+		mid := (a + b) / 2
+		diff := value(mid) - price
+		if math.Abs(diff) < tol || b-a < tol {
+			return mid, nil
+		}
+		if diff > 0 {
+			b = mid
+		} else {
+			a = mid
+		}
+	}
+	return 0, fmt.Errorf("implied vol did not converge")
+}
@@ -0,0 +1,49 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEscrowedDividends(t *testing.T) {
+	const S, K, T, r, sigma = 180.0, 180.0, 0.25, 0.04, 0.28
+	divs := []CashDividend{{T: 0.1, Amount: 0.25}, {T: 0.35, Amount: 0.25}, {T: -0.01, Amount: 0.25}}
+
+	pv := PVDividends(r, T, divs)
+	if want := 0.25 * math.Exp(-r*0.1); math.Abs(pv-want) > 1e-12 {
+		t.Fatalf("expected only the dividend before expiry to count, got pv %.6f want %.6f", pv, want)
+	}
+
+	call := BlackScholesEscrowedPrice(S, K, T, r, 0, sigma, divs, true)
+	put := BlackScholesEscrowedPrice(S, K, T, r, 0, sigma, divs, false)
+	fwd := ForwardPrice(S, r, 0, T, divs)
+	if parity := call - put - (fwd-K)*math.Exp(-r*T); math.Abs(parity) > 1e-9 {
+		t.Fatalf("put-call parity on the dividend forward off by %.9f", parity)
+	}
+	if plain := BlackScholesPrice(S, K, T, r, sigma, true); call >= plain {
+		t.Fatalf("expected the dividend to cheapen the call, got %.4f vs %.4f", call, plain)
+	}
+	if got := BlackScholesEscrowedPrice(S, 170, 0, r, 0, sigma, divs, false); got != 0 {
+		t.Fatalf("expected an expired OTM put to be worthless, got %.4f", got)
+	}
+
+	// a continuous yield moves the forward like cash dividends of the same value
+	const q = 0.015
+	if got, want := ForwardPrice(S, r, q, T, nil), S*math.Exp((r-q)*T); math.Abs(got-want) > 1e-9 {
+		t.Fatalf("expected forward %.6f, got %.6f", want, got)
+	}
+}
+
+func TestImpliedVolMerton(t *testing.T) {
+	const S, K, T, r, q = 4500.0, 4400.0, 0.5, 0.03, 0.016
+	for _, isCall := range []bool{true, false} {
+		price := BlackScholesMertonPrice(S, K, T, r, q, 0.18, isCall)
+		iv, err := ImpliedVolMerton(price, S, K, T, r, q, isCall)
+		if err != nil || math.Abs(iv-0.18) > 1e-5 {
+			t.Fatalf("call=%v: expected 0.18, got %.6f (%v)", isCall, iv, err)
+		}
+	}
+	if _, err := ImpliedVolMerton(0.01, S, K, T, r, q, true); err == nil {
+		t.Fatalf("expected a price below intrinsic to be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package pricing
+
+import "math"
+
+// Greeks are the Black-Scholes-Merton value and sensitivities of one
+// European option per share, on an underlying paying a continuous dividend
+// yield.
+//
+// Sensitivities are analytic and in model units: per 1.00 of volatility or
+// rate (divide Vega, Rho, Vanna and Volga by 100 for one point) and per year
+// of time passing (divide Theta and Charm by 365 for one calendar day).
+type Greeks struct {
+	Price float64 // option value
+	Delta float64 // dV/dS
+	Gamma float64 // d²V/dS², the same for calls and puts
+	Theta float64 // dV/dt as time passes, per year, usually negative
+	Vega  float64 // dV/dσ
+	Rho   float64 // dV/dr
+	Vanna float64 // d²V/dS dσ, change in Delta per unit of volatility
+	Charm float64 // dΔ/dt as time passes, per year
+	Volga float64 // d²V/dσ², change in Vega per unit of volatility
+	Speed float64 // d³V/dS³, change in Gamma per $1 underlying move
+}
+
+// Option is one contract of a chain priced by PriceChain or ChainGreeks.
+type Option struct {
+	K      float64 // strike
+	T      float64 // time to expiry in years
+	Sigma  float64 // volatility
+	Div    float64 // present value of the cash dividends going ex before expiry, 0 if none
+	IsCall bool
+}
+
+// BlackScholesGreeks calculates the value and greeks of a European option
+// with the Black-Scholes-Merton model.
+//
+// Parameters:
+//   - S: spot price of the underlying asset
+//   - K: strike price of the option
+//   - T: time to expiry in years
+//   - r: risk-free interest rate (annual)
+//   - q: continuous dividend yield (annual, as a decimal)
+//   - sigma: volatility of the underlying asset (annual, as a decimal)
+//   - isCall: true for call option, false for put option
+//
+// Returns:
+//
+//	The option's Greeks. If T or sigma is non-positive the option is valued
+//	at its intrinsic payoff with the delta of that payoff and no other
+//	sensitivities. A non-positive S, e.g. an escrowed spot wiped out by
+//	dividends, gets the limits of the Greeks as S falls to 0.
+func BlackScholesGreeks(
+	S float64, // spot
+	K float64, // strike
+	T float64, // time to expiry in years
+	r float64, // risk-free rate
+	q float64, // dividend yield
+	sigma float64, // volatility
+	isCall bool, // is call option
+) Greeks {
+
+	if T <= 0 || sigma <= 0 {
+		switch {
+		case isCall && S > K:
+			return Greeks{Price: S - K, Delta: 1}
+		case !isCall && S < K:
+			return Greeks{Price: K - S, Delta: -1}
+		}
+		return Greeks{}
+	}
+	if S <= 0 {
+		// the underlying stays worthless: the call is worthless and the put
+		// is a discounted claim on the strike
+		if isCall {
+			return Greeks{}
+		}
+		df, dq := math.Exp(-r*T), math.Exp(-q*T)
+		return Greeks{Price: K * df, Delta: -dq, Theta: r * K * df, Rho: -K * T * df, Charm: -q * dq}
+	}
+
+	sqrtT := math.Sqrt(T)
+	volT := sigma * sqrtT
+	d1 := (math.Log(S/K) + (r-q+0.5*sigma*sigma)*T) / volT
+	d2 := d1 - volT
+	df := math.Exp(-r * T) // discount factor
+	dq := math.Exp(-q * T) // dividend discount factor
+	pdf := normPDF(d1)
+
+	g := Greeks{
+		Gamma: dq * pdf / (S * volT),
+		Vega:  S * dq * pdf * sqrtT,
+		Vanna: -dq * pdf * d2 / sigma,
+	}
+	g.Volga = g.Vega * d1 * d2 / sigma
+	g.Speed = -g.Gamma / S * (d1/volT + 1)
+
+	decay := -S * dq * pdf * sigma / (2 * sqrtT)
+	drift := dq * pdf * (2*(r-q)*T - d2*volT) / (2 * T * volT)
+	if isCall {
+		nd1, nd2 := normCDF(d1), normCDF(d2)
+		g.Price = S*dq*nd1 - K*df*nd2
+		g.Delta = dq * nd1
+		g.Theta = decay - r*K*df*nd2 + q*S*dq*nd1
+		g.Rho = K * T * df * nd2
+		g.Charm = q*dq*nd1 - drift
+		return g
+	}
+	nd1, nd2 := normCDF(-d1), normCDF(-d2)
+	g.Price = K*df*nd2 - S*dq*nd1
+	g.Delta = -dq * nd1
+	g.Theta = decay + r*K*df*nd2 - q*S*dq*nd1
+	g.Rho = -K * T * df * nd2
+	g.Charm = -q*dq*nd1 - drift
+	return g
+}
+
+// BlackScholesMertonPrice calculates the value of a European option on an
+// underlying paying a continuous dividend yield q, or its intrinsic payoff
+// if T or sigma is non-positive.
+func BlackScholesMertonPrice(S, K, T, r, q, sigma float64, isCall bool) float64 {
+	if T <= 0 || sigma <= 0 {
+		if isCall {
+			return math.Max(0, S-K)
+		}
+		return math.Max(0, K-S)
+	}
+	volT := sigma * math.Sqrt(T)
+	d1 := (math.Log(S/K) + (r-q+0.5*sigma*sigma)*T) / volT
+	d2 := d1 - volT
+	if isCall {
+		return S*math.Exp(-q*T)*normCDF(d1) - K*math.Exp(-r*T)*normCDF(d2)
+	}
+	return K*math.Exp(-r*T)*normCDF(-d2) - S*math.Exp(-q*T)*normCDF(-d1)
+}
+
+// PriceChain values every option of a chain at one spot, rate and dividend
+// yield, with each option's cash dividends escrowed out of the spot (never
+// below zero), appending the prices to dst in option order. Pass a reused dst to price a
+// chain on every bar without allocating.
+func PriceChain(dst []float64, S, r, q float64, opts []Option) []float64 {
+	dst = dst[:0]
+	for _, o := range opts {
+		dst = append(dst, BlackScholesMertonPrice(math.Max(0, S-o.Div), o.K, o.T, r, q, o.Sigma, o.IsCall))
+	}
+	return dst
+}
+
+// ChainGreeks calculates the Greeks of every option of a chain at one spot,
+// rate and dividend yield, with each option's cash dividends escrowed out of
+// the spot (never below zero), appending them to dst in option order. Pass a
+// reused dst to evaluate a chain on every bar without allocating.
+func ChainGreeks(dst []Greeks, S, r, q float64, opts []Option) []Greeks {
+	dst = dst[:0]
+	for _, o := range opts {
+		dst = append(dst, BlackScholesGreeks(math.Max(0, S-o.Div), o.K, o.T, r, q, o.Sigma, o.IsCall))
+	}
+	return dst
+}
@@ -0,0 +1,95 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+// TestBlackScholesGreeks checks the analytic greeks against central
+// differences of the price.
+func TestBlackScholesGreeks(t *testing.T) {
+	const (
+		S, K, T, r, q, sigma = 100.0, 105.0, 0.4, 0.03, 0.015, 0.25
+		h                    = 1e-3
+	)
+	for _, isCall := range []bool{true, false} {
+		price := func(s, tt, rr, vol float64) float64 { return BlackScholesMertonPrice(s, K, tt, rr, q, vol, isCall) }
+		delta := func(s, tt, vol float64) float64 { return BlackScholesGreeks(s, K, tt, r, q, vol, isCall).Delta }
+		gamma := func(s float64) float64 { return BlackScholesGreeks(s, K, T, r, q, sigma, isCall).Gamma }
+		g := BlackScholesGreeks(S, K, T, r, q, sigma, isCall)
+
+		checks := []struct {
+			name      string
+			got, want float64
+		}{
+			{"price", g.Price, price(S, T, r, sigma)},
+			{"delta", g.Delta, (price(S+h, T, r, sigma) - price(S-h, T, r, sigma)) / (2 * h)},
+			{"gamma", g.Gamma, (price(S+h, T, r, sigma) - 2*price(S, T, r, sigma) + price(S-h, T, r, sigma)) / (h * h)},
+			{"theta", g.Theta, -(price(S, T+h, r, sigma) - price(S, T-h, r, sigma)) / (2 * h)},
+			{"vega", g.Vega, (price(S, T, r, sigma+h) - price(S, T, r, sigma-h)) / (2 * h)},
+			{"rho", g.Rho, (price(S, T, r+h, sigma) - price(S, T, r-h, sigma)) / (2 * h)},
+			{"vanna", g.Vanna, (delta(S, T, sigma+h) - delta(S, T, sigma-h)) / (2 * h)},
+			{"charm", g.Charm, -(delta(S, T+h, sigma) - delta(S, T-h, sigma)) / (2 * h)},
+			{"volga", g.Volga, (price(S, T, r, sigma+h) - 2*price(S, T, r, sigma) + price(S, T, r, sigma-h)) / (h * h)},
+			{"speed", g.Speed, (gamma(S+h) - gamma(S-h)) / (2 * h)},
+		}
+		for _, c := range checks {
+			if math.Abs(c.got-c.want) > 1e-4*math.Max(1, math.Abs(c.want)) {
+				t.Errorf("call=%v %s: analytic %.8f, numeric %.8f", isCall, c.name, c.got, c.want)
+			}
+		}
+	}
+
+	// without a dividend yield the greeks agree with Black-Scholes
+	g := BlackScholesGreeks(S, K, T, r, 0, sigma, false)
+	if math.Abs(g.Price-BlackScholesPrice(S, K, T, r, sigma, false)) > 1e-9 ||
+		math.Abs(g.Vega-BlackScholesVega(S, K, T, r, sigma)) > 1e-9 {
+		t.Errorf("q=0 greeks disagree with BlackScholesPrice/Vega: %+v", g)
+	}
+	if g := BlackScholesGreeks(90, 100, 0, r, q, sigma, false); g.Price != 10 || g.Delta != -1 || g.Gamma != 0 {
+		t.Errorf("expected the intrinsic payoff of an expired put, got %+v", g)
+	}
+}
+
+func TestChainGreeks(t *testing.T) {
+	opts := []Option{{K: 95, T: 0.1, Sigma: 0.3, IsCall: false}, {K: 105, T: 0.2, Sigma: 0.2, IsCall: true}}
+	prices := PriceChain(nil, 100, 0.02, 0.01, opts)
+	greeks := ChainGreeks(make([]Greeks, 5), 100, 0.02, 0.01, opts)
+	if len(prices) != 2 || len(greeks) != 2 {
+		t.Fatalf("expected one result per option, got %d prices and %d greeks", len(prices), len(greeks))
+	}
+	for i, o := range opts {
+		want := BlackScholesGreeks(100, o.K, o.T, 0.02, 0.01, o.Sigma, o.IsCall)
+		if greeks[i] != want || math.Abs(prices[i]-want.Price) > 1e-12 {
+			t.Errorf("option %d: expected %+v, got %+v and price %.6f", i, want, greeks[i], prices[i])
+		}
+	}
+}
+
+func TestChainDividendsAboveSpot(t *testing.T) {
+	const S, r, q = 100.0, 0.02, 0.01
+	opts := []Option{{K: 95, T: 0.5, Sigma: 0.3, Div: 100, IsCall: true}, {K: 95, T: 0.5, Sigma: 0.3, Div: 120, IsCall: false}}
+	prices := PriceChain(nil, S, r, q, opts)
+	greeks := ChainGreeks(nil, S, r, q, opts)
+	if prices[0] != 0 || greeks[0] != (Greeks{}) {
+		t.Fatalf("expected a worthless call, got %.4f and %+v", prices[0], greeks[0])
+	}
+	df := math.Exp(-r * 0.5)
+	if math.Abs(prices[1]-95*df) > 1e-12 || math.Abs(greeks[1].Price-95*df) > 1e-12 {
+		t.Fatalf("expected the put worth the discounted strike %.4f, got %.4f and %+v", 95*df, prices[1], greeks[1])
+	}
+	// the limits as the spot falls to zero
+	near := BlackScholesGreeks(1e-6, 95, 0.5, r, q, 0.3, false)
+	for name, v := range map[string][2]float64{
+		"delta": {greeks[1].Delta, near.Delta},
+		"theta": {greeks[1].Theta, near.Theta},
+		"rho":   {greeks[1].Rho, near.Rho},
+		"charm": {greeks[1].Charm, near.Charm},
+		"gamma": {greeks[1].Gamma, near.Gamma},
+		"vega":  {greeks[1].Vega, near.Vega},
+	} {
+		if math.IsNaN(v[0]) || math.Abs(v[0]-v[1]) > 1e-6 {
+			t.Errorf("put %s: expected %.6f, got %.6f", name, v[1], v[0])
+		}
+	}
+}
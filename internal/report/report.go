@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/contactkeval/option-replay/internal/backtest/engine"
+	"github.com/contactkeval/option-replay/internal/backtest/sweep"
 )
 
 func WriteJSON(res *engine.Result, outdir string) error {
@@ -18,6 +20,8 @@ func WriteJSON(res *engine.Result, outdir string) error {
 	return os.WriteFile(filepath.Join(outdir, "trades.json"), b, 0644)
 }
 
+// WriteCSV writes the trades to trades.csv. Open and close times are RFC 3339
+// timestamps, so intraday runs keep the bar a trade was opened or closed on.
 func WriteCSV(trades []engine.Trade, outdir string) error {
 	f, err := os.Create(filepath.Join(outdir, "trades.csv"))
 	if err != nil {
@@ -26,19 +30,281 @@ func WriteCSV(trades []engine.Trade, outdir string) error {
 	defer f.Close()
 	w := csv.NewWriter(f)
 	defer w.Flush()
-	headers := []string{"id", "open_time", "open_underlying", "open_premium", "close_time", "close_underlying", "close_premium", "pnl", "strategy_high", "strategy_low", "closed_by", "legs_json"}
+	headers := []string{"id", "underlying", "open_time", "open_underlying", "contracts", "open_premium", "close_time", "close_underlying", "close_premium", "pnl", "costs", "net_pnl", "strategy_high", "strategy_low", "closed_by", "sleeve", "adjustments", "hedge_trades", "hedge_pnl", "option_pnl", "pin_risks", "max_margin", "return_on_margin", "legs_json"}
 	if err := w.Write(headers); err != nil {
 		return err
 	}
 	for _, t := range trades {
 		closeTime := ""
 		if t.CloseDateTime != nil {
-			closeTime = t.CloseDateTime.Format("2006-01-02")
+			closeTime = t.CloseDateTime.Format(time.RFC3339)
 		}
-		pnl := t.ClosePremium - t.OpenPremium
 		legsJson, _ := json.Marshal(t.Legs)
-		row := []string{fmt.Sprintf("%d", t.ID), t.OpenDateTime.Format("2006-01-02"), fmt.Sprintf("%.2f", t.UnderlyingAtOpen), fmt.Sprintf("%.2f", t.OpenPremium), closeTime, fmt.Sprintf("%.2f", t.UnderlyingAtClose), fmt.Sprintf("%.2f", t.ClosePremium), fmt.Sprintf("%.2f", pnl), fmt.Sprintf("%.2f", t.HighPremium), fmt.Sprintf("%.2f", t.LowPremium), t.ClosedBy, string(legsJson)}
+		row := []string{fmt.Sprintf("%d", t.ID), t.Underlying, t.OpenDateTime.Format(time.RFC3339), fmt.Sprintf("%.2f", t.UnderlyingAtOpen), fmt.Sprintf("%d", t.Contracts), fmt.Sprintf("%.2f", t.OpenPremium), closeTime, fmt.Sprintf("%.2f", t.UnderlyingAtClose), fmt.Sprintf("%.2f", t.ClosePremium), fmt.Sprintf("%.2f", t.GrossPnL), fmt.Sprintf("%.2f", t.OpenCosts.Total()+t.AdjustmentCosts.Total()+t.HedgeCosts.Total()+t.CloseCosts.Total()), fmt.Sprintf("%.2f", t.NetPnL), fmt.Sprintf("%.2f", t.HighPremium), fmt.Sprintf("%.2f", t.LowPremium), t.ClosedBy, t.Sleeve, fmt.Sprintf("%d", len(t.Adjustments)), fmt.Sprintf("%d", len(t.HedgeTrades)), fmt.Sprintf("%.2f", t.HedgePnL), fmt.Sprintf("%.2f", t.OptionPnL), fmt.Sprintf("%d", len(t.PinRisks)), fmt.Sprintf("%.2f", t.MaxMargin), fmt.Sprintf("%.2f", t.ReturnOnMargin), string(legsJson)}
 		_ = w.Write(row)
 	}
 	return nil
 }
+
+func WriteEquityCSV(curve []engine.EquityPoint, outdir string) error {
+	f, err := os.Create(filepath.Join(outdir, "equity.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	defer w.Flush()
+	headers := []string{"date", "equity", "realized_pnl", "unrealized_pnl", "open_trades", "margin"}
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+	for _, p := range curve {
+		row := []string{p.Date.Format("2006-01-02"), fmt.Sprintf("%.2f", p.Equity), fmt.Sprintf("%.2f", p.RealizedPnL), fmt.Sprintf("%.2f", p.UnrealizedPnL), fmt.Sprintf("%d", p.OpenTrades), fmt.Sprintf("%.2f", p.Margin)}
+		_ = w.Write(row)
+	}
+	return nil
+}
+
+func WritePortfolioJSON(res *engine.PortfolioResult, outdir string) error {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outdir, "portfolio.json"), b, 0644)
+}
+
+// WriteSleevesCSV writes the per-sleeve breakdown of a portfolio run to
+// sleeves.csv, the sleeve equity curves to sleeve_equity.csv and the sleeve
+// P&L correlation matrix to correlation.csv.
+func WriteSleevesCSV(res *engine.PortfolioResult, outdir string) error {
+	f, err := os.Create(filepath.Join(outdir, "sleeves.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	defer w.Flush()
+	if err := w.Write([]string{"sleeve", "allocation_pct", "trades", "net_pnl", "final_equity"}); err != nil {
+		return err
+	}
+	for _, s := range res.Sleeves {
+		final := 0.0
+		if len(s.Equity) > 0 {
+			final = s.Equity[len(s.Equity)-1].Equity
+		}
+		_ = w.Write([]string{s.Name, fmt.Sprintf("%.2f", s.AllocationPct), fmt.Sprintf("%d", len(s.Trades)), fmt.Sprintf("%.2f", s.NetPnL), fmt.Sprintf("%.2f", final)})
+	}
+
+	ef, err := os.Create(filepath.Join(outdir, "sleeve_equity.csv"))
+	if err != nil {
+		return err
+	}
+	defer ef.Close()
+	ew := csv.NewWriter(ef)
+	defer ew.Flush()
+	if err := ew.Write([]string{"sleeve", "date", "equity", "realized_pnl", "unrealized_pnl", "open_trades", "margin"}); err != nil {
+		return err
+	}
+	for _, s := range res.Sleeves {
+		for _, p := range s.Equity {
+			_ = ew.Write([]string{s.Name, p.Date.Format("2006-01-02"), fmt.Sprintf("%.2f", p.Equity), fmt.Sprintf("%.2f", p.RealizedPnL), fmt.Sprintf("%.2f", p.UnrealizedPnL), fmt.Sprintf("%d", p.OpenTrades), fmt.Sprintf("%.2f", p.Margin)})
+		}
+	}
+
+	cf, err := os.Create(filepath.Join(outdir, "correlation.csv"))
+	if err != nil {
+		return err
+	}
+	defer cf.Close()
+	cw := csv.NewWriter(cf)
+	defer cw.Flush()
+	header := []string{"sleeve"}
+	for _, s := range res.Sleeves {
+		header = append(header, s.Name)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, s := range res.Sleeves {
+		row := []string{s.Name}
+		for _, c := range res.Correlation[i] {
+			row = append(row, fmt.Sprintf("%.4f", c))
+		}
+		_ = cw.Write(row)
+	}
+	return nil
+}
+
+// WriteSweep writes a ranked parameter sweep to sweep.json and sweep.csv,
+// one row per combination, best first.
+func WriteSweep(res *sweep.Result, outdir string) error {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outdir, "sweep.json"), b, 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(outdir, "sweep.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	defer w.Flush()
+	headers := append([]string{"rank"}, res.Params...)
+	headers = append(headers, "trades", "win_rate", "net_pnl", "avg_pnl", "profit_factor", "return_pct", "cagr", "max_drawdown_pct", "sharpe", "error")
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+	for _, r := range res.Rows {
+		row := []string{fmt.Sprintf("%d", r.Rank)}
+		for _, v := range r.Values {
+			row = append(row, fmt.Sprint(v))
+		}
+		s := r.Summary
+		row = append(row, fmt.Sprintf("%d", s.Trades), fmt.Sprintf("%.2f", s.WinRate), fmt.Sprintf("%.2f", s.NetPnL), fmt.Sprintf("%.2f", s.AvgPnL), fmt.Sprintf("%.2f", s.ProfitFactor), fmt.Sprintf("%.2f", s.ReturnPct), fmt.Sprintf("%.2f", s.CAGR), fmt.Sprintf("%.2f", s.MaxDrawdownPct), fmt.Sprintf("%.3f", s.Sharpe), r.Error)
+		_ = w.Write(row)
+	}
+	return nil
+}
+
+// WriteWalkForward writes a walk-forward run to walkforward.json, its
+// windows to walkforward.csv, and the stitched out-of-sample trades and
+// equity to trades.csv and equity.csv.
+func WriteWalkForward(res *sweep.WalkForwardResult, outdir string) error {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outdir, "walkforward.json"), b, 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(outdir, "walkforward.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	defer w.Flush()
+	headers := []string{"window", "in_start", "in_end", "out_start", "out_end"}
+	headers = append(headers, res.Params...)
+	headers = append(headers, "in_"+res.Objective, "out_"+res.Objective, "in_net_pnl", "out_net_pnl", "out_trades", "error")
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+	for i, win := range res.Windows {
+		row := []string{fmt.Sprintf("%d", i+1), win.InStart.Format("2006-01-02"), win.InEnd.Format("2006-01-02"), win.OutStart.Format("2006-01-02"), win.OutEnd.Format("2006-01-02")}
+		for j := range res.Params {
+			v := ""
+			if win.Values != nil {
+				v = fmt.Sprint(win.Values[j])
+			}
+			row = append(row, v)
+		}
+		row = append(row, fmt.Sprintf("%.3f", sweep.Metric(win.InSample, res.Objective)), fmt.Sprintf("%.3f", sweep.Metric(win.OutSample, res.Objective)), fmt.Sprintf("%.2f", win.InSample.NetPnL), fmt.Sprintf("%.2f", win.OutSample.NetPnL), fmt.Sprintf("%d", win.OutSample.Trades), win.Error)
+		_ = w.Write(row)
+	}
+
+	if err := WriteCSV(res.Trades, outdir); err != nil {
+		return err
+	}
+	return WriteEquityCSV(res.Equity, outdir)
+}
+
+// WriteMonteCarloCSV writes the Monte Carlo section of a result to
+// montecarlo.csv: one row per metric with its mean, the run's own value and
+// rank, and the percentile bands. It writes nothing if the run had no Monte
+// Carlo analysis.
+func WriteMonteCarloCSV(res *engine.Result, outdir string) error {
+	mc := res.MonteCarlo
+	if mc == nil {
+		return nil
+	}
+	f, err := os.Create(filepath.Join(outdir, "montecarlo.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	defer w.Flush()
+	headers := []string{"metric", "mean", "actual", "actual_rank"}
+	for _, b := range mc.FinalEquity.Bands {
+		headers = append(headers, fmt.Sprintf("p%g", b.Pct))
+	}
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+	for _, m := range []struct {
+		name string
+		d    engine.Distribution
+	}{
+		{"final_equity", mc.FinalEquity},
+		{"max_drawdown_pct", mc.MaxDrawdownPct},
+		{"losing_streak", mc.LosingStreak},
+	} {
+		row := []string{m.name, fmt.Sprintf("%.2f", m.d.Mean), fmt.Sprintf("%.2f", m.d.Actual), fmt.Sprintf("%.2f", m.d.ActualRank)}
+		for _, b := range m.d.Bands {
+			row = append(row, fmt.Sprintf("%.2f", b.Value))
+		}
+		_ = w.Write(row)
+	}
+	_ = w.Write([]string{"risk_of_ruin_pct", fmt.Sprintf("%.2f", mc.RiskOfRuin)})
+	return nil
+}
+
+// WriteStress writes a stress test to stress.json, its P&L grids to
+// stress.csv (one row per time decay and volatility shift, one column per
+// spot move) and its replayed episodes to stress_historical.csv.
+func WriteStress(res *engine.StressResult, outdir string) error {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outdir, "stress.json"), b, 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(outdir, "stress.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	defer w.Flush()
+	headers := []string{"days", "iv_points"}
+	for _, pct := range res.SpotPct {
+		headers = append(headers, fmt.Sprintf("spot_%+g%%", pct))
+	}
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+	for _, g := range res.Grids {
+		row := []string{fmt.Sprintf("%d", g.Days), fmt.Sprintf("%g", g.IVPoints)}
+		for _, pnl := range g.PnL {
+			row = append(row, fmt.Sprintf("%.2f", pnl))
+		}
+		_ = w.Write(row)
+	}
+
+	hf, err := os.Create(filepath.Join(outdir, "stress_historical.csv"))
+	if err != nil {
+		return err
+	}
+	defer hf.Close()
+	hw := csv.NewWriter(hf)
+	defer hw.Flush()
+	if err := hw.Write([]string{"name", "symbol", "start", "end", "spot_pct", "iv_points", "days", "pnl", "worst_pnl", "worst_date", "error"}); err != nil {
+		return err
+	}
+	for _, h := range res.Historical {
+		worst := ""
+		if !h.WorstDate.IsZero() {
+			worst = h.WorstDate.Format("2006-01-02")
+		}
+		_ = hw.Write([]string{h.Name, h.Symbol, h.Start.Format("2006-01-02"), h.End.Format("2006-01-02"), fmt.Sprintf("%.2f", h.SpotPct), fmt.Sprintf("%.2f", h.IVPoints), fmt.Sprintf("%d", h.Days), fmt.Sprintf("%.2f", h.PnL), fmt.Sprintf("%.2f", h.WorstPnL), worst, h.Error})
+	}
+	return nil
+}